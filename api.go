@@ -0,0 +1,598 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/tdh62/wake_on_lan_proxy/wol"
+)
+
+// apiWakeRequest POST /api/v1/wake 的请求体
+type apiWakeRequest struct {
+	Device    string `json:"device,omitempty"`
+	MAC       string `json:"mac"`
+	Broadcast string `json:"broadcast,omitempty"`
+	Port      int    `json:"port,omitempty"`
+	Password  string `json:"password,omitempty"`
+	Transport string `json:"transport,omitempty"`
+	Interface string `json:"interface,omitempty"`
+	SourceIP  string `json:"source_ip,omitempty"`
+
+	AllInterfaces  bool          `json:"all_interfaces,omitempty"`
+	Repeat         int           `json:"repeat,omitempty"`          // 发送的唤醒包个数
+	RepeatInterval Duration      `json:"repeat_interval,omitempty"` // 重复发送的间隔
+	Verify         *VerifyConfig `json:"verify,omitempty"`
+}
+
+// apiWakeResponse POST /api/v1/wake 的响应体
+type apiWakeResponse struct {
+	Success   bool   `json:"success"`
+	MAC       string `json:"mac,omitempty"`
+	Broadcast string `json:"broadcast,omitempty"`
+	Port      int    `json:"port,omitempty"`
+	Transport string `json:"transport,omitempty"`
+	Interface string `json:"interface,omitempty"`
+	SourceIP  string `json:"source_ip,omitempty"`
+	Error     string `json:"error,omitempty"`
+
+	AllInterfaces bool          `json:"all_interfaces,omitempty"`
+	Packets       int           `json:"packets,omitempty"` // 实际发送的唤醒包个数
+	Verify        *VerifyResult `json:"verify,omitempty"`
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// wakeErrorStatus 将唤醒错误映射为HTTP状态码：输入错误为400，策略不允许为403，权限不足为500，发送失败为502
+func wakeErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, errInvalidMAC), errors.Is(err, errInvalidAddress), errors.Is(err, errInvalidPassword),
+		errors.Is(err, errInvalidTransport), errors.Is(err, errInvalidInterface), errors.Is(err, errInvalidRepeat):
+		return http.StatusBadRequest
+	case errors.Is(err, errTargetNotAllowed):
+		return http.StatusForbidden
+	case errors.Is(err, errRawSocketPermission):
+		return http.StatusInternalServerError
+	case errors.Is(err, errDeviceNotFound):
+		return http.StatusNotFound
+	default:
+		return http.StatusBadGateway
+	}
+}
+
+func handleAPIWake(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeJSON(w, http.StatusMethodNotAllowed, apiWakeResponse{Error: "仅支持POST请求"})
+		return
+	}
+
+	var req apiWakeRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, apiWakeResponse{Error: "无效的JSON请求: " + err.Error()})
+		return
+	}
+
+	if req.Device != "" {
+		device, ok := registry.Get(req.Device)
+		if !ok {
+			writeJSON(w, http.StatusNotFound, apiWakeResponse{Error: errDeviceNotFound.Error()})
+			return
+		}
+		req.MAC = device.MAC
+		if req.Broadcast == "" {
+			req.Broadcast = device.Broadcast
+		}
+		if req.Port == 0 {
+			req.Port = device.Port
+		}
+		if req.Password == "" {
+			req.Password = device.Password
+		}
+		if req.Transport == "" {
+			req.Transport = device.Transport
+		}
+		if req.Interface == "" && req.SourceIP == "" && !req.AllInterfaces {
+			req.Interface = device.Interface
+			req.SourceIP = device.SourceIP
+			req.AllInterfaces = device.AllInterfaces
+		}
+		if req.Repeat == 0 {
+			req.Repeat = device.Repeat
+		}
+		if req.RepeatInterval == 0 {
+			req.RepeatInterval = device.RepeatInterval
+		}
+		if req.Verify == nil {
+			req.Verify = device.Verify
+		}
+	}
+
+	target := WakeTarget{
+		MAC:       req.MAC,
+		Broadcast: req.Broadcast,
+		Port:      req.Port,
+		Password:  req.Password,
+		Transport: req.Transport,
+		Interface: req.Interface,
+		SourceIP:  req.SourceIP,
+
+		AllInterfaces:  req.AllInterfaces,
+		Repeat:         req.Repeat,
+		RepeatInterval: req.RepeatInterval,
+	}.withDefaults()
+
+	resp := apiWakeResponse{
+		MAC:       target.MAC,
+		Broadcast: target.Broadcast,
+		Port:      target.Port,
+		Transport: target.Transport,
+		Interface: target.Interface,
+		SourceIP:  target.SourceIP,
+
+		AllInterfaces: target.AllInterfaces,
+	}
+	if target.Port < 1 || target.Port > 65535 {
+		resp.Error = "端口超出范围"
+		writeJSON(w, http.StatusBadRequest, resp)
+		return
+	}
+
+	if req.Verify != nil {
+		if err := req.Verify.validate(); err != nil {
+			resp.Error = err.Error()
+			writeJSON(w, http.StatusBadRequest, resp)
+			return
+		}
+		// 验证探测会发往该主机，同样受发送策略限制
+		if req.Verify.Host != "" {
+			if _, err := resolveVerifyHost(r.Context(), "ip", req.Verify.Host); err != nil {
+				resp.Error = err.Error()
+				writeJSON(w, wakeErrorStatus(err), resp)
+				return
+			}
+		}
+	}
+
+	log.Printf("%s 通过API请求唤醒 MAC: %s", requestActor(r), target.MAC)
+	extendWriteDeadline(w, target.repeatDuration())
+	ctx := requestOrigin(r, sourceAPI)
+	packets, err := sendWakeOnLANWith(ctx, nil, target)
+	if err != nil {
+		resp.Error = err.Error()
+		writeJSON(w, wakeErrorStatus(err), resp)
+		return
+	}
+	resp.Success = true
+	resp.Packets = packets
+
+	// 请求或设备配置了上线验证时，等待验证结果后再响应
+	if req.Verify != nil {
+		extendWriteDeadline(w, req.Verify.timeout())
+		// 发送成功说明MAC地址有效，验证时使用规范格式
+		mac, _ := wol.ParseMAC(target.MAC)
+		result := verifyWake(ctx, *req.Verify, wol.FormatMAC(mac))
+		resp.Verify = &result
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// handleAPIInterfaces 列出本地接口及各子网的定向广播地址
+func handleAPIInterfaces(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		writeJSON(w, http.StatusMethodNotAllowed, apiWakeResponse{Error: "仅支持GET请求"})
+		return
+	}
+
+	interfaces, err := listInterfaces()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, apiWakeResponse{Error: err.Error()})
+		return
+	}
+	if interfaces == nil {
+		interfaces = []InterfaceInfo{}
+	}
+	writeJSON(w, http.StatusOK, interfaces)
+}
+
+// apiRelayStatus GET /api/v1/relay/stats 的响应体
+type apiRelayStatus struct {
+	Enabled bool         `json:"enabled"`
+	Listen  string       `json:"listen,omitempty"`
+	Sources []RelayStats `json:"sources"`
+}
+
+// handleAPIRelayStats 返回中继按来源地址统计的计数
+func handleAPIRelayStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		writeJSON(w, http.StatusMethodNotAllowed, apiWakeResponse{Error: "仅支持GET请求"})
+		return
+	}
+
+	status := apiRelayStatus{Sources: []RelayStats{}}
+	if relay != nil {
+		status.Enabled = true
+		status.Listen = relay.Addr().String()
+		status.Sources = relay.Stats()
+	}
+	writeJSON(w, http.StatusOK, status)
+}
+
+// handleAPISchedules 列出所有定时任务及接下来的执行时间
+func handleAPISchedules(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		writeJSON(w, http.StatusMethodNotAllowed, apiWakeResponse{Error: "仅支持GET请求"})
+		return
+	}
+
+	views := scheduleViews(registry.List(), time.Now(), 5)
+	if views == nil {
+		views = []ScheduleView{}
+	}
+	writeJSON(w, http.StatusOK, views)
+}
+
+// handleAPIGroups GET 列出所有设备分组，POST 新建分组
+func handleAPIGroups(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, registry.Groups())
+	case http.MethodPost:
+		g, ok := decodeAPIGroup(w, r)
+		if !ok {
+			return
+		}
+		group, err := registry.AddGroup(g)
+		if err != nil {
+			writeJSON(w, groupErrorStatus(err), apiWakeResponse{Error: err.Error()})
+			return
+		}
+		log.Printf("%s 通过API添加了分组 %s", requestActor(r), group.Name)
+		writeJSON(w, http.StatusCreated, group)
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		writeJSON(w, http.StatusMethodNotAllowed, apiWakeResponse{Error: "仅支持GET和POST请求"})
+	}
+}
+
+// handleAPIGroup 按ID或名称读取(GET)、替换(PUT)或删除(DELETE)分组
+func handleAPIGroup(w http.ResponseWriter, r *http.Request) {
+	existing, ok := registry.FindGroup(r.PathValue("id"))
+	if !ok {
+		writeJSON(w, http.StatusNotFound, apiWakeResponse{Error: errGroupNotFound.Error()})
+		return
+	}
+	id := existing.ID
+
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, existing)
+	case http.MethodPut:
+		g, ok := decodeAPIGroup(w, r)
+		if !ok {
+			return
+		}
+		g.ID = id
+		group, err := registry.UpdateGroup(g)
+		if err != nil {
+			writeJSON(w, groupErrorStatus(err), apiWakeResponse{Error: err.Error()})
+			return
+		}
+		log.Printf("%s 通过API修改了分组 %s", requestActor(r), group.Name)
+		writeJSON(w, http.StatusOK, group)
+	case http.MethodDelete:
+		if err := registry.RemoveGroup(id); err != nil {
+			writeJSON(w, groupErrorStatus(err), apiWakeResponse{Error: err.Error()})
+			return
+		}
+		log.Printf("%s 通过API删除了分组 %s", requestActor(r), existing.Name)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.Header().Set("Allow", "GET, PUT, DELETE")
+		writeJSON(w, http.StatusMethodNotAllowed, apiWakeResponse{Error: "仅支持GET、PUT和DELETE请求"})
+	}
+}
+
+// decodeAPIGroup 解析分组请求体，步骤中的设备可以填写设备ID、名称或MAC地址；
+// 解析失败时已写入响应并返回false
+func decodeAPIGroup(w http.ResponseWriter, r *http.Request) (Group, bool) {
+	var g Group
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&g); err != nil {
+		writeJSON(w, http.StatusBadRequest, apiWakeResponse{Error: "无效的JSON请求: " + err.Error()})
+		return Group{}, false
+	}
+	for i, step := range g.Steps {
+		device, ok := registry.Find(step.Device)
+		if !ok {
+			writeJSON(w, http.StatusBadRequest, apiWakeResponse{Error: fmt.Sprintf("%v: %s", errDeviceNotFound, step.Device)})
+			return Group{}, false
+		}
+		g.Steps[i].Device = device.ID
+	}
+	return g, true
+}
+
+// groupErrorStatus 返回分组操作失败时的HTTP状态码
+func groupErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, errGroupNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, errInvalidGroup), errors.Is(err, errDeviceNotFound):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// apiGroupWakeRequest POST /api/v1/groups/wake 的请求体
+type apiGroupWakeRequest struct {
+	Group string `json:"group"` // 分组ID或名称
+}
+
+// handleAPIGroupWake 唤醒分组，顺序模式下等待所有步骤完成后返回逐步结果
+func handleAPIGroupWake(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeJSON(w, http.StatusMethodNotAllowed, apiWakeResponse{Error: "仅支持POST请求"})
+		return
+	}
+
+	var req apiGroupWakeRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, apiWakeResponse{Error: "无效的JSON请求: " + err.Error()})
+		return
+	}
+	group, ok := registry.FindGroup(req.Group)
+	if !ok {
+		writeJSON(w, http.StatusNotFound, apiWakeResponse{Error: errGroupNotFound.Error()})
+		return
+	}
+
+	log.Printf("%s 通过API请求唤醒分组 %s", requestActor(r), group.Name)
+	extendWriteDeadline(w, group.timeout())
+	ctx := requestOrigin(r, sourceAPI)
+	writeJSON(w, http.StatusOK, wakeGroup(ctx, group, wakeWith(ctx)))
+}
+
+// apiBulkWakeRequest POST /api/v1/wake/bulk 的请求体
+type apiBulkWakeRequest struct {
+	Targets        []string `json:"targets"`                   // MAC地址或已登记设备的名称/ID
+	Broadcast      string   `json:"broadcast,omitempty"`       // 未登记的MAC地址使用的广播地址
+	Port           int      `json:"port,omitempty"`            // 未登记的MAC地址使用的端口
+	Interface      string   `json:"interface,omitempty"`       // 未登记的MAC地址使用的网络接口
+	Repeat         int      `json:"repeat,omitempty"`          // 每个目标发送的唤醒包个数，为0时使用设备或配置中的设置
+	RepeatInterval Duration `json:"repeat_interval,omitempty"` // 重复发送的间隔
+	Rate           int      `json:"rate,omitempty"`            // 每秒发送的唤醒包数，为0时使用配置，不能超过配置
+	Concurrency    int      `json:"concurrency,omitempty"`     // 同时进行的发送数，为0时使用配置，不能超过配置
+}
+
+// handleAPIBulkWake 批量唤醒，所有目标发送完成后返回逐个MAC的结果
+func handleAPIBulkWake(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeJSON(w, http.StatusMethodNotAllowed, apiWakeResponse{Error: "仅支持POST请求"})
+		return
+	}
+
+	var req apiBulkWakeRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, apiWakeResponse{Error: "无效的JSON请求: " + err.Error()})
+		return
+	}
+	if req.Rate < 0 || req.Concurrency < 0 {
+		writeJSON(w, http.StatusBadRequest, apiWakeResponse{Error: "速率和并发数不能为负数"})
+		return
+	}
+	if req.Port < 0 || req.Port > 65535 {
+		writeJSON(w, http.StatusBadRequest, apiWakeResponse{Error: "端口超出范围"})
+		return
+	}
+
+	if err := validateRepeat(req.Repeat, req.RepeatInterval); err != nil {
+		writeJSON(w, http.StatusBadRequest, apiWakeResponse{Error: err.Error()})
+		return
+	}
+
+	targets := resolveBulkTargets(req.Targets, WakeTarget{
+		Broadcast:      req.Broadcast,
+		Port:           req.Port,
+		Interface:      req.Interface,
+		Repeat:         req.Repeat,
+		RepeatInterval: req.RepeatInterval,
+	})
+	if len(targets) == 0 {
+		writeJSON(w, http.StatusBadRequest, apiWakeResponse{Error: "没有需要唤醒的目标"})
+		return
+	}
+	opts := bulkOptions(req.Rate, req.Concurrency, len(targets))
+
+	log.Printf("%s 通过API请求批量唤醒 %d 个目标", requestActor(r), len(targets))
+	extendWriteDeadline(w, opts.timeout(targets))
+	report := wakeBulk(requestOrigin(r, sourceBulk), targets, opts)
+	log.Printf("批量唤醒完成: 成功 %d, 失败 %d, 用时 %s", report.Succeeded, report.Failed, report.Duration)
+	writeJSON(w, http.StatusOK, report)
+}
+
+// apiAuditResponse GET /api/v1/audit 的响应体，Entries 按时间倒序
+type apiAuditResponse struct {
+	Total   int          `json:"total"`
+	Page    int          `json:"page"`
+	PerPage int          `json:"per_page"`
+	Entries []AuditEntry `json:"entries"`
+}
+
+// handleAPIAudit 分页列出审计日志，最新的记录在前
+func handleAPIAudit(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		writeJSON(w, http.StatusMethodNotAllowed, apiWakeResponse{Error: "仅支持GET请求"})
+		return
+	}
+
+	page, perPage := pageParams(r)
+	entries, total := auditLog.Page((page-1)*perPage, perPage)
+	if entries == nil {
+		entries = []AuditEntry{}
+	}
+	writeJSON(w, http.StatusOK, apiAuditResponse{Total: total, Page: page, PerPage: perPage, Entries: entries})
+}
+
+// handleAPIAuditExport 按时间顺序导出全部审计日志，format 为 json（默认）或 csv
+func handleAPIAuditExport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		writeJSON(w, http.StatusMethodNotAllowed, apiWakeResponse{Error: "仅支持GET请求"})
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "json"
+	}
+	if format != "json" && format != "csv" {
+		writeJSON(w, http.StatusBadRequest, apiWakeResponse{Error: "不支持的导出格式: " + format})
+		return
+	}
+
+	entries := auditLog.All()
+	filename := fmt.Sprintf("wol-audit-%s.%s", time.Now().Format("20060102"), format)
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+	if format == "csv" {
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		if err := writeAuditCSV(w, entries); err != nil {
+			log.Printf("导出审计日志失败: %v", err)
+		}
+		return
+	}
+	writeJSON(w, http.StatusOK, entries)
+}
+
+// apiWebhookDeliveriesResponse GET /api/v1/webhooks/deliveries 的响应体，Deliveries 按时间倒序
+type apiWebhookDeliveriesResponse struct {
+	Deliveries []WebhookDelivery `json:"deliveries"`
+}
+
+// handleAPIWebhookDeliveries 返回最近的webhook投递记录
+func handleAPIWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		writeJSON(w, http.StatusMethodNotAllowed, apiWakeResponse{Error: "仅支持GET请求"})
+		return
+	}
+
+	resp := apiWebhookDeliveriesResponse{Deliveries: []WebhookDelivery{}}
+	if webhooks != nil {
+		resp.Deliveries = webhooks.Deliveries()
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// apiDiscoveryResponse GET /api/v1/discovery 的响应体
+type apiDiscoveryResponse struct {
+	Hosts []DiscoveredHost `json:"hosts"`
+}
+
+// handleAPIDiscovery 列出邻居表中的主机，sweep 参数指定时先主动扫描该网段，resolve=true 时反向解析主机名
+func handleAPIDiscovery(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		writeJSON(w, http.StatusMethodNotAllowed, apiWakeResponse{Error: "仅支持GET请求"})
+		return
+	}
+
+	query := r.URL.Query()
+	resolve, _ := strconv.ParseBool(query.Get("resolve"))
+	var sweep *net.IPNet
+	if s := query.Get("sweep"); s != "" {
+		network, err := parseSweep(s)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, apiWakeResponse{Error: err.Error()})
+			return
+		}
+		sweep = network
+		log.Printf("%s 请求扫描网段 %s", requestActor(r), sweep)
+	}
+
+	extendWriteDeadline(w, discoveryTimeout(sweep, resolve))
+	hosts, err := discoverHosts(r.Context(), sweep, resolve)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, apiWakeResponse{Error: err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, apiDiscoveryResponse{Hosts: hosts})
+}
+
+// apiDiscoveryImportRequest POST /api/v1/discovery/import 的请求体
+type apiDiscoveryImportRequest struct {
+	Hosts []apiDiscoveryImportHost `json:"hosts"`
+}
+
+// apiDiscoveryImportHost 要导入的主机，Name 为空时依次使用 Hostname 和 IP
+type apiDiscoveryImportHost struct {
+	MAC      string `json:"mac"`
+	IP       string `json:"ip,omitempty"`
+	Hostname string `json:"hostname,omitempty"`
+	Name     string `json:"name,omitempty"`
+}
+
+// apiDiscoveryImportResult 一台主机的导入结果
+type apiDiscoveryImportResult struct {
+	MAC    string  `json:"mac"`
+	Device *Device `json:"device,omitempty"`
+	Error  string  `json:"error,omitempty"`
+}
+
+// apiDiscoveryImportResponse POST /api/v1/discovery/import 的响应体
+type apiDiscoveryImportResponse struct {
+	Imported int                        `json:"imported"`
+	Failed   int                        `json:"failed"`
+	Results  []apiDiscoveryImportResult `json:"results"`
+}
+
+// handleAPIDiscoveryImport 将发现的主机登记为设备，已登记的MAC地址会失败，返回逐个主机的结果
+func handleAPIDiscoveryImport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeJSON(w, http.StatusMethodNotAllowed, apiWakeResponse{Error: "仅支持POST请求"})
+		return
+	}
+
+	var req apiDiscoveryImportRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, apiWakeResponse{Error: "无效的JSON请求: " + err.Error()})
+		return
+	}
+	if len(req.Hosts) == 0 {
+		writeJSON(w, http.StatusBadRequest, apiWakeResponse{Error: "没有需要导入的主机"})
+		return
+	}
+
+	resp := apiDiscoveryImportResponse{Results: []apiDiscoveryImportResult{}}
+	for _, h := range req.Hosts {
+		result := apiDiscoveryImportResult{MAC: h.MAC}
+		device, err := importHost(DiscoveredHost{MAC: h.MAC, IP: h.IP, Hostname: h.Hostname}, h.Name)
+		if err != nil {
+			result.Error = err.Error()
+			resp.Failed++
+		} else {
+			log.Printf("%s 导入了设备 %s (%s)", requestActor(r), device.Name, device.MAC)
+			result.MAC, result.Device = device.MAC, &device
+			resp.Imported++
+		}
+		resp.Results = append(resp.Results, result)
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tdh62/wake_on_lan_proxy/wol"
+)
+
+// useTestRegistry 为测试替换全局设备登记表
+func useTestRegistry(t *testing.T) *DeviceRegistry {
+	t.Helper()
+
+	r, err := openDeviceRegistry(filepath.Join(t.TempDir(), "devices.json"))
+	if err != nil {
+		t.Fatalf("openDeviceRegistry() error = %v", err)
+	}
+	old := registry
+	registry = r
+	t.Cleanup(func() { registry = old })
+	return r
+}
+
+func TestHandleAPIWakeErrors(t *testing.T) {
+	useTestRegistry(t)
+
+	tests := []struct {
+		name       string
+		method     string
+		body       string
+		wantStatus int
+	}{
+		{name: "Method not allowed", method: http.MethodGet, body: "", wantStatus: http.StatusMethodNotAllowed},
+		{name: "Malformed JSON", method: http.MethodPost, body: "{", wantStatus: http.StatusBadRequest},
+		{name: "Invalid MAC", method: http.MethodPost, body: `{"mac":"GG:HH:II:JJ:KK:LL"}`, wantStatus: http.StatusBadRequest},
+		{name: "Invalid password", method: http.MethodPost, body: `{"mac":"AA:BB:CC:DD:EE:FF","password":"xyz"}`, wantStatus: http.StatusBadRequest},
+		{name: "Invalid port", method: http.MethodPost, body: `{"mac":"AA:BB:CC:DD:EE:FF","port":70000}`, wantStatus: http.StatusBadRequest},
+		{name: "Unknown device", method: http.MethodPost, body: `{"device":"missing"}`, wantStatus: http.StatusNotFound},
+		{name: "Too many repeats", method: http.MethodPost, body: `{"mac":"AA:BB:CC:DD:EE:FF","repeat":100}`, wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/api/v1/wake", strings.NewReader(tt.body))
+			rec := httptest.NewRecorder()
+			handleAPIWake(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d (body: %s)", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+			var resp apiWakeResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("response is not JSON: %v", err)
+			}
+			if resp.Success || resp.Error == "" {
+				t.Errorf("response = %+v, want failure with error message", resp)
+			}
+		})
+	}
+}
+
+func TestHandleAPIWakeSendsPacket(t *testing.T) {
+	useTestRegistry(t)
+
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("ListenUDP() error = %v", err)
+	}
+	defer conn.Close()
+	port := conn.LocalAddr().(*net.UDPAddr).Port
+
+	body := fmt.Sprintf(`{"mac":"AA:BB:CC:DD:EE:FF","broadcast":"127.0.0.1","port":%d}`, port)
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/wake", strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	handleAPIWake(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200 (body: %s)", rec.Code, rec.Body.String())
+	}
+	var resp apiWakeResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("response is not JSON: %v", err)
+	}
+	if !resp.Success || resp.Port != port {
+		t.Errorf("response = %+v, want success on port %d", resp, port)
+	}
+
+	buf := make([]byte, 1024)
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	n, _, err := conn.ReadFromUDP(buf)
+	if err != nil {
+		t.Fatalf("no packet received: %v", err)
+	}
+	want := wol.MagicPacket([]byte{0xAA, 0xBB, 0xCC, 0xDD, 0xEE, 0xFF}, nil)
+	if !bytes.Equal(buf[:n], want) {
+		t.Errorf("received packet = %x, want %x", buf[:n], want)
+	}
+}
+
+func TestHandleAPIWakeVerifyARPDashedMAC(t *testing.T) {
+	useTestRegistry(t)
+	useFastVerify(t)
+	conn := listenTestUDP(t)
+	port := conn.LocalAddr().(*net.UDPAddr).Port
+	useNeighborTable(t, []neighbor{{IP: net.IPv4(127, 0, 0, 2), MAC: "AA:BB:CC:DD:EE:FF", Interface: "lo", Reachable: true}})
+
+	// 请求中的MAC地址写法与邻居表不同，验证时仍应匹配
+	body := fmt.Sprintf(`{"mac":"aa-bb-cc-dd-ee-ff","broadcast":"127.0.0.1","port":%d,"verify":{"method":"arp","timeout":"1s"}}`, port)
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/wake", strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	handleAPIWake(rec, req)
+
+	var resp apiWakeResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("response is not JSON: %v", err)
+	}
+	if rec.Code != http.StatusOK || resp.Verify == nil || !resp.Verify.Online {
+		t.Errorf("status = %d, response = %s, want the device verified online", rec.Code, rec.Body)
+	}
+}
+
+func TestHandleAPIWakeRepeat(t *testing.T) {
+	reg := useTestRegistry(t)
+	conn := listenTestUDP(t)
+	port := conn.LocalAddr().(*net.UDPAddr).Port
+
+	devices := addTestDevices(t, reg, Device{
+		Name: "bridge", MAC: "AA:BB:CC:DD:EE:FF", Broadcast: "127.0.0.1", Port: port,
+		Repeat: 2, RepeatInterval: Duration(10 * time.Millisecond),
+	})
+
+	tests := []struct {
+		name        string
+		body        string
+		wantPackets int
+	}{
+		{name: "Device setting", body: fmt.Sprintf(`{"device":%q}`, devices["bridge"].ID), wantPackets: 2},
+		{name: "Request overrides device", body: fmt.Sprintf(`{"device":%q,"repeat":3,"repeat_interval":"5ms"}`, devices["bridge"].ID), wantPackets: 3},
+		{name: "Global default", body: fmt.Sprintf(`{"mac":"AA:BB:CC:DD:EE:FF","broadcast":"127.0.0.1","port":%d}`, port), wantPackets: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/wake", strings.NewReader(tt.body))
+			rec := httptest.NewRecorder()
+			handleAPIWake(rec, req)
+
+			var resp apiWakeResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("response is not JSON: %v", err)
+			}
+			if !resp.Success || resp.Packets != tt.wantPackets {
+				t.Errorf("response = %+v, want %d packets", resp, tt.wantPackets)
+			}
+			receivePackets(t, conn, tt.wantPackets)
+		})
+	}
+}
@@ -0,0 +1,440 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tdh62/wake_on_lan_proxy/wol"
+)
+
+// 唤醒请求的来源
+const (
+	sourceWeb      = "web"
+	sourceAPI      = "api"
+	sourceBulk     = "bulk"
+	sourceSchedule = "schedule"
+	sourceProxy    = "proxy"
+	sourceRelay    = "relay"
+	sourceMQTT     = "mqtt"
+)
+
+// AuditEntry 审计日志中的一次唤醒尝试
+type AuditEntry struct {
+	ID          int64         `json:"id"`
+	Time        time.Time     `json:"time"`
+	Source      string        `json:"source"`              // 发起唤醒的途径: web、api、bulk、schedule、proxy、relay
+	User        string        `json:"user,omitempty"`      // 登录用户或API令牌名称
+	ClientIP    string        `json:"client_ip,omitempty"` // HTTP请求的客户端地址
+	Device      string        `json:"device,omitempty"`    // 已登记设备的名称
+	MAC         string        `json:"mac"`
+	Destination string        `json:"destination"`
+	Transport   string        `json:"transport"`
+	Success     bool          `json:"success"`
+	Packets     int           `json:"packets,omitempty"`
+	Error       string        `json:"error,omitempty"`
+	Verify      *VerifyResult `json:"verify,omitempty"` // 上线验证的结果，未验证时为空
+}
+
+// AuditLog 追加写入的唤醒审计日志，每行一条JSON记录
+//
+// 验证结果在唤醒之后才得到，以相同ID追加一条完整记录，加载时后面的记录覆盖前面的。
+// 超过保留时间或条数的记录在写入时从内存中删除，文件中积累的过期行达到一定比例后重写文件
+type AuditLog struct {
+	mu         sync.Mutex
+	path       string
+	file       *os.File
+	entries    []AuditEntry // 按ID（即时间）顺序
+	nextID     int64
+	lines      int // 文件中的行数，包括已过期和被覆盖的行
+	retention  time.Duration
+	maxEntries int
+}
+
+// auditLog 服务端的审计日志，为空时不记录（如命令行子命令）
+var auditLog *AuditLog
+
+// openAuditLog 加载审计日志文件，文件不存在时创建
+//
+// retention 和 maxEntries 为0时不限制
+func openAuditLog(path string, retention time.Duration, maxEntries int) (*AuditLog, error) {
+	l := &AuditLog{path: path, nextID: 1, retention: retention, maxEntries: maxEntries}
+
+	if err := l.load(); err != nil {
+		return nil, err
+	}
+	l.prune(time.Now())
+	if err := l.compact(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// load 读取文件中的所有记录，相同ID的记录只保留最后一条
+func (l *AuditLog) load() error {
+	f, err := os.Open(l.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("无法读取审计日志: %v", err)
+	}
+	defer f.Close()
+
+	index := make(map[int64]int)
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1<<20)
+	for scanner.Scan() {
+		var e AuditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil || e.ID == 0 {
+			// 跳过写到一半的行，如进程在写入时退出
+			continue
+		}
+		if i, ok := index[e.ID]; ok {
+			l.entries[i] = e
+			continue
+		}
+		index[e.ID] = len(l.entries)
+		l.entries = append(l.entries, e)
+		l.nextID = max(l.nextID, e.ID+1)
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("无法读取审计日志 %s: %v", l.path, err)
+	}
+	return nil
+}
+
+// Append 追加一条记录，分配ID，未设置时间时使用当前时间
+func (l *AuditLog) Append(e AuditEntry) (AuditEntry, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	e.ID = l.nextID
+	l.nextID++
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	l.entries = append(l.entries, e)
+	if err := l.write(e); err != nil {
+		return e, err
+	}
+
+	l.prune(time.Now())
+	// 过期的行超过一半时重写文件，避免文件无限增长
+	if l.lines > 2*len(l.entries)+100 {
+		if err := l.compact(); err != nil {
+			return e, err
+		}
+	}
+	return e, nil
+}
+
+// Update 修改ID对应的记录并追加写入，如补充验证结果；记录已过期删除时忽略
+func (l *AuditLog) Update(id int64, update func(e *AuditEntry)) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for i := len(l.entries) - 1; i >= 0; i-- {
+		if l.entries[i].ID == id {
+			update(&l.entries[i])
+			return l.write(l.entries[i])
+		}
+	}
+	return nil
+}
+
+// Page 按时间倒序返回跳过 offset 条后的最多 limit 条记录，以及记录总数
+func (l *AuditLog) Page(offset, limit int) ([]AuditEntry, int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.prune(time.Now())
+	total := len(l.entries)
+	var page []AuditEntry
+	for i := total - 1 - offset; i >= 0 && len(page) < limit; i-- {
+		page = append(page, l.entries[i])
+	}
+	return page, total
+}
+
+// All 按时间顺序返回所有记录
+func (l *AuditLog) All() []AuditEntry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.prune(time.Now())
+	entries := make([]AuditEntry, len(l.entries))
+	copy(entries, l.entries)
+	return entries
+}
+
+// Close 关闭日志文件
+func (l *AuditLog) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.file == nil {
+		return nil
+	}
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
+
+// write 将一条记录追加到文件末尾
+func (l *AuditLog) write(e AuditEntry) error {
+	if l.file == nil {
+		f, err := os.OpenFile(l.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+		if err != nil {
+			return fmt.Errorf("无法写入审计日志: %v", err)
+		}
+		l.file = f
+	}
+
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	if _, err := l.file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("无法写入审计日志: %v", err)
+	}
+	l.lines++
+	return nil
+}
+
+// prune 从内存中删除超过保留时间和条数的最早的记录
+//
+// 超过条数时一次删除到上限的90%，而不是每追加一条就删除一条；删除只是重新切片，
+// 之后追加时扩容才复制剩余的记录，避免记录达到上限后每次唤醒都复制整个列表
+func (l *AuditLog) prune(now time.Time) {
+	drop := 0
+	if l.maxEntries > 0 && len(l.entries) > l.maxEntries {
+		drop = len(l.entries) - l.maxEntries*9/10
+	}
+	if l.retention > 0 {
+		cutoff := now.Add(-l.retention)
+		for drop < len(l.entries) && l.entries[drop].Time.Before(cutoff) {
+			drop++
+		}
+	}
+	if drop > 0 {
+		clear(l.entries[:drop]) // 释放删除的记录引用的字符串
+		l.entries = l.entries[drop:]
+	}
+}
+
+// compact 只保留内存中的记录重写文件，先写入临时文件再重命名
+func (l *AuditLog) compact() error {
+	if l.file != nil {
+		l.file.Close()
+		l.file = nil
+	}
+
+	tmp := l.path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return fmt.Errorf("无法写入审计日志: %v", err)
+	}
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for _, e := range l.entries {
+		if err := enc.Encode(e); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return fmt.Errorf("无法写入审计日志: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("无法写入审计日志: %v", err)
+	}
+	if err := os.Rename(tmp, l.path); err != nil {
+		return fmt.Errorf("无法写入审计日志: %v", err)
+	}
+	l.lines = len(l.entries)
+	return nil
+}
+
+// auditPath 返回审计日志文件路径，未配置时使用设备登记文件所在目录下的 audit.jsonl
+func (c Config) auditPath() string {
+	if c.AuditFile != "" {
+		return c.AuditFile
+	}
+	return filepath.Join(filepath.Dir(c.DataFile), "audit.jsonl")
+}
+
+// wakeOrigin 唤醒请求的来源，通过 context 传递到 sendWakeOnLANWith 写入审计日志
+type wakeOrigin struct {
+	source   string
+	user     string
+	clientIP string
+
+	mu      sync.Mutex
+	entries map[string]int64 // MAC地址对应的最近一条审计记录ID，用于补充验证结果
+}
+
+type wakeOriginKey struct{}
+
+// withWakeOrigin 返回携带唤醒来源的 context
+func withWakeOrigin(ctx context.Context, source, user, clientIP string) context.Context {
+	return context.WithValue(ctx, wakeOriginKey{}, &wakeOrigin{source: source, user: user, clientIP: clientIP})
+}
+
+// originOf 返回 ctx 中的唤醒来源，没有时为空
+func originOf(ctx context.Context) *wakeOrigin {
+	origin, _ := ctx.Value(wakeOriginKey{}).(*wakeOrigin)
+	return origin
+}
+
+// requestOrigin 返回以HTTP请求的用户和客户端地址为来源的 context
+func requestOrigin(r *http.Request, source string) context.Context {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return withWakeOrigin(r.Context(), source, requestUser(r), host)
+}
+
+// auditWake 记录一次唤醒尝试，来源取自 ctx，mac 为解析后的MAC地址，无效时为空
+func auditWake(ctx context.Context, target WakeTarget, mac string, packets int, wakeErr error) {
+	if auditLog == nil {
+		return
+	}
+
+	e := AuditEntry{
+		MAC:         target.MAC,
+		Destination: target.destination(),
+		Transport:   target.Transport,
+		Success:     wakeErr == nil,
+		Packets:     packets,
+	}
+	if mac != "" {
+		e.MAC = mac
+		if d, ok := registry.Find(mac); ok {
+			e.Device = d.Name
+		}
+	}
+	if wakeErr != nil {
+		e.Error = wakeErr.Error()
+	}
+	origin := originOf(ctx)
+	if origin != nil {
+		e.Source, e.User, e.ClientIP = origin.source, origin.user, origin.clientIP
+	}
+
+	e, err := auditLog.Append(e)
+	if err != nil {
+		log.Printf("写入审计日志失败: %v", err)
+		return
+	}
+	if origin != nil {
+		origin.mu.Lock()
+		if origin.entries == nil {
+			origin.entries = make(map[string]int64)
+		}
+		origin.entries[e.MAC] = e.ID
+		origin.mu.Unlock()
+	}
+}
+
+// auditVerification 将验证结果补充到同一来源最近一次唤醒该MAC地址的审计记录中
+func auditVerification(ctx context.Context, mac string, result *VerifyResult) {
+	origin := originOf(ctx)
+	if auditLog == nil || origin == nil {
+		return
+	}
+
+	if b, err := wol.ParseMAC(mac); err == nil {
+		mac = wol.FormatMAC(b)
+	}
+	origin.mu.Lock()
+	id, ok := origin.entries[mac]
+	origin.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	v := *result
+	if err := auditLog.Update(id, func(e *AuditEntry) { e.Verify = &v }); err != nil {
+		log.Printf("写入审计日志失败: %v", err)
+	}
+}
+
+// auditPageSize 历史记录页面和API每页的默认记录数
+const auditPageSize = 50
+
+// maxAuditPageSize API每页最多返回的记录数
+const maxAuditPageSize = 500
+
+// pageParams 解析 page 和 per_page 查询参数，page 从1开始，无效的值使用默认值
+func pageParams(r *http.Request) (page, perPage int) {
+	page, perPage = 1, auditPageSize
+	if v, err := strconv.Atoi(r.URL.Query().Get("page")); err == nil && v > 0 {
+		page = v
+	}
+	if v, err := strconv.Atoi(r.URL.Query().Get("per_page")); err == nil && v > 0 {
+		perPage = min(v, maxAuditPageSize)
+	}
+	return page, perPage
+}
+
+// auditCSVHeader 导出CSV的表头，与 auditCSVRecord 的字段顺序一致
+var auditCSVHeader = []string{
+	"id", "time", "source", "user", "client_ip", "device", "mac", "destination", "transport",
+	"success", "packets", "error", "verify_method", "verify_online", "verify_seconds", "verify_error",
+}
+
+// auditCSVRecord 将一条审计记录转换为CSV的一行
+func auditCSVRecord(e AuditEntry) []string {
+	record := []string{
+		strconv.FormatInt(e.ID, 10), e.Time.Format(time.RFC3339), e.Source, e.User, e.ClientIP, e.Device, e.MAC,
+		e.Destination, e.Transport, strconv.FormatBool(e.Success), strconv.Itoa(e.Packets), e.Error,
+		"", "", "", "",
+	}
+	if v := e.Verify; v != nil {
+		record[12] = v.Method
+		record[13] = strconv.FormatBool(v.Online)
+		record[14] = strconv.FormatFloat(v.ElapsedSeconds, 'f', -1, 64)
+		record[15] = v.Error
+	}
+	return record
+}
+
+// writeAuditCSV 以CSV格式写出审计记录
+func writeAuditCSV(w io.Writer, entries []AuditEntry) error {
+	cw := csv.NewWriter(w)
+	cw.Write(auditCSVHeader)
+	for _, e := range entries {
+		record := auditCSVRecord(e)
+		for i := range record {
+			record[i] = csvCell(record[i])
+		}
+		cw.Write(record)
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// csvCell 在以 = + - @ 等开头的单元格前加上单引号，设备名称和用户名等来自用户输入，
+// 避免用表格软件打开导出的文件时被当作公式执行
+func csvCell(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// useTestAudit 将审计日志替换为临时文件中的日志
+func useTestAudit(t *testing.T) *AuditLog {
+	t.Helper()
+
+	l, err := openAuditLog(filepath.Join(t.TempDir(), "audit.jsonl"), 0, 0)
+	if err != nil {
+		t.Fatalf("openAuditLog() error = %v", err)
+	}
+	old := auditLog
+	auditLog = l
+	t.Cleanup(func() {
+		l.Close()
+		auditLog = old
+	})
+	return l
+}
+
+func TestAuditLogReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	l, err := openAuditLog(path, 0, 0)
+	if err != nil {
+		t.Fatalf("openAuditLog() error = %v", err)
+	}
+
+	first, _ := l.Append(AuditEntry{MAC: "11:11:11:11:11:11", Success: true})
+	l.Append(AuditEntry{MAC: "22:22:22:22:22:22"})
+	if err := l.Update(first.ID, func(e *AuditEntry) { e.Verify = &VerifyResult{Method: verifyTCP, Online: true} }); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	l.Close()
+
+	l, err = openAuditLog(path, 0, 0)
+	if err != nil {
+		t.Fatalf("openAuditLog() error = %v", err)
+	}
+	defer l.Close()
+
+	entries := l.All()
+	if len(entries) != 2 {
+		t.Fatalf("reloaded %d entries, want 2", len(entries))
+	}
+	if entries[0].ID != first.ID || entries[0].Verify == nil || !entries[0].Verify.Online {
+		t.Errorf("entries[0] = %+v, want the verification result merged into entry %d", entries[0], first.ID)
+	}
+	if e, _ := l.Append(AuditEntry{MAC: "33:33:33:33:33:33"}); e.ID != 3 {
+		t.Errorf("next ID = %d, want 3", e.ID)
+	}
+}
+
+func TestAuditLogRetention(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	l, err := openAuditLog(path, 24*time.Hour, 10)
+	if err != nil {
+		t.Fatalf("openAuditLog() error = %v", err)
+	}
+
+	// 过期的记录立即删除；第11条未过期的记录超过上限，删除到9条后再追加第12条
+	now := time.Now()
+	l.Append(AuditEntry{MAC: "00:00:00:00:00:00", Time: now.Add(-48 * time.Hour)})
+	for i := 1; i <= 12; i++ {
+		l.Append(AuditEntry{MAC: fmt.Sprintf("00:00:00:00:00:%02d", i), Time: now})
+	}
+
+	page, total := l.Page(0, 2)
+	if total != 10 {
+		t.Fatalf("total = %d, want 10 after pruning by age and count", total)
+	}
+	if len(page) != 2 || page[0].MAC != "00:00:00:00:00:12" || page[1].MAC != "00:00:00:00:00:11" {
+		t.Errorf("Page(0, 2) = %+v, want the two newest entries", page)
+	}
+	l.Close()
+
+	// 重新打开时文件中的13条记录删除过期的一条后仍超过上限，同样删除到9条
+	l, err = openAuditLog(path, 24*time.Hour, 10)
+	if err != nil {
+		t.Fatalf("openAuditLog() error = %v", err)
+	}
+	defer l.Close()
+	if entries := l.All(); len(entries) != 9 || entries[0].MAC != "00:00:00:00:00:04" {
+		t.Errorf("reloaded entries = %+v, want the last 9", entries)
+	}
+}
+
+func TestAuditLogPruneBatch(t *testing.T) {
+	l, err := openAuditLog(filepath.Join(t.TempDir(), "audit.jsonl"), 0, 100)
+	if err != nil {
+		t.Fatalf("openAuditLog() error = %v", err)
+	}
+	defer l.Close()
+
+	for i := 0; i < 100; i++ {
+		l.Append(AuditEntry{MAC: "00:00:00:00:00:01"})
+	}
+	if n := len(l.All()); n != 100 {
+		t.Fatalf("entries = %d, want 100 before reaching the limit", n)
+	}
+
+	// 超过上限时一次删除到90%，之后的追加不再逐条删除
+	l.Append(AuditEntry{MAC: "00:00:00:00:00:02"})
+	entries := l.All()
+	if len(entries) != 90 || entries[len(entries)-1].MAC != "00:00:00:00:00:02" {
+		t.Fatalf("entries = %d, want 90 ending with the newest", len(entries))
+	}
+	for i := 0; i < 10; i++ {
+		l.Append(AuditEntry{MAC: "00:00:00:00:00:03"})
+	}
+	if n := len(l.All()); n != 100 {
+		t.Errorf("entries = %d, want 100", n)
+	}
+}
+
+func TestCSVCell(t *testing.T) {
+	for in, want := range map[string]string{
+		"":           "",
+		"admin":      "admin",
+		"=1+1":       "'=1+1",
+		"+1":         "'+1",
+		"-1":         "'-1",
+		"@SUM(A1)":   "'@SUM(A1)",
+		"\t=1":       "'\t=1",
+		"a=1":        "a=1",
+		"192.0.2.10": "192.0.2.10",
+	} {
+		if got := csvCell(in); got != want {
+			t.Errorf("csvCell(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestSendWakeOnLANAudit(t *testing.T) {
+	useTestRegistry(t)
+	useFastVerify(t)
+	l := useTestAudit(t)
+	conn := listenTestUDP(t)
+	port := conn.LocalAddr().(*net.UDPAddr).Port
+
+	ctx := withWakeOrigin(context.Background(), sourceAPI, "admin", "192.0.2.10")
+	sendWakeOnLANWith(ctx, nil, WakeTarget{MAC: "aa-bb-cc-dd-ee-ff", Broadcast: "127.0.0.1", Port: port}.withDefaults())
+	sendWakeOnLANWith(ctx, nil, WakeTarget{MAC: "not-a-mac"}.withDefaults())
+
+	// 验证结果补充到同一来源的唤醒记录中
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	defer ln.Close()
+	verifyWake(ctx, VerifyConfig{Method: verifyTCP, Host: "127.0.0.1", Port: ln.Addr().(*net.TCPAddr).Port}, "AA:BB:CC:DD:EE:FF")
+
+	entries := l.All()
+	if len(entries) != 2 {
+		t.Fatalf("audit entries = %d, want 2", len(entries))
+	}
+	ok, failed := entries[0], entries[1]
+	if ok.Source != sourceAPI || ok.User != "admin" || ok.ClientIP != "192.0.2.10" || ok.MAC != "AA:BB:CC:DD:EE:FF" || !ok.Success || ok.Packets != 1 {
+		t.Errorf("entries[0] = %+v, want a successful wake by admin", ok)
+	}
+	if ok.Verify == nil || !ok.Verify.Online {
+		t.Errorf("entries[0].Verify = %+v, want online", ok.Verify)
+	}
+	if failed.Success || failed.MAC != "not-a-mac" || failed.Error == "" {
+		t.Errorf("entries[1] = %+v, want a failed attempt with the raw MAC", failed)
+	}
+}
+
+func TestHandleAPIAuditExport(t *testing.T) {
+	l := useTestAudit(t)
+	l.Append(AuditEntry{Source: sourceWeb, User: "admin", MAC: "AA:BB:CC:DD:EE:FF", Destination: "广播地址: 192.168.1.255, 端口: 9", Success: true, Packets: 1})
+	l.Append(AuditEntry{Source: sourceSchedule, MAC: "11:22:33:44:55:66", Error: "发送失败, \"quoted\""})
+	l.Append(AuditEntry{Source: sourceAPI, User: "@evil", Device: "=HYPERLINK(\"http://evil.example\")", MAC: "11:22:33:44:55:77"})
+
+	tests := []struct {
+		query      string
+		wantStatus int
+		wantType   string
+		wantBody   []string
+	}{
+		{
+			query:      "format=csv",
+			wantStatus: http.StatusOK,
+			wantType:   "text/csv",
+			wantBody:   []string{"id,time,source,user", ",web,admin,", `"发送失败, ""quoted"""`, `,'@evil,`, `"'=HYPERLINK(""http://evil.example"")"`},
+		},
+		{query: "", wantStatus: http.StatusOK, wantType: "application/json", wantBody: []string{`"source":"schedule"`}},
+		{query: "format=xml", wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			handleAPIAuditExport(rec, httptest.NewRequest(http.MethodGet, "/api/v1/audit/export?"+tt.query, nil))
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+			if !strings.HasPrefix(rec.Header().Get("Content-Type"), tt.wantType) {
+				t.Errorf("Content-Type = %s, want %s", rec.Header().Get("Content-Type"), tt.wantType)
+			}
+			for _, want := range tt.wantBody {
+				if !strings.Contains(rec.Body.String(), want) {
+					t.Errorf("body does not contain %q:\n%s", want, rec.Body.String())
+				}
+			}
+		})
+	}
+}
+
+func TestHandleHistory(t *testing.T) {
+	l := useTestAudit(t)
+	for i := 0; i < auditPageSize+1; i++ {
+		l.Append(AuditEntry{Source: sourceWeb, MAC: "AA:BB:CC:DD:EE:FF", Success: true, Packets: 1})
+	}
+	l.Append(AuditEntry{Source: sourceRelay, Device: "书房NAS", MAC: "11:22:33:44:55:66", Error: "目标不在允许范围内"})
+
+	rec := httptest.NewRecorder()
+	handleHistory(rec, httptest.NewRequest(http.MethodGet, "/history", nil))
+	body := rec.Body.String()
+	for _, want := range []string{"书房NAS", "目标不在允许范围内", "第 1 / 2 页", `href="/history?page=2"`} {
+		if !strings.Contains(body, want) {
+			t.Errorf("history page does not contain %q", want)
+		}
+	}
+
+	rec = httptest.NewRecorder()
+	handleHistory(rec, httptest.NewRequest(http.MethodGet, "/history?page=2", nil))
+	if body := rec.Body.String(); strings.Contains(body, "书房NAS") || !strings.Contains(body, `href="/history?page=1"`) {
+		t.Errorf("page 2 should only contain older entries and link back to page 1")
+	}
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// 登录会话的Cookie名称
+const sessionCookieName = "wol_session"
+
+// AuthConfig 认证配置，未配置任何用户和令牌时不启用认证
+type AuthConfig struct {
+	Users      []AuthUser  `json:"users" yaml:"users" toml:"users"`
+	Tokens     []AuthToken `json:"tokens" yaml:"tokens" toml:"tokens"`
+	SessionTTL Duration    `json:"session_ttl" yaml:"session_ttl" toml:"session_ttl"`
+}
+
+// AuthUser 使用用户名和bcrypt密码哈希登录的用户
+type AuthUser struct {
+	Name         string `json:"name" yaml:"name" toml:"name"`
+	PasswordHash string `json:"password_hash" yaml:"password_hash" toml:"password_hash"`
+}
+
+// AuthToken 供自动化脚本使用的静态Bearer令牌，Name 用于日志归属
+type AuthToken struct {
+	Name  string `json:"name" yaml:"name" toml:"name"`
+	Token string `json:"token" yaml:"token" toml:"token"`
+}
+
+// Enabled 是否启用认证
+func (c AuthConfig) Enabled() bool {
+	return len(c.Users) > 0 || len(c.Tokens) > 0
+}
+
+func (c AuthConfig) validate() error {
+	for _, u := range c.Users {
+		if u.Name == "" {
+			return fmt.Errorf("认证用户名不能为空")
+		}
+		if _, err := bcrypt.Cost([]byte(u.PasswordHash)); err != nil {
+			return fmt.Errorf("用户 %s 的密码哈希不是有效的bcrypt哈希: %v", u.Name, err)
+		}
+	}
+	for _, t := range c.Tokens {
+		if t.Name == "" || len(t.Token) < 16 {
+			return fmt.Errorf("API令牌需要名称且长度不少于16个字符")
+		}
+	}
+	return nil
+}
+
+// checkPassword 校验用户名和密码
+func (c AuthConfig) checkPassword(name, password string) bool {
+	for _, u := range c.Users {
+		if u.Name == name {
+			return bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(password)) == nil
+		}
+	}
+	return false
+}
+
+// checkToken 校验Bearer令牌，返回令牌名称
+func (c AuthConfig) checkToken(token string) (string, bool) {
+	for _, t := range c.Tokens {
+		if subtle.ConstantTimeCompare([]byte(t.Token), []byte(token)) == 1 {
+			return t.Name, true
+		}
+	}
+	return "", false
+}
+
+type userContextKey struct{}
+
+// requestUser 返回请求对应的用户名，未启用认证时为空
+func requestUser(r *http.Request) string {
+	user, _ := r.Context().Value(userContextKey{}).(string)
+	return user
+}
+
+// requestActor 返回用于日志的请求来源描述: 用户名@客户端地址
+func requestActor(r *http.Request) string {
+	if user := requestUser(r); user != "" {
+		return user + "@" + r.RemoteAddr
+	}
+	return r.RemoteAddr
+}
+
+// sessionStore 内存中的登录会话，服务重启后需要重新登录
+type sessionStore struct {
+	mu       sync.Mutex
+	sessions map[string]session
+}
+
+type session struct {
+	user    string
+	expires time.Time
+}
+
+var sessions = &sessionStore{sessions: make(map[string]session)}
+
+func (s *sessionStore) create(user string, ttl time.Duration) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	id := hex.EncodeToString(b)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// 顺便清理过期会话
+	now := time.Now()
+	for k, v := range s.sessions {
+		if now.After(v.expires) {
+			delete(s.sessions, k)
+		}
+	}
+	s.sessions[id] = session{user: user, expires: now.Add(ttl)}
+	return id, nil
+}
+
+func (s *sessionStore) lookup(id string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sess, ok := s.sessions[id]
+	if !ok || time.Now().After(sess.expires) {
+		return "", false
+	}
+	return sess.user, true
+}
+
+func (s *sessionStore) remove(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.sessions, id)
+}
+
+// authenticate 依次尝试Bearer令牌、HTTP Basic和会话Cookie
+func authenticate(auth AuthConfig, r *http.Request) (string, bool) {
+	header := r.Header.Get("Authorization")
+	if token, ok := strings.CutPrefix(header, "Bearer "); ok {
+		return auth.checkToken(strings.TrimSpace(token))
+	}
+	if name, password, ok := r.BasicAuth(); ok {
+		if auth.checkPassword(name, password) {
+			return name, true
+		}
+		return "", false
+	}
+	if cookie, err := r.Cookie(sessionCookieName); err == nil {
+		return sessions.lookup(cookie.Value)
+	}
+	return "", false
+}
+
+// requireAuth 认证中间件：API和指标请求返回401，页面请求跳转到登录页
+func requireAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !config.Auth.Enabled() || r.URL.Path == "/login" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		user, ok := authenticate(config.Auth, r)
+		if !ok {
+			if strings.HasPrefix(r.URL.Path, "/api/") || r.URL.Path == "/metrics" {
+				w.Header().Set("WWW-Authenticate", `Basic realm="wol-service"`)
+				writeJSON(w, http.StatusUnauthorized, apiWakeResponse{Error: "需要认证"})
+				return
+			}
+			http.Redirect(w, r, "/login?next="+url.QueryEscape(r.URL.RequestURI()), http.StatusSeeOther)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), userContextKey{}, user)))
+	})
+}
+
+// LoginData 登录页面数据
+type LoginData struct {
+	Message string
+	Next    string
+}
+
+// localPath 只允许跳转到本站路径，防止开放重定向，其他地址返回 /；
+// 浏览器把 // 和 /\ 开头的地址都当作协议相对地址，跳转到其他主机
+func localPath(next string) string {
+	u, err := url.Parse(next)
+	if err != nil || u.Scheme != "" || u.Host != "" || u.User != nil {
+		return "/"
+	}
+	for _, p := range []string{next, u.Path} {
+		if !strings.HasPrefix(p, "/") || strings.HasPrefix(p, "//") || strings.HasPrefix(p, "/\\") {
+			return "/"
+		}
+	}
+	return next
+}
+
+func handleLogin(w http.ResponseWriter, r *http.Request) {
+	next := localPath(r.FormValue("next"))
+
+	if r.Method != http.MethodPost {
+		loginTmpl.Execute(w, LoginData{Next: next})
+		return
+	}
+
+	name := r.FormValue("username")
+	if !config.Auth.checkPassword(name, r.FormValue("password")) {
+		log.Printf("用户 %s 从 %s 登录失败", name, r.RemoteAddr)
+		w.WriteHeader(http.StatusUnauthorized)
+		loginTmpl.Execute(w, LoginData{Message: "用户名或密码错误", Next: next})
+		return
+	}
+
+	ttl := time.Duration(config.Auth.SessionTTL)
+	id, err := sessions.create(name, ttl)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    id,
+		Path:     "/",
+		MaxAge:   int(ttl.Seconds()),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+		Secure:   r.TLS != nil,
+	})
+	log.Printf("用户 %s 从 %s 登录", name, r.RemoteAddr)
+	http.Redirect(w, r, next, http.StatusSeeOther)
+}
+
+func handleLogout(w http.ResponseWriter, r *http.Request) {
+	if cookie, err := r.Cookie(sessionCookieName); err == nil {
+		sessions.remove(cookie.Value)
+	}
+	http.SetCookie(w, &http.Cookie{Name: sessionCookieName, Value: "", Path: "/", MaxAge: -1})
+	http.Redirect(w, r, "/login", http.StatusSeeOther)
+}
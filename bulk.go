@@ -0,0 +1,230 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tdh62/wake_on_lan_proxy/wol"
+)
+
+// BulkOptions 批量唤醒的发送速率和并发数
+type BulkOptions struct {
+	Rate        int // 每秒发送的唤醒包数，0 表示不限制
+	Concurrency int // 同时进行的发送数
+}
+
+// bulkOptions 返回唤醒 targets 个目标使用的批量唤醒参数
+//
+// rate 和 concurrency 大于0时只能降低配置中的限制：配置是防止断路器跳闸的上限，
+// 请求不能超过它；并发数也不超过目标个数
+func bulkOptions(rate, concurrency, targets int) BulkOptions {
+	opts := BulkOptions{Rate: config.BulkRate, Concurrency: config.BulkConcurrency}
+	if rate > 0 && (opts.Rate == 0 || rate < opts.Rate) {
+		opts.Rate = rate
+	}
+	if concurrency > 0 {
+		opts.Concurrency = min(opts.Concurrency, concurrency)
+	}
+	opts.Concurrency = max(min(opts.Concurrency, targets), 1)
+	return opts
+}
+
+// BulkResult 批量唤醒中一个目标的结果
+type BulkResult struct {
+	Target  string    `json:"target"`           // 请求中的MAC地址或设备名称
+	MAC     string    `json:"mac,omitempty"`    // 实际唤醒的MAC地址
+	Device  string    `json:"device,omitempty"` // 已登记设备的名称
+	Success bool      `json:"success"`
+	Packets int       `json:"packets,omitempty"` // 实际发送的唤醒包个数
+	Error   string    `json:"error,omitempty"`
+	Time    time.Time `json:"time"` // 发送时间，因请求取消未发送时为空
+}
+
+// BulkReport 批量唤醒的结果报告，Results 与请求中的目标顺序一致
+type BulkReport struct {
+	Total     int          `json:"total"`
+	Succeeded int          `json:"succeeded"`
+	Failed    int          `json:"failed"`
+	Duration  Duration     `json:"duration"`
+	Results   []BulkResult `json:"results"`
+}
+
+// bulkTarget 批量唤醒的一个目标
+type bulkTarget struct {
+	ref    string
+	device string
+	target WakeTarget
+}
+
+// resolveBulkTargets 将MAC地址或设备名称/ID解析为唤醒目标
+//
+// 已登记的设备使用设备自己的发送参数，其他MAC地址使用 defaults 中的广播地址、端口和接口；
+// defaults 中设置了重复次数和间隔时对所有目标生效
+func resolveBulkTargets(refs []string, defaults WakeTarget) []bulkTarget {
+	targets := make([]bulkTarget, 0, len(refs))
+	for _, ref := range refs {
+		ref = strings.TrimSpace(ref)
+		if ref == "" {
+			continue
+		}
+		bt := bulkTarget{ref: ref}
+		if d, ok := registry.Find(ref); ok {
+			bt.device = d.Name
+			t := d.target()
+			if defaults.Repeat > 0 {
+				t.Repeat = defaults.Repeat
+			}
+			if defaults.RepeatInterval > 0 {
+				t.RepeatInterval = defaults.RepeatInterval
+			}
+			bt.target = t.withDefaults()
+		} else {
+			t := defaults
+			t.MAC = ref
+			bt.target = t.withDefaults()
+		}
+		targets = append(targets, bt)
+	}
+	return targets
+}
+
+// packetLimiter 限制唤醒包的发送速率，多个发送共享同一个限制；第一个包立即发送
+type packetLimiter struct {
+	interval time.Duration
+
+	mu   sync.Mutex
+	next time.Time // 下一个包最早的发送时间
+}
+
+func newPacketLimiter(rate int) *packetLimiter {
+	return &packetLimiter{interval: time.Second / time.Duration(rate)}
+}
+
+// Wait 预约下一个发送时间并等待到该时间，ctx 被取消时返回其错误
+func (l *packetLimiter) Wait(ctx context.Context) error {
+	l.mu.Lock()
+	now := time.Now()
+	at := l.next
+	if at.Before(now) {
+		at = now
+	}
+	l.next = at.Add(l.interval)
+	l.mu.Unlock()
+
+	if wait := at.Sub(now); wait > 0 {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+	return ctx.Err()
+}
+
+// limitedTransport 每发送一个包前先等待速率限制
+type limitedTransport struct {
+	wol.Transport
+	limiter *packetLimiter
+}
+
+func (t limitedTransport) Send(ctx context.Context, dst wol.Destination, packet []byte) (int, error) {
+	if err := t.limiter.Wait(ctx); err != nil {
+		return 0, err
+	}
+	return t.Transport.Send(ctx, dst, packet)
+}
+
+type packetLimiterKey struct{}
+
+// withPacketLimiter 返回携带速率限制的 context，sendWakeOnLANWith 发送的每个包（包括重复发送）都受其限制
+func withPacketLimiter(ctx context.Context, l *packetLimiter) context.Context {
+	return context.WithValue(ctx, packetLimiterKey{}, l)
+}
+
+// packetLimiterOf 返回 ctx 中的速率限制，没有时为空
+func packetLimiterOf(ctx context.Context) *packetLimiter {
+	l, _ := ctx.Value(packetLimiterKey{}).(*packetLimiter)
+	return l
+}
+
+// wakeBulk 批量发送唤醒包
+//
+// 最多 opts.Concurrency 个发送同时进行，所有唤醒包（包括每个目标的重复发送）共享速率限制，
+// 每秒最多发送 opts.Rate 个，避免几百台设备同时上电导致断路器跳闸
+func wakeBulk(ctx context.Context, targets []bulkTarget, opts BulkOptions) BulkReport {
+	start := time.Now()
+	report := BulkReport{Total: len(targets), Results: make([]BulkResult, len(targets))}
+
+	// 同一出口的唤醒包共用一个套接字，避免每个MAC都创建和关闭一次
+	udp := newUDPTransport()
+	defer udp.Close()
+
+	if opts.Rate > 0 {
+		ctx = withPacketLimiter(ctx, newPacketLimiter(opts.Rate))
+	}
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < max(min(opts.Concurrency, len(targets)), 1); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				bt := targets[i]
+				result := BulkResult{Target: bt.ref, Device: bt.device}
+				if mac, err := wol.ParseMAC(bt.target.MAC); err == nil {
+					result.MAC = wol.FormatMAC(mac)
+				}
+				result.Time = time.Now()
+				packets, err := sendWakeOnLANWith(ctx, udp, bt.target)
+				if err != nil {
+					result.Error = err.Error()
+				} else {
+					result.Success = true
+					result.Packets = packets
+				}
+				report.Results[i] = result
+			}
+		}()
+	}
+
+	for i := range targets {
+		if ctx.Err() != nil {
+			report.Results[i] = BulkResult{Target: targets[i].ref, Device: targets[i].device, Error: ctx.Err().Error()}
+			continue
+		}
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	for _, r := range report.Results {
+		if r.Success {
+			report.Succeeded++
+		} else {
+			report.Failed++
+		}
+	}
+	report.Duration = Duration(time.Since(start).Round(time.Millisecond))
+	return report
+}
+
+// timeout 估计按速率限制唤醒所有目标需要的时间，用于延长HTTP写入超时
+func (o BulkOptions) timeout(targets []bulkTarget) time.Duration {
+	d := time.Duration(config.SendTimeout)
+	var packets int
+	var repeat time.Duration
+	for _, bt := range targets {
+		packets += max(bt.target.Repeat, 1)
+		repeat = max(repeat, bt.target.repeatDuration())
+	}
+	if o.Rate > 0 {
+		d += time.Duration(packets) * time.Second / time.Duration(o.Rate)
+	}
+	// 最后开始的目标还需要完成重复发送
+	return d + repeat
+}
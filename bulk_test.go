@@ -0,0 +1,242 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// listenTestUDP 在本地回环地址上接收唤醒包
+func listenTestUDP(t *testing.T) *net.UDPConn {
+	t.Helper()
+
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("ListenUDP() error = %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// receivePackets 接收 n 个数据包，返回各自的来源地址
+func receivePackets(t *testing.T, conn *net.UDPConn, n int) []*net.UDPAddr {
+	t.Helper()
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	buf := make([]byte, 1024)
+	var from []*net.UDPAddr
+	for len(from) < n {
+		_, addr, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			t.Fatalf("received %d packets, want %d: %v", len(from), n, err)
+		}
+		from = append(from, addr)
+	}
+	return from
+}
+
+func TestWakeBulk(t *testing.T) {
+	reg := useTestRegistry(t)
+	conn := listenTestUDP(t)
+	port := conn.LocalAddr().(*net.UDPAddr).Port
+
+	addTestDevices(t, reg, Device{Name: "pc-01", MAC: "11:11:11:11:11:11", Broadcast: "127.0.0.1", Port: port})
+	targets := resolveBulkTargets(
+		[]string{"pc-01", "22-22-22-22-22-22", " ", "not-a-mac"},
+		WakeTarget{Broadcast: "127.0.0.1", Port: port},
+	)
+
+	start := time.Now()
+	report := wakeBulk(context.Background(), targets, BulkOptions{Rate: 20, Concurrency: 2})
+
+	// 2个有效目标的唤醒包按每秒20个发送，至少间隔 50ms
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("wakeBulk() took %v, want pacing of at least 50ms", elapsed)
+	}
+	if report.Total != 3 || report.Succeeded != 2 || report.Failed != 1 {
+		t.Fatalf("report = %+v, want 2 of 3 succeeded", report)
+	}
+	want := []BulkResult{
+		{Target: "pc-01", MAC: "11:11:11:11:11:11", Device: "pc-01", Success: true},
+		{Target: "22-22-22-22-22-22", MAC: "22:22:22:22:22:22", Success: true},
+		{Target: "not-a-mac"},
+	}
+	for i, w := range want {
+		got := report.Results[i]
+		if got.Target != w.Target || got.MAC != w.MAC || got.Device != w.Device || got.Success != w.Success {
+			t.Errorf("Results[%d] = %+v, want %+v", i, got, w)
+		}
+	}
+	if report.Results[2].Error == "" {
+		t.Errorf("invalid MAC result has no error")
+	}
+
+	from := receivePackets(t, conn, 2)
+	if from[0].Port != from[1].Port {
+		t.Errorf("packets sent from ports %d and %d, want a single reused socket", from[0].Port, from[1].Port)
+	}
+}
+
+func TestWakeBulkRateCountsRepeats(t *testing.T) {
+	useTestRegistry(t)
+	conn := listenTestUDP(t)
+	port := conn.LocalAddr().(*net.UDPAddr).Port
+
+	// 重复发送不设间隔，速率限制必须按包而不是按目标计算
+	targets := resolveBulkTargets(
+		[]string{"11:11:11:11:11:11", "22:22:22:22:22:22"},
+		WakeTarget{Broadcast: "127.0.0.1", Port: port, Repeat: 3, RepeatInterval: Duration(time.Nanosecond)},
+	)
+	opts := BulkOptions{Rate: 20, Concurrency: 2}
+
+	start := time.Now()
+	report := wakeBulk(context.Background(), targets, opts)
+
+	// 6个包按每秒20个发送，至少间隔五个 50ms
+	if elapsed := time.Since(start); elapsed < 250*time.Millisecond {
+		t.Errorf("wakeBulk() took %v, want pacing of at least 250ms", elapsed)
+	}
+	if report.Succeeded != 2 || report.Results[0].Packets != 3 || report.Results[1].Packets != 3 {
+		t.Errorf("report = %+v, want 3 packets for each target", report)
+	}
+	receivePackets(t, conn, 6)
+
+	if got, want := opts.timeout(targets), time.Duration(config.SendTimeout)+300*time.Millisecond; got < want {
+		t.Errorf("timeout() = %v, want at least %v", got, want)
+	}
+}
+
+func TestPacketLimiter(t *testing.T) {
+	l := newPacketLimiter(100)
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if err := l.Wait(context.Background()); err != nil {
+			t.Fatalf("Wait() error = %v", err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 20*time.Millisecond {
+		t.Errorf("3 packets at 100/s took %v, want at least 20ms", elapsed)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	l = newPacketLimiter(1)
+	l.Wait(context.Background())
+	if err := l.Wait(ctx); err != context.Canceled {
+		t.Errorf("Wait() canceled error = %v", err)
+	}
+}
+
+func TestWakeBulkCanceled(t *testing.T) {
+	useTestRegistry(t)
+	conn := listenTestUDP(t)
+	port := conn.LocalAddr().(*net.UDPAddr).Port
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	targets := resolveBulkTargets([]string{"11:11:11:11:11:11", "22:22:22:22:22:22"}, WakeTarget{Broadcast: "127.0.0.1", Port: port})
+	report := wakeBulk(ctx, targets, BulkOptions{Rate: 1, Concurrency: 1})
+
+	if report.Failed != 2 || report.Results[1].Error != context.Canceled.Error() {
+		t.Errorf("report = %+v, want the remaining targets canceled", report)
+	}
+}
+
+func TestBulkOptions(t *testing.T) {
+	old := config
+	config.BulkRate, config.BulkConcurrency = 20, 8
+	t.Cleanup(func() { config = old })
+
+	tests := []struct {
+		name                       string
+		rate, concurrency, targets int
+		want                       BulkOptions
+	}{
+		{name: "Config", targets: 100, want: BulkOptions{Rate: 20, Concurrency: 8}},
+		{name: "Lower limits", rate: 5, concurrency: 2, targets: 100, want: BulkOptions{Rate: 5, Concurrency: 2}},
+		{name: "Oversized limits clamped", rate: 1000000, concurrency: 1000000, targets: 100, want: BulkOptions{Rate: 20, Concurrency: 8}},
+		{name: "Concurrency capped by targets", concurrency: 1000000, targets: 3, want: BulkOptions{Rate: 20, Concurrency: 3}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := bulkOptions(tt.rate, tt.concurrency, tt.targets); got != tt.want {
+				t.Errorf("bulkOptions(%d, %d, %d) = %+v, want %+v", tt.rate, tt.concurrency, tt.targets, got, tt.want)
+			}
+		})
+	}
+
+	// 配置不限速时请求可以设置速率
+	config.BulkRate = 0
+	if got := bulkOptions(50, 0, 10); got.Rate != 50 {
+		t.Errorf("bulkOptions() with unlimited config rate = %+v, want rate 50", got)
+	}
+}
+
+func TestHandleAPIBulkWakeClampsLimits(t *testing.T) {
+	useTestRegistry(t)
+	conn := listenTestUDP(t)
+	port := conn.LocalAddr().(*net.UDPAddr).Port
+
+	old := config
+	config.BulkRate, config.BulkConcurrency = 20, 8
+	t.Cleanup(func() { config = old })
+
+	body := `{"targets": ["11:11:11:11:11:11", "22:22:22:22:22:22", "33:33:33:33:33:33"], "broadcast": "127.0.0.1", "port": ` +
+		strconv.Itoa(port) + `, "repeat": 1, "rate": 1000000, "concurrency": 1000000}`
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/wake/bulk", strings.NewReader(body))
+	rec := httptest.NewRecorder()
+
+	start := time.Now()
+	handleAPIBulkWake(rec, req)
+
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"succeeded":3`) {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body)
+	}
+	// 请求中的速率不能超过配置的每秒20个，3个包至少间隔两个 50ms
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Errorf("bulk wake took %v, want the configured rate of 20/s", elapsed)
+	}
+	receivePackets(t, conn, 3)
+}
+
+func TestHandleAPIBulkWake(t *testing.T) {
+	useTestRegistry(t)
+	conn := listenTestUDP(t)
+	port := conn.LocalAddr().(*net.UDPAddr).Port
+
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantBody   string
+	}{
+		{name: "No targets", body: `{"targets": []}`, wantStatus: http.StatusBadRequest},
+		{name: "Negative rate", body: `{"targets": ["11:11:11:11:11:11"], "rate": -1}`, wantStatus: http.StatusBadRequest},
+		{
+			name:       "Report",
+			body:       `{"targets": ["11:11:11:11:11:11", "bad"], "broadcast": "127.0.0.1", "port": ` + strconv.Itoa(port) + `, "rate": 100}`,
+			wantStatus: http.StatusOK,
+			wantBody:   `"succeeded":1,"failed":1`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/wake/bulk", strings.NewReader(tt.body))
+			rec := httptest.NewRecorder()
+			handleAPIBulkWake(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+			if !strings.Contains(rec.Body.String(), tt.wantBody) {
+				t.Errorf("body = %s, want %s", rec.Body.String(), tt.wantBody)
+			}
+		})
+	}
+}
@@ -0,0 +1,392 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/tdh62/wake_on_lan_proxy/wol"
+)
+
+// 命令行子命令的退出码
+const (
+	exitOK        = 0 // 成功
+	exitFailure   = 1 // 发送失败或部分目标失败
+	exitUsage     = 2 // 参数错误或输入无效
+	exitNotFound  = 3 // 设备不存在
+	exitForbidden = 4 // 目标不符合发送策略
+)
+
+const commandUsage = `用法: wol-service [命令] [参数]
+
+命令:
+  serve     启动Web服务（未指定命令时的默认行为）
+  wake      发送唤醒包: wol-service wake <MAC地址|设备名称> [--bcast 地址] [--port 端口] [--iface 接口]
+  bulk      批量唤醒: wol-service bulk [--file 列表文件] [MAC地址或设备...]
+  devices   管理登记的设备: wol-service devices list|add|rm
+  help      显示本帮助
+
+所有命令都支持服务的配置参数（如 -config、-data-file），使用 wol-service <命令> -h 查看。
+退出码: 0 成功, 1 发送失败, 2 参数错误, 3 设备不存在, 4 不符合发送策略
+`
+
+// runCommand 执行 serve 以外的子命令，返回进程退出码
+func runCommand(cmd string, args []string, stdin io.Reader, stdout io.Writer) int {
+	switch cmd {
+	case "wake":
+		return runWakeCommand(args, stdout)
+	case "bulk":
+		return runBulkCommand(args, stdin, stdout)
+	case "devices":
+		return runDevicesCommand(args, stdout)
+	case "help", "-h", "--help":
+		fmt.Fprint(stdout, commandUsage)
+		return exitOK
+	default:
+		fmt.Fprintf(os.Stderr, "未知的命令: %s\n\n%s", cmd, commandUsage)
+		return exitUsage
+	}
+}
+
+// newCommandFlags 创建子命令的参数集，usage 为参数说明，如 "[参数] <MAC地址>"
+func newCommandFlags(name, usage string) *flag.FlagSet {
+	fs := flag.NewFlagSet("wol-service "+name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "用法: wol-service %s %s\n\n参数:\n", name, usage)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// setupCommand 应用子命令加载的配置并打开设备登记表，ok 为 false 时子命令应以 code 退出
+func setupCommand(cfg Config, err error) (code int, ok bool) {
+	if errors.Is(err, flag.ErrHelp) {
+		return exitOK, false
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage, false
+	}
+	config = cfg
+
+	registry, err = openDeviceRegistry(config.DataFile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitFailure, false
+	}
+	return exitOK, true
+}
+
+// wakeExitCode 将唤醒错误映射为退出码，与API的状态码对应
+func wakeExitCode(err error) int {
+	switch wakeErrorStatus(err) {
+	case http.StatusBadRequest:
+		return exitUsage
+	case http.StatusForbidden:
+		return exitForbidden
+	case http.StatusNotFound:
+		return exitNotFound
+	default:
+		return exitFailure
+	}
+}
+
+// runWakeCommand 实现 wake 子命令：
+//
+//	wol-service wake <MAC地址|设备名称> [--bcast 地址] [--port 端口] [--iface 接口]
+//
+// 已登记的设备使用设备自己的设置，命令行参数优先于设备的设置
+func runWakeCommand(args []string, stdout io.Writer) int {
+	fs := newCommandFlags("wake", "[参数] <MAC地址|设备名称>")
+	bcast := fs.String("bcast", "", "广播地址，如 192.168.1.255 或 ff02::1%eth0")
+	port := fs.Int("port", 0, "UDP唤醒端口")
+	iface := fs.String("iface", "", "发送使用的网络接口，以太网方式必填")
+	source := fs.String("source", "", "UDP方式绑定的源地址")
+	password := fs.String("password", "", "SecureOn密码")
+	transport := fs.String("transport", "", "发送方式: udp 或 ethernet")
+	all := fs.Bool("all", false, "在所有接口的定向广播地址上发送")
+	cfg, refs, err := loadConfigFlags(fs, args)
+	if code, ok := setupCommand(cfg, err); !ok {
+		return code
+	}
+	if len(refs) != 1 {
+		fmt.Fprintln(os.Stderr, "需要指定一个MAC地址或设备名称")
+		fs.Usage()
+		return exitUsage
+	}
+
+	target := WakeTarget{MAC: refs[0]}
+	if d, ok := registry.Find(refs[0]); ok {
+		target = d.target()
+	} else if _, err := wol.ParseMAC(refs[0]); err != nil {
+		// 看起来是MAC地址但格式不对时属于输入无效，否则按设备名称处理
+		if looksLikeMAC(refs[0]) {
+			fmt.Fprintf(os.Stderr, "%v\n", wrapWOLError(err))
+			return exitUsage
+		}
+		fmt.Fprintf(os.Stderr, "%v，也不是有效的MAC地址: %s\n", errDeviceNotFound, refs[0])
+		return exitNotFound
+	}
+
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "bcast":
+			target.Broadcast = *bcast
+		case "port":
+			target.Port = *port
+		case "iface":
+			target.Interface = *iface
+		case "source":
+			target.SourceIP = *source
+		case "password":
+			target.Password = *password
+		case "transport":
+			target.Transport = *transport
+		case "all":
+			target.AllInterfaces = *all
+		}
+	})
+	target = target.withDefaults()
+	if target.Port < 1 || target.Port > 65535 {
+		fmt.Fprintf(os.Stderr, "端口超出范围: %d\n", target.Port)
+		return exitUsage
+	}
+
+	packets, err := sendWakeOnLANWith(context.Background(), nil, target)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "发送失败: %v\n", err)
+		return wakeExitCode(err)
+	}
+	fmt.Fprintf(stdout, "唤醒包已发送到 %s (%s, 共 %d 个)\n", target.MAC, target.destination(), packets)
+	return exitOK
+}
+
+// looksLikeMAC 判断参数是否像MAC地址：只包含十六进制数字和 : - . 分隔符，且带分隔符或长度达到12位
+func looksLikeMAC(s string) bool {
+	if s == "" {
+		return false
+	}
+	separators := 0
+	for _, c := range s {
+		switch {
+		case c == ':' || c == '-' || c == '.':
+			separators++
+		case ('0' <= c && c <= '9') || ('a' <= c && c <= 'f') || ('A' <= c && c <= 'F'):
+		default:
+			return false
+		}
+	}
+	return separators > 0 || len(s) >= 12
+}
+
+// runDevicesCommand 实现 devices 子命令：list、add 和 rm
+func runDevicesCommand(args []string, stdout io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "用法: wol-service devices list|add|rm [参数]")
+		return exitUsage
+	}
+
+	switch sub, args := args[0], args[1:]; sub {
+	case "list", "ls":
+		return runDevicesList(args, stdout)
+	case "add":
+		return runDevicesAdd(args, stdout)
+	case "rm", "remove":
+		return runDevicesRemove(args, stdout)
+	default:
+		fmt.Fprintf(os.Stderr, "未知的命令: devices %s\n用法: wol-service devices list|add|rm [参数]\n", sub)
+		return exitUsage
+	}
+}
+
+func runDevicesList(args []string, stdout io.Writer) int {
+	fs := newCommandFlags("devices list", "[参数]")
+	asJSON := fs.Bool("json", false, "以JSON格式输出")
+	cfg, rest, err := loadConfigFlags(fs, args)
+	if code, ok := setupCommand(cfg, err); !ok {
+		return code
+	}
+	if len(rest) > 0 {
+		fmt.Fprintf(os.Stderr, "多余的参数: %s\n", strings.Join(rest, " "))
+		return exitUsage
+	}
+
+	devices := registry.List()
+	if *asJSON {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(devices)
+		return exitOK
+	}
+
+	tw := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\t名称\tMAC\t目标\t备注")
+	for _, d := range devices {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", d.ID, d.Name, d.MAC, d.target().withDefaults().destination(), d.Notes)
+	}
+	tw.Flush()
+	return exitOK
+}
+
+func runDevicesAdd(args []string, stdout io.Writer) int {
+	fs := newCommandFlags("devices add", "[参数] <名称> <MAC地址>")
+	bcast := fs.String("bcast", "", "广播地址，为空时使用默认广播地址")
+	port := fs.Int("port", 0, "UDP唤醒端口，为0时使用默认端口")
+	iface := fs.String("iface", "", "发送使用的网络接口")
+	source := fs.String("source", "", "UDP方式绑定的源地址")
+	password := fs.String("password", "", "SecureOn密码")
+	transport := fs.String("transport", "", "发送方式: udp 或 ethernet")
+	all := fs.Bool("all", false, "在所有接口的定向广播地址上发送")
+	notes := fs.String("notes", "", "备注")
+	cfg, rest, err := loadConfigFlags(fs, args)
+	if code, ok := setupCommand(cfg, err); !ok {
+		return code
+	}
+	if len(rest) != 2 {
+		fmt.Fprintln(os.Stderr, "需要指定设备名称和MAC地址")
+		fs.Usage()
+		return exitUsage
+	}
+
+	device, err := registry.Add(Device{
+		Name:      rest[0],
+		MAC:       rest[1],
+		Broadcast: *bcast,
+		Port:      *port,
+		Password:  *password,
+		Transport: *transport,
+		Interface: *iface,
+		SourceIP:  *source,
+		Notes:     *notes,
+
+		AllInterfaces: *all,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "保存失败: %v\n", err)
+		return exitUsage
+	}
+	fmt.Fprintf(stdout, "设备 %s 已保存 (ID: %s, MAC: %s)\n", device.Name, device.ID, device.MAC)
+	return exitOK
+}
+
+func runDevicesRemove(args []string, stdout io.Writer) int {
+	fs := newCommandFlags("devices rm", "[参数] <ID|名称|MAC地址>")
+	cfg, rest, err := loadConfigFlags(fs, args)
+	if code, ok := setupCommand(cfg, err); !ok {
+		return code
+	}
+	if len(rest) != 1 {
+		fmt.Fprintln(os.Stderr, "需要指定一台设备")
+		fs.Usage()
+		return exitUsage
+	}
+
+	device, ok := registry.Find(rest[0])
+	if !ok {
+		fmt.Fprintf(os.Stderr, "%v: %s\n", errDeviceNotFound, rest[0])
+		return exitNotFound
+	}
+	if err := registry.Remove(device.ID); err != nil {
+		fmt.Fprintf(os.Stderr, "删除失败: %v\n", err)
+		return exitFailure
+	}
+	fmt.Fprintf(stdout, "设备 %s 已删除\n", device.Name)
+	return exitOK
+}
+
+// runBulkCommand 实现 bulk 子命令：
+//
+//	wol-service bulk [参数] [MAC地址或设备...]
+//
+// 目标可以在命令行中列出，也可以通过 -file 从文件读取。全部成功时返回 exitOK，
+// 有目标失败时返回 exitFailure
+func runBulkCommand(args []string, stdin io.Reader, stdout io.Writer) int {
+	fs := newCommandFlags("bulk", "[参数] [MAC地址或设备...]")
+	file := fs.String("file", "", "从文件读取目标，每行一个MAC地址或设备名称，- 表示标准输入")
+	bcast := fs.String("bcast", "", "未登记的MAC地址使用的广播地址，为空时使用默认广播地址")
+	port := fs.Int("port", 0, "未登记的MAC地址使用的UDP端口，为0时使用默认端口")
+	iface := fs.String("iface", "", "未登记的MAC地址使用的网络接口")
+	asJSON := fs.Bool("json", false, "以JSON格式输出结果")
+	cfg, refs, err := loadConfigFlags(fs, args)
+	if code, ok := setupCommand(cfg, err); !ok {
+		return code
+	}
+
+	if *file != "" {
+		lines, err := readTargetList(*file, stdin)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitUsage
+		}
+		refs = append(refs, lines...)
+	}
+	targets := resolveBulkTargets(refs, WakeTarget{Broadcast: *bcast, Port: *port, Interface: *iface})
+	if len(targets) == 0 {
+		fmt.Fprintln(os.Stderr, "没有需要唤醒的目标")
+		return exitUsage
+	}
+
+	// Ctrl+C 时停止发送剩余的目标，已发送的结果照常输出
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	report := wakeBulk(ctx, targets, bulkOptions(0, 0, len(targets)))
+
+	if *asJSON {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(report)
+	} else {
+		tw := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "目标\tMAC\t设备\t结果")
+		for _, r := range report.Results {
+			status := "已发送"
+			if !r.Success {
+				status = "失败: " + r.Error
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", r.Target, r.MAC, r.Device, status)
+		}
+		tw.Flush()
+		fmt.Fprintf(stdout, "共 %d 个目标, 成功 %d, 失败 %d, 用时 %s\n", report.Total, report.Succeeded, report.Failed, report.Duration)
+	}
+
+	if report.Failed > 0 {
+		return exitFailure
+	}
+	return exitOK
+}
+
+// readTargetList 读取目标列表文件，忽略空行和 # 开头的注释
+func readTargetList(path string, stdin io.Reader) ([]string, error) {
+	r := stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("无法读取目标列表: %v", err)
+		}
+		defer f.Close()
+		r = f
+	}
+
+	var refs []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		refs = append(refs, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("无法读取目标列表: %v", err)
+	}
+	return refs, nil
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"flag"
+	"net"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// useCommandGlobals 子命令会替换全局的配置和设备登记表，测试结束后恢复
+func useCommandGlobals(t *testing.T) {
+	t.Helper()
+
+	oldConfig, oldRegistry := config, registry
+	t.Cleanup(func() { config, registry = oldConfig, oldRegistry })
+}
+
+func TestParseFlags(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	port := fs.Int("port", 0, "")
+	all := fs.Bool("all", false, "")
+
+	rest, err := parseFlags(fs, []string{"pc-01", "--port", "7", "pc-02", "-all", "--", "-not-a-flag"})
+	if err != nil {
+		t.Fatalf("parseFlags() error = %v", err)
+	}
+	if strings.Join(rest, " ") != "pc-01 pc-02 -not-a-flag" || *port != 7 || !*all {
+		t.Errorf("parseFlags() = %q, port = %d, all = %v", rest, *port, *all)
+	}
+}
+
+func TestRunWakeCommand(t *testing.T) {
+	useCommandGlobals(t)
+	conn := listenTestUDP(t)
+	port := strconv.Itoa(conn.LocalAddr().(*net.UDPAddr).Port)
+	dataFile := filepath.Join(t.TempDir(), "devices.json")
+
+	var out strings.Builder
+	if code := runCommand("devices", []string{"add", "--data-file", dataFile, "--bcast", "127.0.0.1", "--port", port, "nas", "11:22:33:44:55:66"}, nil, &out); code != exitOK {
+		t.Fatalf("devices add = %d, want %d", code, exitOK)
+	}
+
+	tests := []struct {
+		name     string
+		args     []string
+		wantCode int
+	}{
+		{name: "Device name", args: []string{"NAS"}, wantCode: exitOK},
+		{name: "MAC with flags after it", args: []string{"AA-BB-CC-DD-EE-FF", "--bcast", "127.0.0.1", "--port", port}, wantCode: exitOK},
+		{name: "Unknown device", args: []string{"printer"}, wantCode: exitNotFound},
+		{name: "Malformed MAC", args: []string{"11:22:33:44:55"}, wantCode: exitUsage},
+		{name: "Missing target", args: nil, wantCode: exitUsage},
+		{name: "Port out of range", args: []string{"nas", "--port", "70000"}, wantCode: exitUsage},
+		{name: "Not allowed", args: []string{"nas", "--target-allowlist", "10.0.0.0/8"}, wantCode: exitForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := append([]string{"--data-file", dataFile}, tt.args...)
+			if code := runCommand("wake", args, nil, &out); code != tt.wantCode {
+				t.Errorf("wake %v = %d, want %d", tt.args, code, tt.wantCode)
+			}
+		})
+	}
+	receivePackets(t, conn, 2)
+}
+
+func TestRunDevicesCommand(t *testing.T) {
+	useCommandGlobals(t)
+	dataFile := filepath.Join(t.TempDir(), "devices.json")
+
+	run := func(args ...string) (int, string) {
+		var out strings.Builder
+		code := runCommand("devices", append(args, "--data-file", dataFile), nil, &out)
+		return code, out.String()
+	}
+
+	if code, _ := run("add", "nas", "11:22:33:44:55:66", "--notes", "storage"); code != exitOK {
+		t.Fatalf("devices add = %d", code)
+	}
+	if code, _ := run("add", "bad", "GG:HH:II:JJ:KK:LL"); code != exitUsage {
+		t.Errorf("devices add with an invalid MAC = %d, want %d", code, exitUsage)
+	}
+
+	code, out := run("list")
+	if code != exitOK || !strings.Contains(out, "11:22:33:44:55:66") || !strings.Contains(out, "storage") {
+		t.Errorf("devices list = %d:\n%s", code, out)
+	}
+
+	if code, _ := run("rm", "11-22-33-44-55-66"); code != exitOK {
+		t.Errorf("devices rm = %d, want %d", code, exitOK)
+	}
+	if code, _ := run("rm", "nas"); code != exitNotFound {
+		t.Errorf("devices rm twice = %d, want %d", code, exitNotFound)
+	}
+	if code, _ := run("rename"); code != exitUsage {
+		t.Errorf("unknown devices subcommand = %d, want %d", code, exitUsage)
+	}
+}
+
+func TestRunBulkCommand(t *testing.T) {
+	useCommandGlobals(t)
+
+	conn := listenTestUDP(t)
+	port := conn.LocalAddr().(*net.UDPAddr).Port
+
+	args := []string{
+		"-data-file", filepath.Join(t.TempDir(), "devices.json"),
+		"-bcast", "127.0.0.1",
+		"-port", strconv.Itoa(port),
+		"-bulk-rate", "0",
+		"-file", "-",
+		"33:33:33:33:33:33",
+	}
+	stdin := strings.NewReader("# 教室A\n11:11:11:11:11:11\n\n22:22:22:22:22:22\n")
+	var out strings.Builder
+	if code := runBulkCommand(args, stdin, &out); code != exitOK {
+		t.Fatalf("runBulkCommand() = %d, want 0:\n%s", code, out.String())
+	}
+	if !strings.Contains(out.String(), "共 3 个目标, 成功 3, 失败 0") {
+		t.Errorf("output does not contain the summary:\n%s", out.String())
+	}
+	receivePackets(t, conn, 3)
+
+	out.Reset()
+	if code := runBulkCommand(append(args[:len(args)-3], "bad"), nil, &out); code != exitFailure {
+		t.Errorf("runBulkCommand() with an invalid MAC = %d, want 1", code)
+	}
+	if code := runBulkCommand([]string{"-data-file", args[1]}, nil, &out); code != exitUsage {
+		t.Errorf("runBulkCommand() without targets = %d, want 2", code)
+	}
+}
+
+func TestLooksLikeMAC(t *testing.T) {
+	for s, want := range map[string]bool{
+		"11:22:33:44:55":       true,
+		"11-22-33-44-55-66-77": true,
+		"1122.3344.55":         true,
+		"aabbccddeeff00":       true,
+		"printer":              false,
+		"cafe":                 false,
+		"nas-01":               false,
+		"":                     false,
+	} {
+		if got := looksLikeMAC(s); got != want {
+			t.Errorf("looksLikeMAC(%q) = %v, want %v", s, got, want)
+		}
+	}
+}
@@ -0,0 +1,530 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+
+	"github.com/tdh62/wake_on_lan_proxy/wol"
+)
+
+// Config 服务配置
+//
+// 优先级从高到低: 命令行参数 > WOL_* 环境变量 > 配置文件 > 默认值
+type Config struct {
+	Listen           string   `json:"listen" yaml:"listen" toml:"listen"`
+	DataFile         string   `json:"data_file" yaml:"data_file" toml:"data_file"`
+	DefaultBroadcast string   `json:"default_broadcast" yaml:"default_broadcast" toml:"default_broadcast"`
+	DefaultPort      int      `json:"default_port" yaml:"default_port" toml:"default_port"`
+	ReadTimeout      Duration `json:"read_timeout" yaml:"read_timeout" toml:"read_timeout"`
+	WriteTimeout     Duration `json:"write_timeout" yaml:"write_timeout" toml:"write_timeout"`
+	IdleTimeout      Duration `json:"idle_timeout" yaml:"idle_timeout" toml:"idle_timeout"`
+	SendTimeout      Duration `json:"send_timeout" yaml:"send_timeout" toml:"send_timeout"`
+	VerifyTimeout    Duration `json:"verify_timeout" yaml:"verify_timeout" toml:"verify_timeout"`
+	VerifyInterval   Duration `json:"verify_interval" yaml:"verify_interval" toml:"verify_interval"`
+	Repeat           int      `json:"repeat" yaml:"repeat" toml:"repeat"`                            // 每次唤醒发送的唤醒包个数
+	RepeatInterval   Duration `json:"repeat_interval" yaml:"repeat_interval" toml:"repeat_interval"` // 重复发送的间隔
+
+	// 中继模式：接收来自广域网的魔术包并在局域网重新广播
+	RelayListen         string   `json:"relay_listen" yaml:"relay_listen" toml:"relay_listen"`
+	RelayInterfaces     []string `json:"relay_interfaces" yaml:"relay_interfaces" toml:"relay_interfaces"`
+	RelayPort           int      `json:"relay_port" yaml:"relay_port" toml:"relay_port"`
+	RelayAllowlist      []string `json:"relay_allowlist" yaml:"relay_allowlist" toml:"relay_allowlist"`
+	RelayRegisteredOnly bool     `json:"relay_registered_only" yaml:"relay_registered_only" toml:"relay_registered_only"`
+
+	// 发送策略：限制唤醒包的目的地址和可唤醒的设备
+	TargetAllowlist      []string `json:"target_allowlist" yaml:"target_allowlist" toml:"target_allowlist"`
+	TargetRegisteredOnly bool     `json:"target_registered_only" yaml:"target_registered_only" toml:"target_registered_only"`
+
+	// 按需唤醒代理：代理列表只能在配置文件中设置
+	TCPProxies   []TCPProxyConfig  `json:"tcp_proxies" yaml:"tcp_proxies" toml:"tcp_proxies"`
+	HTTPProxies  []HTTPProxyConfig `json:"http_proxies" yaml:"http_proxies" toml:"http_proxies"`
+	ProxyMaxWait Duration          `json:"proxy_max_wait" yaml:"proxy_max_wait" toml:"proxy_max_wait"`
+
+	// webhook：唤醒和上线验证后通知外部系统，只能在配置文件中设置
+	Webhooks []WebhookConfig `json:"webhooks" yaml:"webhooks" toml:"webhooks"`
+
+	// 批量唤醒：限制发送速率，避免大量设备同时上电
+	BulkRate        int `json:"bulk_rate" yaml:"bulk_rate" toml:"bulk_rate"`                      // 每秒发送的唤醒包数，0 表示不限制
+	BulkConcurrency int `json:"bulk_concurrency" yaml:"bulk_concurrency" toml:"bulk_concurrency"` // 同时进行的发送数
+
+	// 审计日志：记录每次唤醒尝试
+	AuditFile       string   `json:"audit_file" yaml:"audit_file" toml:"audit_file"`                      // 为空时使用设备登记文件所在目录下的 audit.jsonl
+	AuditRetention  Duration `json:"audit_retention" yaml:"audit_retention" toml:"audit_retention"`       // 记录保留时间，0 表示不限制
+	AuditMaxEntries int      `json:"audit_max_entries" yaml:"audit_max_entries" toml:"audit_max_entries"` // 最多保留的记录数，0 表示不限制
+
+	// MQTT：接收唤醒命令，发布唤醒结果和设备在线状态
+	MQTTBroker        string   `json:"mqtt_broker" yaml:"mqtt_broker" toml:"mqtt_broker"` // 如 tcp://localhost:1883，为空时不启用
+	MQTTClientID      string   `json:"mqtt_client_id" yaml:"mqtt_client_id" toml:"mqtt_client_id"`
+	MQTTUsername      string   `json:"mqtt_username" yaml:"mqtt_username" toml:"mqtt_username"`
+	MQTTPassword      string   `json:"mqtt_password" yaml:"mqtt_password" toml:"mqtt_password"` // 只能通过配置文件或环境变量设置
+	MQTTTopicPrefix   string   `json:"mqtt_topic_prefix" yaml:"mqtt_topic_prefix" toml:"mqtt_topic_prefix"`
+	MQTTStateInterval Duration `json:"mqtt_state_interval" yaml:"mqtt_state_interval" toml:"mqtt_state_interval"` // 探测设备在线状态的间隔，0 表示不探测
+
+	// Home Assistant MQTT自动发现
+	MQTTDiscovery       bool   `json:"mqtt_discovery" yaml:"mqtt_discovery" toml:"mqtt_discovery"`
+	MQTTDiscoveryPrefix string `json:"mqtt_discovery_prefix" yaml:"mqtt_discovery_prefix" toml:"mqtt_discovery_prefix"`
+
+	// 认证：用户和令牌只能在配置文件中设置
+	Auth AuthConfig `json:"auth" yaml:"auth" toml:"auth"`
+}
+
+// Duration 可以从 "10s"、"1m30s" 这样的字符串解析的时长
+type Duration time.Duration
+
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	v, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// 标准的UDP唤醒端口
+const defaultWakePort = 9
+
+// config 当前生效的服务配置
+var config = defaultConfig()
+
+func defaultConfig() Config {
+	return Config{
+		Listen:              ":24000",
+		DataFile:            defaultRegistryPath(),
+		DefaultBroadcast:    "255.255.255.255",
+		DefaultPort:         defaultWakePort,
+		ReadTimeout:         Duration(10 * time.Second),
+		WriteTimeout:        Duration(10 * time.Second),
+		IdleTimeout:         Duration(60 * time.Second),
+		SendTimeout:         Duration(5 * time.Second),
+		VerifyTimeout:       Duration(2 * time.Minute),
+		VerifyInterval:      Duration(2 * time.Second),
+		Repeat:              1,
+		RepeatInterval:      Duration(100 * time.Millisecond),
+		ProxyMaxWait:        Duration(3 * time.Minute),
+		BulkRate:            20,
+		BulkConcurrency:     8,
+		AuditRetention:      Duration(90 * 24 * time.Hour),
+		AuditMaxEntries:     100000,
+		MQTTClientID:        "wol-service",
+		MQTTTopicPrefix:     "wol",
+		MQTTStateInterval:   Duration(time.Minute),
+		MQTTDiscoveryPrefix: "homeassistant",
+		Auth:                AuthConfig{SessionTTL: Duration(7 * 24 * time.Hour)},
+	}
+}
+
+// configOption 描述一个可以同时通过命令行参数和环境变量设置的配置项
+type configOption struct {
+	flag  string
+	env   string
+	usage string
+	get   func(c *Config) string
+	set   func(c *Config, v string) error
+
+	isBool bool // 布尔参数可以省略值，如 -relay-registered-only
+	noFlag bool // 不提供命令行参数，避免凭据出现在进程列表中
+}
+
+var configOptions = []configOption{
+	{
+		flag: "listen", env: "WOL_LISTEN", usage: "HTTP监听地址",
+		get: func(c *Config) string { return c.Listen },
+		set: func(c *Config, v string) error { c.Listen = v; return nil },
+	},
+	{
+		flag: "data-file", env: "WOL_DATA_FILE", usage: "设备登记文件路径",
+		get: func(c *Config) string { return c.DataFile },
+		set: func(c *Config, v string) error { c.DataFile = v; return nil },
+	},
+	{
+		flag: "default-broadcast", env: "WOL_DEFAULT_BROADCAST", usage: "默认广播地址",
+		get: func(c *Config) string { return c.DefaultBroadcast },
+		set: func(c *Config, v string) error { c.DefaultBroadcast = v; return nil },
+	},
+	{
+		flag: "default-port", env: "WOL_DEFAULT_PORT", usage: "默认UDP唤醒端口",
+		get: func(c *Config) string { return strconv.Itoa(c.DefaultPort) },
+		set: func(c *Config, v string) error {
+			port, err := strconv.Atoi(v)
+			if err != nil {
+				return fmt.Errorf("无效的端口: %s", v)
+			}
+			c.DefaultPort = port
+			return nil
+		},
+	},
+	durationOption("read-timeout", "WOL_READ_TIMEOUT", "HTTP读取超时", func(c *Config) *Duration { return &c.ReadTimeout }),
+	durationOption("write-timeout", "WOL_WRITE_TIMEOUT", "HTTP写入超时", func(c *Config) *Duration { return &c.WriteTimeout }),
+	durationOption("idle-timeout", "WOL_IDLE_TIMEOUT", "HTTP空闲连接超时", func(c *Config) *Duration { return &c.IdleTimeout }),
+	durationOption("send-timeout", "WOL_SEND_TIMEOUT", "发送唤醒包超时", func(c *Config) *Duration { return &c.SendTimeout }),
+	durationOption("verify-timeout", "WOL_VERIFY_TIMEOUT", "唤醒后等待设备上线的默认超时", func(c *Config) *Duration { return &c.VerifyTimeout }),
+	durationOption("verify-interval", "WOL_VERIFY_INTERVAL", "上线验证的探测间隔", func(c *Config) *Duration { return &c.VerifyInterval }),
+	intOption("repeat", "WOL_REPEAT", "每次唤醒发送的唤醒包个数，用于丢包严重的网络", func(c *Config) *int { return &c.Repeat }),
+	durationOption("repeat-interval", "WOL_REPEAT_INTERVAL", "重复发送唤醒包的间隔", func(c *Config) *Duration { return &c.RepeatInterval }),
+	{
+		flag: "relay-listen", env: "WOL_RELAY_LISTEN", usage: "中继模式UDP监听地址，如 :9，为空时不启用",
+		get: func(c *Config) string { return c.RelayListen },
+		set: func(c *Config, v string) error { c.RelayListen = v; return nil },
+	},
+	listOption("relay-interfaces", "WOL_RELAY_INTERFACES", "中继转发使用的网络接口，逗号分隔，all 表示所有接口", func(c *Config) *[]string { return &c.RelayInterfaces }),
+	{
+		flag: "relay-port", env: "WOL_RELAY_PORT", usage: "中继转发的目标端口，为0时使用默认端口",
+		get: func(c *Config) string { return strconv.Itoa(c.RelayPort) },
+		set: func(c *Config, v string) error {
+			port, err := strconv.Atoi(v)
+			if err != nil {
+				return fmt.Errorf("无效的端口: %s", v)
+			}
+			c.RelayPort = port
+			return nil
+		},
+	},
+	listOption("relay-allowlist", "WOL_RELAY_ALLOWLIST", "中继允许转发的MAC地址，逗号分隔，为空时不限制", func(c *Config) *[]string { return &c.RelayAllowlist }),
+	boolOption("relay-registered-only", "WOL_RELAY_REGISTERED_ONLY", "中继只转发已登记设备的唤醒包", func(c *Config) *bool { return &c.RelayRegisteredOnly }),
+	listOption("target-allowlist", "WOL_TARGET_ALLOWLIST", "允许发送唤醒包的目的网络（CIDR或地址），逗号分隔，为空时不限制", func(c *Config) *[]string { return &c.TargetAllowlist }),
+	boolOption("target-registered-only", "WOL_TARGET_REGISTERED_ONLY", "只允许唤醒已登记的设备", func(c *Config) *bool { return &c.TargetRegisteredOnly }),
+	durationOption("proxy-max-wait", "WOL_PROXY_MAX_WAIT", "按需唤醒代理等待后端上线的最长时间", func(c *Config) *Duration { return &c.ProxyMaxWait }),
+	intOption("bulk-rate", "WOL_BULK_RATE", "批量唤醒时每秒发送的唤醒包数，0 表示不限制", func(c *Config) *int { return &c.BulkRate }),
+	intOption("bulk-concurrency", "WOL_BULK_CONCURRENCY", "批量唤醒时同时进行的发送数", func(c *Config) *int { return &c.BulkConcurrency }),
+	{
+		flag: "audit-file", env: "WOL_AUDIT_FILE", usage: "审计日志文件路径，默认为设备登记文件所在目录下的 audit.jsonl",
+		get: func(c *Config) string { return c.AuditFile },
+		set: func(c *Config, v string) error { c.AuditFile = v; return nil },
+	},
+	durationOption("audit-retention", "WOL_AUDIT_RETENTION", "审计日志的保留时间，0 表示不限制", func(c *Config) *Duration { return &c.AuditRetention }),
+	intOption("audit-max-entries", "WOL_AUDIT_MAX_ENTRIES", "审计日志最多保留的记录数，0 表示不限制", func(c *Config) *int { return &c.AuditMaxEntries }),
+	{
+		flag: "mqtt-broker", env: "WOL_MQTT_BROKER", usage: "MQTT broker地址，如 tcp://localhost:1883，为空时不启用",
+		get: func(c *Config) string { return c.MQTTBroker },
+		set: func(c *Config, v string) error { c.MQTTBroker = v; return nil },
+	},
+	{
+		flag: "mqtt-client-id", env: "WOL_MQTT_CLIENT_ID", usage: "MQTT客户端ID",
+		get: func(c *Config) string { return c.MQTTClientID },
+		set: func(c *Config, v string) error { c.MQTTClientID = v; return nil },
+	},
+	{
+		flag: "mqtt-username", env: "WOL_MQTT_USERNAME", usage: "MQTT用户名",
+		get: func(c *Config) string { return c.MQTTUsername },
+		set: func(c *Config, v string) error { c.MQTTUsername = v; return nil },
+	},
+	{
+		flag: "mqtt-password", env: "WOL_MQTT_PASSWORD", usage: "MQTT密码", noFlag: true,
+		get: func(c *Config) string { return c.MQTTPassword },
+		set: func(c *Config, v string) error { c.MQTTPassword = v; return nil },
+	},
+	{
+		flag: "mqtt-topic-prefix", env: "WOL_MQTT_TOPIC_PREFIX", usage: "MQTT主题前缀",
+		get: func(c *Config) string { return c.MQTTTopicPrefix },
+		set: func(c *Config, v string) error { c.MQTTTopicPrefix = v; return nil },
+	},
+	durationOption("mqtt-state-interval", "WOL_MQTT_STATE_INTERVAL", "探测设备在线状态并发布到MQTT的间隔，0 表示不探测", func(c *Config) *Duration { return &c.MQTTStateInterval }),
+	boolOption("mqtt-discovery", "WOL_MQTT_DISCOVERY", "通过Home Assistant MQTT自动发现发布登记的设备", func(c *Config) *bool { return &c.MQTTDiscovery }),
+	{
+		flag: "mqtt-discovery-prefix", env: "WOL_MQTT_DISCOVERY_PREFIX", usage: "Home Assistant自动发现的主题前缀",
+		get: func(c *Config) string { return c.MQTTDiscoveryPrefix },
+		set: func(c *Config, v string) error { c.MQTTDiscoveryPrefix = v; return nil },
+	},
+}
+
+func durationOption(name, env, usage string, field func(c *Config) *Duration) configOption {
+	return configOption{
+		flag: name, env: env, usage: usage,
+		get: func(c *Config) string { return field(c).String() },
+		set: func(c *Config, v string) error { return field(c).UnmarshalText([]byte(v)) },
+	}
+}
+
+func listOption(name, env, usage string, field func(c *Config) *[]string) configOption {
+	return configOption{
+		flag: name, env: env, usage: usage,
+		get: func(c *Config) string { return strings.Join(*field(c), ",") },
+		set: func(c *Config, v string) error {
+			var items []string
+			for _, item := range strings.Split(v, ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					items = append(items, item)
+				}
+			}
+			*field(c) = items
+			return nil
+		},
+	}
+}
+
+func intOption(name, env, usage string, field func(c *Config) *int) configOption {
+	return configOption{
+		flag: name, env: env, usage: usage,
+		get: func(c *Config) string { return strconv.Itoa(*field(c)) },
+		set: func(c *Config, v string) error {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return fmt.Errorf("无效的整数: %s", v)
+			}
+			*field(c) = n
+			return nil
+		},
+	}
+}
+
+func boolOption(name, env, usage string, field func(c *Config) *bool) configOption {
+	return configOption{
+		flag: name, env: env, usage: usage, isBool: true,
+		get: func(c *Config) string { return strconv.FormatBool(*field(c)) },
+		set: func(c *Config, v string) error {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return fmt.Errorf("无效的布尔值: %s", v)
+			}
+			*field(c) = b
+			return nil
+		},
+	}
+}
+
+// optionValue 记录命令行参数的原始值，在配置文件和环境变量之后再应用
+type optionValue struct {
+	def    string
+	value  string
+	isBool bool
+}
+
+func (v *optionValue) String() string {
+	if v == nil {
+		return ""
+	}
+	return v.def
+}
+
+func (v *optionValue) Set(s string) error {
+	v.value = s
+	return nil
+}
+
+func (v *optionValue) IsBoolFlag() bool {
+	return v.isBool
+}
+
+// loadConfig 按优先级合并默认值、配置文件、环境变量和命令行参数
+func loadConfig(name string, args []string) (Config, error) {
+	cfg, _, err := loadConfigFlags(flag.NewFlagSet(name, flag.ContinueOnError), args)
+	return cfg, err
+}
+
+// loadConfigFlags 与 loadConfig 相同，子命令可以预先在 fs 中定义自己的参数，
+// 返回参数之外的位置参数
+func loadConfigFlags(fs *flag.FlagSet, args []string) (Config, []string, error) {
+	cfg := defaultConfig()
+
+	configFile := fs.String("config", os.Getenv("WOL_CONFIG"), "配置文件路径（支持 .json/.yaml/.yml/.toml），也可通过 WOL_CONFIG 设置")
+	values := make(map[string]*optionValue, len(configOptions))
+	for _, opt := range configOptions {
+		if opt.noFlag {
+			continue
+		}
+		v := &optionValue{def: opt.get(&cfg), isBool: opt.isBool}
+		values[opt.flag] = v
+		fs.Var(v, opt.flag, fmt.Sprintf("%s（环境变量 %s）", opt.usage, opt.env))
+	}
+	positional, err := parseFlags(fs, args)
+	if err != nil {
+		return cfg, nil, err
+	}
+
+	if *configFile != "" {
+		if err := readConfigFile(*configFile, &cfg); err != nil {
+			return cfg, nil, err
+		}
+	}
+
+	for _, opt := range configOptions {
+		if v, ok := os.LookupEnv(opt.env); ok {
+			if err := opt.set(&cfg, v); err != nil {
+				return cfg, nil, fmt.Errorf("环境变量 %s: %v", opt.env, err)
+			}
+		}
+	}
+
+	var flagErr error
+	fs.Visit(func(f *flag.Flag) {
+		for _, opt := range configOptions {
+			if opt.flag == f.Name && flagErr == nil {
+				if err := opt.set(&cfg, values[f.Name].value); err != nil {
+					flagErr = fmt.Errorf("参数 -%s: %v", f.Name, err)
+				}
+			}
+		}
+	})
+	if flagErr != nil {
+		return cfg, nil, flagErr
+	}
+
+	return cfg, positional, cfg.validate()
+}
+
+// parseFlags 解析命令行参数，参数和位置参数可以交替出现，如 wake pc-01 --port 9；
+// "--" 之后的内容全部作为位置参数
+func parseFlags(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		rest := fs.Args()
+		if len(rest) == 0 {
+			return positional, nil
+		}
+		if len(args) > len(rest) && args[len(args)-len(rest)-1] == "--" {
+			return append(positional, rest...), nil
+		}
+		positional = append(positional, rest[0])
+		args = rest[1:]
+	}
+}
+
+// readConfigFile 根据扩展名解析配置文件，文件中未出现的字段保持原值
+func readConfigFile(path string, cfg *Config) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("无法读取配置文件: %v", err)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		err = dec.Decode(cfg)
+	case ".yaml", ".yml":
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		err = dec.Decode(cfg)
+	case ".toml":
+		var md toml.MetaData
+		md, err = toml.Decode(string(data), cfg)
+		if err == nil && len(md.Undecoded()) > 0 {
+			err = fmt.Errorf("未知的配置项: %v", md.Undecoded())
+		}
+	default:
+		return fmt.Errorf("不支持的配置文件格式: %s", path)
+	}
+	if err != nil {
+		return fmt.Errorf("无法解析配置文件 %s: %v", path, err)
+	}
+	return nil
+}
+
+func (c Config) validate() error {
+	if c.Listen == "" {
+		return fmt.Errorf("监听地址不能为空")
+	}
+	if c.DataFile == "" {
+		return fmt.Errorf("设备文件路径不能为空")
+	}
+	if c.DefaultBroadcast == "" {
+		return fmt.Errorf("默认广播地址不能为空")
+	}
+	if c.DefaultPort < 1 || c.DefaultPort > 65535 {
+		return fmt.Errorf("默认端口超出范围: %d", c.DefaultPort)
+	}
+	if c.VerifyTimeout <= 0 || c.VerifyInterval <= 0 {
+		return fmt.Errorf("验证超时和探测间隔必须大于0")
+	}
+	if c.Repeat < 1 {
+		return fmt.Errorf("%w: 重复次数必须大于0: %d", errInvalidRepeat, c.Repeat)
+	}
+	if err := validateRepeat(c.Repeat, c.RepeatInterval); err != nil {
+		return err
+	}
+	if c.RelayPort < 0 || c.RelayPort > 65535 {
+		return fmt.Errorf("中继端口超出范围: %d", c.RelayPort)
+	}
+	for _, mac := range c.RelayAllowlist {
+		if _, err := wol.ParseMAC(mac); err != nil {
+			return fmt.Errorf("中继允许列表中的MAC地址无效: %s", mac)
+		}
+	}
+	for _, s := range c.TargetAllowlist {
+		if _, err := parseAllowedNetwork(s); err != nil {
+			return fmt.Errorf("目标允许列表中的网络无效: %s", s)
+		}
+	}
+	if c.ProxyMaxWait <= 0 {
+		return fmt.Errorf("代理等待时间必须大于0")
+	}
+	if c.BulkRate < 0 {
+		return fmt.Errorf("批量唤醒速率不能为负数: %d", c.BulkRate)
+	}
+	if c.BulkConcurrency < 1 {
+		return fmt.Errorf("批量唤醒并发数必须大于0: %d", c.BulkConcurrency)
+	}
+	if c.AuditRetention < 0 {
+		return fmt.Errorf("审计日志保留时间不能为负数: %s", c.AuditRetention)
+	}
+	if c.AuditMaxEntries < 0 {
+		return fmt.Errorf("审计日志最大记录数不能为负数: %d", c.AuditMaxEntries)
+	}
+	for _, p := range c.TCPProxies {
+		if err := p.validate(); err != nil {
+			return err
+		}
+	}
+	hosts := make(map[string]bool)
+	for _, p := range c.HTTPProxies {
+		if err := p.validate(); err != nil {
+			return err
+		}
+		if hosts[strings.ToLower(p.Host)] {
+			return fmt.Errorf("HTTP代理的主机名重复: %s", p.Host)
+		}
+		hosts[strings.ToLower(p.Host)] = true
+	}
+	names := make(map[string]bool)
+	for _, w := range c.Webhooks {
+		if err := w.validate(); err != nil {
+			return err
+		}
+		if names[w.Name] {
+			return fmt.Errorf("webhook名称重复: %s", w.Name)
+		}
+		names[w.Name] = true
+	}
+	if c.MQTTBroker != "" {
+		if err := validateMQTTBroker(c.MQTTBroker); err != nil {
+			return err
+		}
+		if c.MQTTClientID == "" {
+			return fmt.Errorf("MQTT客户端ID不能为空")
+		}
+	}
+	if c.MQTTTopicPrefix == "" || strings.ContainsAny(c.MQTTTopicPrefix, "+#") || strings.HasSuffix(c.MQTTTopicPrefix, "/") {
+		return fmt.Errorf("无效的MQTT主题前缀: %q", c.MQTTTopicPrefix)
+	}
+	if c.MQTTDiscoveryPrefix == "" || strings.ContainsAny(c.MQTTDiscoveryPrefix, "+#") || strings.HasSuffix(c.MQTTDiscoveryPrefix, "/") {
+		return fmt.Errorf("无效的Home Assistant自动发现主题前缀: %q", c.MQTTDiscoveryPrefix)
+	}
+	if c.MQTTStateInterval < 0 {
+		return fmt.Errorf("MQTT状态探测间隔不能为负数: %s", c.MQTTStateInterval)
+	}
+	if c.Auth.SessionTTL <= 0 {
+		return fmt.Errorf("登录会话有效期必须大于0")
+	}
+	return c.Auth.validate()
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeTestFile(t *testing.T, name, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	return path
+}
+
+func TestLoadConfigFileFormats(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+	}{
+		{
+			name:    "JSON",
+			file:    "config.json",
+			content: `{"listen": ":8080", "default_broadcast": "192.168.1.255", "default_port": 7, "send_timeout": "2s"}`,
+		},
+		{
+			name:    "YAML",
+			file:    "config.yaml",
+			content: "listen: \":8080\"\ndefault_broadcast: 192.168.1.255\ndefault_port: 7\nsend_timeout: 2s\n",
+		},
+		{
+			name:    "TOML",
+			file:    "config.toml",
+			content: "listen = \":8080\"\ndefault_broadcast = \"192.168.1.255\"\ndefault_port = 7\nsend_timeout = \"2s\"\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeTestFile(t, tt.file, tt.content)
+
+			cfg, err := loadConfig("test", []string{"-config", path})
+			if err != nil {
+				t.Fatalf("loadConfig() error = %v", err)
+			}
+			if cfg.Listen != ":8080" || cfg.DefaultBroadcast != "192.168.1.255" || cfg.DefaultPort != 7 {
+				t.Errorf("loadConfig() = %+v", cfg)
+			}
+			if time.Duration(cfg.SendTimeout) != 2*time.Second {
+				t.Errorf("SendTimeout = %v, want 2s", cfg.SendTimeout)
+			}
+			// 文件中未出现的字段保持默认值
+			if time.Duration(cfg.IdleTimeout) != 60*time.Second {
+				t.Errorf("IdleTimeout = %v, want default 1m0s", cfg.IdleTimeout)
+			}
+		})
+	}
+}
+
+func TestLoadConfigPrecedence(t *testing.T) {
+	path := writeTestFile(t, "config.json", `{"listen": ":1000", "default_broadcast": "10.0.0.255", "default_port": 7}`)
+
+	t.Setenv("WOL_CONFIG", path)
+	t.Setenv("WOL_LISTEN", ":2000")
+	t.Setenv("WOL_DEFAULT_PORT", "9")
+
+	cfg, err := loadConfig("test", []string{"-listen", ":3000"})
+	if err != nil {
+		t.Fatalf("loadConfig() error = %v", err)
+	}
+
+	// 命令行参数 > 环境变量 > 配置文件
+	if cfg.Listen != ":3000" {
+		t.Errorf("Listen = %q, want flag value :3000", cfg.Listen)
+	}
+	if cfg.DefaultPort != 9 {
+		t.Errorf("DefaultPort = %d, want env value 9", cfg.DefaultPort)
+	}
+	if cfg.DefaultBroadcast != "10.0.0.255" {
+		t.Errorf("DefaultBroadcast = %q, want file value 10.0.0.255", cfg.DefaultBroadcast)
+	}
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		env  map[string]string
+	}{
+		{name: "Invalid port flag", args: []string{"-default-port", "abc"}},
+		{name: "Port out of range", args: []string{"-default-port", "70000"}},
+		{name: "Invalid duration env", env: map[string]string{"WOL_SEND_TIMEOUT": "soon"}},
+		{name: "Unsupported file", args: []string{"-config", "config.ini"}},
+		{name: "Unknown field", args: []string{"-config", writeTestFile(t, "config.json", `{"lisen": ":1"}`)}},
+		{name: "Invalid MQTT broker", args: []string{"-mqtt-broker", "localhost:1883"}},
+		{name: "MQTT topic wildcard", env: map[string]string{"WOL_MQTT_TOPIC_PREFIX": "wol/#"}},
+		{name: "MQTT password flag", args: []string{"-mqtt-password", "secret"}},
+		{name: "Empty discovery prefix", args: []string{"-mqtt-discovery-prefix", ""}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			if _, err := loadConfig("test", tt.args); err == nil {
+				t.Error("loadConfig() expected error")
+			}
+		})
+	}
+}
@@ -0,0 +1,643 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tdh62/wake_on_lan_proxy/wol"
+)
+
+var (
+	errDeviceNotFound  = errors.New("设备不存在")
+	errDuplicateDevice = errors.New("设备已存在")
+)
+
+// Device 登记在服务端的设备
+type Device struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	MAC       string `json:"mac"`
+	Broadcast string `json:"broadcast,omitempty"` // 为空时使用默认广播地址
+	Port      int    `json:"port,omitempty"`      // 为0时使用默认端口
+	Password  string `json:"password,omitempty"`  // SecureOn密码
+	Transport string `json:"transport,omitempty"` // 发送方式: udp 或 ethernet
+	Interface string `json:"interface,omitempty"` // 发送使用的网络接口
+	SourceIP  string `json:"source_ip,omitempty"` // UDP方式绑定的源地址
+	Notes     string `json:"notes,omitempty"`
+
+	AllInterfaces  bool          `json:"all_interfaces,omitempty"`  // 在所有接口的定向广播地址上发送
+	Repeat         int           `json:"repeat,omitempty"`          // 发送的唤醒包个数，为0时使用默认值
+	RepeatInterval Duration      `json:"repeat_interval,omitempty"` // 重复发送的间隔，为0时使用默认值
+	Verify         *VerifyConfig `json:"verify,omitempty"`          // 唤醒后确认设备上线的方式
+	Schedules      []Schedule    `json:"schedules,omitempty"`       // 定时唤醒任务
+}
+
+// registryFile 设备登记文件的存储格式
+type registryFile struct {
+	Devices []Device `json:"devices"`
+	Groups  []Group  `json:"groups,omitempty"`
+}
+
+// registryPollInterval 服务检查设备文件是否被其他进程（如 devices add/rm 命令）修改的间隔
+const registryPollInterval = 2 * time.Second
+
+// DeviceRegistry 服务端设备登记表，所有修改都会立即写回文件
+//
+// 服务和命令行可以同时使用同一个设备文件：每次修改都持有文件锁，
+// 并先重新读取文件，在最新内容上修改后再写回，不会覆盖其他进程的修改
+type DeviceRegistry struct {
+	mu       sync.RWMutex
+	path     string
+	devices  []Device
+	groups   []Group
+	stamp    fileStamp // 最近一次读取或写入时文件的状态
+	watchers []chan struct{}
+}
+
+// fileStamp 用于判断文件是否被修改
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// statFile 返回文件的状态，文件不存在时为零值
+func statFile(path string) fileStamp {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileStamp{}
+	}
+	return fileStamp{modTime: info.ModTime(), size: info.Size()}
+}
+
+// defaultRegistryPath 返回可执行文件所在目录下的 devices.json
+func defaultRegistryPath() string {
+	exe, err := os.Executable()
+	if err != nil {
+		return "devices.json"
+	}
+	return filepath.Join(filepath.Dir(exe), "devices.json")
+}
+
+// openDeviceRegistry 从文件加载设备登记表，文件不存在时返回空登记表
+func openDeviceRegistry(path string) (*DeviceRegistry, error) {
+	r := &DeviceRegistry{path: path}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// load 从文件重新读取设备和分组，文件不存在时为空登记表；调用时需持有写锁
+func (r *DeviceRegistry) load() error {
+	stamp := statFile(r.path)
+	data, err := os.ReadFile(r.path)
+	if errors.Is(err, os.ErrNotExist) {
+		r.devices, r.groups, r.stamp = nil, nil, fileStamp{}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("无法读取设备文件: %v", err)
+	}
+
+	var file registryFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("无法解析设备文件 %s: %v", r.path, err)
+	}
+	r.devices = file.Devices
+	r.groups = file.Groups
+	r.stamp = stamp
+	return nil
+}
+
+// lock 获取写锁和设备文件的文件锁，并重新读取文件以包含其他进程的修改；
+// 返回的 unlock 依次释放两个锁
+func (r *DeviceRegistry) lock() (unlock func(), err error) {
+	r.mu.Lock()
+	unlockFile, err := lockFile(r.path + ".lock")
+	if err != nil {
+		r.mu.Unlock()
+		return nil, fmt.Errorf("无法锁定设备文件: %v", err)
+	}
+	unlock = func() {
+		unlockFile()
+		r.mu.Unlock()
+	}
+
+	// 修改时间的精度有限，持有文件锁时总是重新读取，而不是只比较文件状态
+	if err := r.load(); err != nil {
+		unlock()
+		return nil, err
+	}
+	return unlock, nil
+}
+
+// watchFile 定期检查设备文件，被其他进程修改后重新读取并通知 Watch 的接收方
+func (r *DeviceRegistry) watchFile(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if err := r.reload(); err != nil {
+			log.Printf("重新读取设备文件失败: %v", err)
+		}
+	}
+}
+
+// reload 设备文件在上次读取或写入后被修改时重新读取
+func (r *DeviceRegistry) reload() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if statFile(r.path) == r.stamp {
+		return nil
+	}
+	if err := r.load(); err != nil {
+		return err
+	}
+	r.notify()
+	return nil
+}
+
+// List 返回所有设备的副本
+func (r *DeviceRegistry) List() []Device {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	devices := make([]Device, len(r.devices))
+	copy(devices, r.devices)
+	return devices
+}
+
+// Get 按ID查找设备
+func (r *DeviceRegistry) Get(id string) (Device, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, d := range r.devices {
+		if d.ID == id {
+			return d, true
+		}
+	}
+	return Device{}, false
+}
+
+// Find 按ID、名称（不区分大小写）或MAC地址查找设备
+func (r *DeviceRegistry) Find(ref string) (Device, bool) {
+	if d, ok := r.Get(ref); ok {
+		return d, true
+	}
+
+	mac := ""
+	if b, err := wol.ParseMAC(ref); err == nil {
+		mac = wol.FormatMAC(b)
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, d := range r.devices {
+		if strings.EqualFold(d.Name, ref) || (mac != "" && d.MAC == mac) {
+			return d, true
+		}
+	}
+	return Device{}, false
+}
+
+// Add 校验并登记新设备，返回分配了ID的设备
+func (r *DeviceRegistry) Add(d Device) (Device, error) {
+	if err := normalizeDevice(&d); err != nil {
+		return Device{}, err
+	}
+
+	unlock, err := r.lock()
+	if err != nil {
+		return Device{}, err
+	}
+	defer unlock()
+
+	if err := r.checkDevice(d); err != nil {
+		return Device{}, err
+	}
+
+	id, err := newDeviceID()
+	if err != nil {
+		return Device{}, err
+	}
+	d.ID = id
+
+	devices := append(r.devices[:len(r.devices):len(r.devices)], d)
+	if err := r.save(devices, r.groups); err != nil {
+		return Device{}, err
+	}
+	r.devices = devices
+
+	return d, nil
+}
+
+// Update 按ID替换设备信息
+func (r *DeviceRegistry) Update(d Device) error {
+	if err := normalizeDevice(&d); err != nil {
+		return err
+	}
+
+	unlock, err := r.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if err := r.checkDevice(d); err != nil {
+		return err
+	}
+
+	devices := make([]Device, len(r.devices))
+	copy(devices, r.devices)
+
+	for i := range devices {
+		if devices[i].ID == d.ID {
+			devices[i] = d
+			if err := r.save(devices, r.groups); err != nil {
+				return err
+			}
+			r.devices = devices
+			return nil
+		}
+	}
+	return errDeviceNotFound
+}
+
+// Remove 按ID删除设备
+func (r *DeviceRegistry) Remove(id string) error {
+	unlock, err := r.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	for i := range r.devices {
+		if r.devices[i].ID == id {
+			devices := make([]Device, 0, len(r.devices)-1)
+			devices = append(devices, r.devices[:i]...)
+			devices = append(devices, r.devices[i+1:]...)
+			groups := removeGroupDevice(r.groups, id)
+			if err := r.save(devices, groups); err != nil {
+				return err
+			}
+			r.devices = devices
+			r.groups = groups
+			return nil
+		}
+	}
+	return errDeviceNotFound
+}
+
+// checkDevice 检查名称（不区分大小写）和MAC地址不与其他设备重复，调用时需持有锁；
+// 按名称或MAC地址查找设备时只返回第一个匹配的设备，重复时会唤醒错误的设备
+func (r *DeviceRegistry) checkDevice(d Device) error {
+	for _, existing := range r.devices {
+		if existing.ID == d.ID {
+			continue
+		}
+		if strings.EqualFold(existing.Name, d.Name) {
+			return fmt.Errorf("%w: 名称 %s 已被使用", errDuplicateDevice, d.Name)
+		}
+		if existing.MAC == d.MAC {
+			return fmt.Errorf("%w: MAC地址 %s 已登记为设备 %s", errDuplicateDevice, d.MAC, existing.Name)
+		}
+	}
+	return nil
+}
+
+// AddSchedule 为设备添加定时唤醒任务
+func (r *DeviceRegistry) AddSchedule(deviceID string, s Schedule) (Schedule, error) {
+	s.ID = ""
+	s.LastRun = nil
+	if err := normalizeSchedule(&s); err != nil {
+		return Schedule{}, err
+	}
+
+	err := r.modify(deviceID, func(d *Device) error {
+		d.Schedules = append(d.Schedules[:len(d.Schedules):len(d.Schedules)], s)
+		return nil
+	})
+	return s, err
+}
+
+// RemoveSchedule 删除设备的定时唤醒任务
+func (r *DeviceRegistry) RemoveSchedule(deviceID, scheduleID string) error {
+	return r.modify(deviceID, func(d *Device) error {
+		for i := range d.Schedules {
+			if d.Schedules[i].ID == scheduleID {
+				schedules := make([]Schedule, 0, len(d.Schedules)-1)
+				schedules = append(schedules, d.Schedules[:i]...)
+				d.Schedules = append(schedules, d.Schedules[i+1:]...)
+				return nil
+			}
+		}
+		return fmt.Errorf("%w: 定时任务不存在", errInvalidSchedule)
+	})
+}
+
+// SetScheduleRun 记录定时任务最近一次执行的结果
+func (r *DeviceRegistry) SetScheduleRun(deviceID, scheduleID string, run ScheduleRun) error {
+	return r.modify(deviceID, func(d *Device) error {
+		schedules := make([]Schedule, len(d.Schedules))
+		copy(schedules, d.Schedules)
+		for i := range schedules {
+			if schedules[i].ID == scheduleID {
+				schedules[i].LastRun = &run
+				d.Schedules = schedules
+				return nil
+			}
+		}
+		return fmt.Errorf("%w: 定时任务不存在", errInvalidSchedule)
+	})
+}
+
+// modify 在写锁内修改一个设备并写回文件，update 返回错误时不做任何修改
+func (r *DeviceRegistry) modify(id string, update func(d *Device) error) error {
+	unlock, err := r.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	for i := range r.devices {
+		if r.devices[i].ID != id {
+			continue
+		}
+		d := r.devices[i]
+		if err := update(&d); err != nil {
+			return err
+		}
+		devices := make([]Device, len(r.devices))
+		copy(devices, r.devices)
+		devices[i] = d
+		if err := r.save(devices, r.groups); err != nil {
+			return err
+		}
+		r.devices = devices
+		return nil
+	}
+	return errDeviceNotFound
+}
+
+// Watch 返回一个通道，登记表每次写回文件后收到通知，
+// 接收方处理不及时的多次修改会合并为一次通知
+func (r *DeviceRegistry) Watch() <-chan struct{} {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ch := make(chan struct{}, 1)
+	r.watchers = append(r.watchers, ch)
+	return ch
+}
+
+// Groups 返回所有设备分组的副本
+func (r *DeviceRegistry) Groups() []Group {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	groups := make([]Group, len(r.groups))
+	copy(groups, r.groups)
+	return groups
+}
+
+// FindGroup 按ID或名称（不区分大小写）查找分组
+func (r *DeviceRegistry) FindGroup(ref string) (Group, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, g := range r.groups {
+		if g.ID == ref || strings.EqualFold(g.Name, ref) {
+			return g, true
+		}
+	}
+	return Group{}, false
+}
+
+// AddGroup 校验并保存新分组，步骤中的设备必须已登记
+func (r *DeviceRegistry) AddGroup(g Group) (Group, error) {
+	if err := normalizeGroup(&g); err != nil {
+		return Group{}, err
+	}
+
+	unlock, err := r.lock()
+	if err != nil {
+		return Group{}, err
+	}
+	defer unlock()
+
+	if err := r.checkGroup(g); err != nil {
+		return Group{}, err
+	}
+
+	id, err := newDeviceID()
+	if err != nil {
+		return Group{}, err
+	}
+	g.ID = id
+
+	groups := append(r.groups[:len(r.groups):len(r.groups)], g)
+	if err := r.save(r.devices, groups); err != nil {
+		return Group{}, err
+	}
+	r.groups = groups
+	return g, nil
+}
+
+// UpdateGroup 按ID替换分组的名称、模式和步骤
+func (r *DeviceRegistry) UpdateGroup(g Group) (Group, error) {
+	if err := normalizeGroup(&g); err != nil {
+		return Group{}, err
+	}
+
+	unlock, err := r.lock()
+	if err != nil {
+		return Group{}, err
+	}
+	defer unlock()
+
+	if err := r.checkGroup(g); err != nil {
+		return Group{}, err
+	}
+	for i := range r.groups {
+		if r.groups[i].ID == g.ID {
+			groups := make([]Group, len(r.groups))
+			copy(groups, r.groups)
+			groups[i] = g
+			if err := r.save(r.devices, groups); err != nil {
+				return Group{}, err
+			}
+			r.groups = groups
+			return g, nil
+		}
+	}
+	return Group{}, errGroupNotFound
+}
+
+// checkGroup 检查步骤中的设备均已登记，且名称不与其他分组重复，调用时需持有锁
+func (r *DeviceRegistry) checkGroup(g Group) error {
+	for _, step := range g.Steps {
+		found := false
+		for _, d := range r.devices {
+			if d.ID == step.Device {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("%w: %s", errDeviceNotFound, step.Device)
+		}
+	}
+	for _, existing := range r.groups {
+		if existing.ID != g.ID && strings.EqualFold(existing.Name, g.Name) {
+			return fmt.Errorf("%w: 分组名称已存在: %s", errInvalidGroup, g.Name)
+		}
+	}
+	return nil
+}
+
+// RemoveGroup 按ID删除分组，不影响其中的设备
+func (r *DeviceRegistry) RemoveGroup(id string) error {
+	unlock, err := r.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	for i := range r.groups {
+		if r.groups[i].ID == id {
+			groups := make([]Group, 0, len(r.groups)-1)
+			groups = append(groups, r.groups[:i]...)
+			groups = append(groups, r.groups[i+1:]...)
+			if err := r.save(r.devices, groups); err != nil {
+				return err
+			}
+			r.groups = groups
+			return nil
+		}
+	}
+	return errGroupNotFound
+}
+
+// save 先写入临时文件再重命名，避免写到一半时留下损坏的文件
+func (r *DeviceRegistry) save(devices []Device, groups []Group) error {
+	data, err := json.MarshalIndent(registryFile{Devices: devices, Groups: groups}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := r.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil { // 可能包含SecureOn密码
+		return fmt.Errorf("无法写入设备文件: %v", err)
+	}
+	if err := os.Rename(tmp, r.path); err != nil {
+		return fmt.Errorf("无法写入设备文件: %v", err)
+	}
+	r.stamp = statFile(r.path)
+
+	r.notify()
+	return nil
+}
+
+// notify 通知 Watch 的接收方登记表已修改；在写锁内调用，接收方读取登记表时会等到本次修改完成
+func (r *DeviceRegistry) notify() {
+	for _, ch := range r.watchers {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// normalizeDevice 校验设备字段，并把MAC地址统一为 AA:BB:CC:DD:EE:FF 格式
+func normalizeDevice(d *Device) error {
+	d.Name = strings.TrimSpace(d.Name)
+	d.Broadcast = strings.TrimSpace(d.Broadcast)
+	d.Notes = strings.TrimSpace(d.Notes)
+	d.Transport = strings.ToLower(strings.TrimSpace(d.Transport))
+	d.Interface = strings.TrimSpace(d.Interface)
+	d.SourceIP = strings.TrimSpace(d.SourceIP)
+
+	mac, err := wol.ParseMAC(d.MAC)
+	if err != nil {
+		macValidationFailures.Inc()
+		return wrapWOLError(err)
+	}
+	d.MAC = wol.FormatMAC(mac)
+
+	password, err := wol.ParsePassword(d.Password)
+	if err != nil {
+		return wrapWOLError(err)
+	}
+	d.Password = wol.FormatMAC(password)
+
+	if err := d.target().validate(); err != nil {
+		return err
+	}
+
+	if d.Verify != nil {
+		d.Verify.Method = strings.ToLower(strings.TrimSpace(d.Verify.Method))
+		d.Verify.Host = strings.TrimSpace(d.Verify.Host)
+		if d.Verify.Method == "" {
+			d.Verify = nil
+		} else if err := d.Verify.validate(); err != nil {
+			return err
+		}
+	}
+
+	schedules := make([]Schedule, len(d.Schedules))
+	copy(schedules, d.Schedules)
+	for i := range schedules {
+		if err := normalizeSchedule(&schedules[i]); err != nil {
+			return err
+		}
+	}
+	d.Schedules = schedules
+	if len(d.Schedules) == 0 {
+		d.Schedules = nil
+	}
+
+	if d.Name == "" {
+		d.Name = d.MAC
+	}
+	// 广播地址和端口留空时，唤醒时使用配置中的默认值
+	if d.Port < 0 || d.Port > 65535 {
+		return fmt.Errorf("端口超出范围: %d", d.Port)
+	}
+	return nil
+}
+
+// target 返回唤醒该设备使用的目标参数
+func (d Device) target() WakeTarget {
+	return WakeTarget{
+		MAC:       d.MAC,
+		Broadcast: d.Broadcast,
+		Port:      d.Port,
+		Password:  d.Password,
+		Transport: d.Transport,
+		Interface: d.Interface,
+		SourceIP:  d.SourceIP,
+
+		AllInterfaces:  d.AllInterfaces,
+		Repeat:         d.Repeat,
+		RepeatInterval: d.RepeatInterval,
+	}
+}
+
+func newDeviceID() (string, error) {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("无法生成设备ID: %v", err)
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"sync"
+	"testing"
+)
+
+func TestDeviceRegistryPersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "devices.json")
+
+	r, err := openDeviceRegistry(path)
+	if err != nil {
+		t.Fatalf("openDeviceRegistry() error = %v", err)
+	}
+
+	added, err := r.Add(Device{Name: "NAS", MAC: "aa-bb-cc-dd-ee-ff", Password: "192.168.1.1", Notes: "书房"})
+	if err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	if added.ID == "" {
+		t.Fatal("Add() did not assign an ID")
+	}
+	if added.MAC != "AA:BB:CC:DD:EE:FF" {
+		t.Errorf("MAC = %q, want normalized AA:BB:CC:DD:EE:FF", added.MAC)
+	}
+	if added.Password != "C0:A8:01:01" {
+		t.Errorf("Password = %q, want normalized C0:A8:01:01", added.Password)
+	}
+	if added.Broadcast != "" || added.Port != 0 {
+		t.Errorf("defaults should be left empty: broadcast=%q port=%d", added.Broadcast, added.Port)
+	}
+	// 文件中有SecureOn密码，只允许所有者读写
+	if info, err := os.Stat(path); err != nil {
+		t.Fatalf("Stat() error = %v", err)
+	} else if runtime.GOOS != "windows" && info.Mode().Perm() != 0o600 {
+		t.Errorf("file mode = %v, want 0600", info.Mode().Perm())
+	}
+
+	// 重新打开文件，确认设备已持久化
+	reopened, err := openDeviceRegistry(path)
+	if err != nil {
+		t.Fatalf("openDeviceRegistry() error = %v", err)
+	}
+	got, ok := reopened.Get(added.ID)
+	if !ok {
+		t.Fatalf("device %s not found after reopen", added.ID)
+	}
+	if !reflect.DeepEqual(got, added) {
+		t.Errorf("reopened device = %+v, want %+v", got, added)
+	}
+
+	got.Name = "NAS-2"
+	if err := reopened.Update(got); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	if d, _ := reopened.Get(added.ID); d.Name != "NAS-2" {
+		t.Errorf("Update() name = %q, want NAS-2", d.Name)
+	}
+
+	if err := reopened.Remove(added.ID); err != nil {
+		t.Fatalf("Remove() error = %v", err)
+	}
+	if len(reopened.List()) != 0 {
+		t.Errorf("List() after Remove() = %v, want empty", reopened.List())
+	}
+	if err := reopened.Remove(added.ID); err != errDeviceNotFound {
+		t.Errorf("Remove() twice error = %v, want errDeviceNotFound", err)
+	}
+}
+
+func TestDeviceRegistryValidation(t *testing.T) {
+	r, err := openDeviceRegistry(filepath.Join(t.TempDir(), "devices.json"))
+	if err != nil {
+		t.Fatalf("openDeviceRegistry() error = %v", err)
+	}
+	nas, err := r.Add(Device{Name: "NAS", MAC: "11:22:33:44:55:66"})
+	if err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		device Device
+	}{
+		{name: "Invalid MAC", device: Device{Name: "bad", MAC: "GG:HH:II:JJ:KK:LL"}},
+		{name: "Invalid password", device: Device{Name: "bad", MAC: "AA:BB:CC:DD:EE:FF", Password: "123"}},
+		{name: "Port out of range", device: Device{Name: "bad", MAC: "AA:BB:CC:DD:EE:FF", Port: 70000}},
+		{name: "Duplicate name", device: Device{Name: " nas ", MAC: "AA:BB:CC:DD:EE:FF"}},
+		{name: "Duplicate MAC", device: Device{Name: "other", MAC: "11-22-33-44-55-66"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := r.Add(tt.device); err == nil {
+				t.Errorf("Add(%+v) expected error", tt.device)
+			}
+		})
+	}
+
+	if len(r.List()) != 1 {
+		t.Errorf("invalid devices were stored: %v", r.List())
+	}
+
+	// 修改设备时保留自己的名称和MAC地址不算重复，但不能改成其他设备的名称
+	other, err := r.Add(Device{Name: "desktop", MAC: "AA:BB:CC:DD:EE:FF"})
+	if err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	nas.Notes = "书房"
+	if err := r.Update(nas); err != nil {
+		t.Errorf("Update() unchanged name error = %v", err)
+	}
+	other.Name = "Nas"
+	if err := r.Update(other); !errors.Is(err, errDuplicateDevice) {
+		t.Errorf("Update() duplicate name error = %v", err)
+	}
+}
+
+func TestDeviceRegistryFind(t *testing.T) {
+	r, err := openDeviceRegistry(filepath.Join(t.TempDir(), "devices.json"))
+	if err != nil {
+		t.Fatalf("openDeviceRegistry() error = %v", err)
+	}
+	nas, err := r.Add(Device{Name: "NAS", MAC: "11:22:33:44:55:66"})
+	if err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+
+	for _, ref := range []string{nas.ID, "NAS", "nas", "11-22-33-44-55-66"} {
+		if d, ok := r.Find(ref); !ok || d.ID != nas.ID {
+			t.Errorf("Find(%q) = %+v, %v, want the NAS", ref, d, ok)
+		}
+	}
+	if _, ok := r.Find("desktop"); ok {
+		t.Errorf("Find() found a device that does not exist")
+	}
+}
+
+func TestDeviceRegistrySharedFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "devices.json")
+
+	// 服务和命令行各自打开同一个设备文件
+	server, err := openDeviceRegistry(path)
+	if err != nil {
+		t.Fatalf("openDeviceRegistry() error = %v", err)
+	}
+	watch := server.Watch()
+	cli, err := openDeviceRegistry(path)
+	if err != nil {
+		t.Fatalf("openDeviceRegistry() error = %v", err)
+	}
+
+	if _, err := server.Add(Device{Name: "nas", MAC: "11:11:11:11:11:11"}); err != nil {
+		t.Fatalf("server Add() error = %v", err)
+	}
+	added, err := cli.Add(Device{Name: "desktop", MAC: "22:22:22:22:22:22"})
+	if err != nil {
+		t.Fatalf("cli Add() error = %v", err)
+	}
+	<-watch // 服务自己保存时的通知
+
+	// 服务之后的修改不会覆盖命令行添加的设备
+	if _, err := server.Add(Device{Name: "laptop", MAC: "33:33:33:33:33:33"}); err != nil {
+		t.Fatalf("server Add() error = %v", err)
+	}
+	if got := len(server.List()); got != 3 {
+		t.Errorf("server has %d devices, want 3", got)
+	}
+	<-watch
+
+	if err := cli.Remove(added.ID); err != nil {
+		t.Fatalf("cli Remove() error = %v", err)
+	}
+	if err := server.reload(); err != nil {
+		t.Fatalf("reload() error = %v", err)
+	}
+	select {
+	case <-watch:
+	default:
+		t.Errorf("reload() did not notify watchers")
+	}
+	if _, ok := server.Find("desktop"); ok || len(server.List()) != 2 {
+		t.Errorf("server devices after reload = %+v", server.List())
+	}
+
+	// 文件未被修改时不重新读取，也不通知
+	if err := server.reload(); err != nil {
+		t.Fatalf("reload() error = %v", err)
+	}
+	select {
+	case <-watch:
+		t.Errorf("reload() notified without a change")
+	default:
+	}
+}
+
+func TestDeviceRegistryConcurrentWriters(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "devices.json")
+
+	const writers, perWriter = 4, 10
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		reg, err := openDeviceRegistry(path)
+		if err != nil {
+			t.Fatalf("openDeviceRegistry() error = %v", err)
+		}
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < perWriter; i++ {
+				mac := fmt.Sprintf("02:00:00:00:%02x:%02x", w, i)
+				if _, err := reg.Add(Device{Name: mac, MAC: mac}); err != nil {
+					t.Errorf("Add() error = %v", err)
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	reg, err := openDeviceRegistry(path)
+	if err != nil {
+		t.Fatalf("openDeviceRegistry() error = %v", err)
+	}
+	if got := len(reg.List()); got != writers*perWriter {
+		t.Errorf("registry has %d devices, want %d", got, writers*perWriter)
+	}
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tdh62/wake_on_lan_proxy/wol"
+)
+
+// 设备发现的限制
+const (
+	maxSweepHosts      = 1024             // 一次最多扫描的地址数，即 /22
+	sweepProbeInterval = time.Millisecond // 相邻两个探测包的间隔
+	sweepWait          = 2 * time.Second  // 发送完后等待ARP应答的时间
+	reverseDNSTimeout  = 2 * time.Second  // 单个地址反向解析的超时
+	reverseDNSTotal    = 10 * time.Second // 全部反向解析的超时，超时后未解析的主机名为空
+	reverseDNSWorkers  = 16               // 同时进行的反向解析数
+)
+
+var errInvalidSweep = errors.New("无效的扫描网段")
+
+// neighbor 邻居表中的一条有效记录
+type neighbor struct {
+	IP        net.IP
+	MAC       string
+	Interface string
+	Reachable bool // 状态为 REACHABLE，即最近确认过可达；只有netlink邻居表提供
+}
+
+// readNeighbors 读取系统的邻居表，测试时可以替换
+var readNeighbors = systemNeighbors
+
+// systemNeighbors 合并 /proc/net/arp 和netlink邻居表（包括IPv6邻居），两者都无法读取时返回错误
+func systemNeighbors() ([]neighbor, error) {
+	var neighbors []neighbor
+	arpEntries, arpErr := readARPTable(arpTablePath)
+	for _, e := range arpEntries {
+		if e.Complete {
+			neighbors = append(neighbors, neighbor{IP: e.IP, MAC: e.MAC, Interface: e.Interface})
+		}
+	}
+
+	netlink, netlinkErr := netlinkNeighbors()
+	if arpErr != nil && netlinkErr != nil {
+		return nil, fmt.Errorf("无法读取邻居表: %v; %v", arpErr, netlinkErr)
+	}
+	return append(neighbors, netlink...), nil
+}
+
+// DiscoveredHost 在邻居表中发现的一台主机
+type DiscoveredHost struct {
+	IP        string `json:"ip"`
+	MAC       string `json:"mac"`
+	Interface string `json:"interface,omitempty"`
+	Hostname  string `json:"hostname,omitempty"`
+	DeviceID  string `json:"device_id,omitempty"` // 已登记时为设备ID
+	Device    string `json:"device,omitempty"`    // 已登记时为设备名称
+}
+
+// discoverHosts 列出邻居表中的主机，sweep 不为nil时先主动扫描该网段并只返回其中的主机，
+// resolve 为true时反向解析主机名
+func discoverHosts(ctx context.Context, sweep *net.IPNet, resolve bool) ([]DiscoveredHost, error) {
+	if sweep != nil {
+		if err := sweepNetwork(ctx, sweep); err != nil {
+			return nil, err
+		}
+	}
+
+	neighbors, err := readNeighbors()
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	hosts := []DiscoveredHost{}
+	for _, n := range neighbors {
+		mac, err := wol.ParseMAC(n.MAC)
+		if err != nil || !usableMAC(mac) || n.IP.IsLoopback() {
+			continue
+		}
+		if sweep != nil && !sweep.Contains(n.IP) {
+			continue
+		}
+		h := DiscoveredHost{IP: n.IP.String(), MAC: wol.FormatMAC(mac), Interface: n.Interface}
+		if seen[h.IP+"|"+h.MAC] {
+			continue
+		}
+		seen[h.IP+"|"+h.MAC] = true
+		if d, ok := registry.Find(h.MAC); ok && d.MAC == h.MAC {
+			h.DeviceID, h.Device = d.ID, d.Name
+		}
+		hosts = append(hosts, h)
+	}
+
+	if resolve {
+		resolveHostnames(ctx, hosts)
+	}
+	sort.Slice(hosts, func(i, j int) bool {
+		a, b := net.ParseIP(hosts[i].IP), net.ParseIP(hosts[j].IP)
+		if (a.To4() == nil) != (b.To4() == nil) {
+			return a.To4() != nil // IPv4在前
+		}
+		return bytes.Compare(a.To16(), b.To16()) < 0
+	})
+	return hosts, nil
+}
+
+// usableMAC 排除全零、组播和广播地址，这些不是可以唤醒的网卡
+func usableMAC(mac net.HardwareAddr) bool {
+	return len(mac) == 6 && mac[0]&1 == 0 && !bytes.Equal(mac, make([]byte, 6))
+}
+
+// resolveHostnames 并发反向解析主机名，解析失败的保持为空
+func resolveHostnames(ctx context.Context, hosts []DiscoveredHost) {
+	ctx, cancel := context.WithTimeout(ctx, reverseDNSTotal)
+	defer cancel()
+
+	sem := make(chan struct{}, reverseDNSWorkers)
+	var wg sync.WaitGroup
+	for i := range hosts {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(h *DiscoveredHost) {
+			defer func() { <-sem; wg.Done() }()
+
+			ctx, cancel := context.WithTimeout(ctx, reverseDNSTimeout)
+			defer cancel()
+			if names, err := net.DefaultResolver.LookupAddr(ctx, h.IP); err == nil && len(names) > 0 {
+				h.Hostname = strings.TrimSuffix(names[0], ".")
+			}
+		}(&hosts[i])
+	}
+	wg.Wait()
+}
+
+// parseSweep 解析要扫描的网段，必须是本机接口所在的IPv4子网内，且不超过 maxSweepHosts 个地址
+func parseSweep(s string) (*net.IPNet, error) {
+	_, network, err := net.ParseCIDR(strings.TrimSpace(s))
+	if err != nil || network.IP.To4() == nil {
+		return nil, fmt.Errorf("%w: %s，需要IPv4网段，如 192.168.1.0/24", errInvalidSweep, s)
+	}
+	ones, bits := network.Mask.Size()
+	if 1<<(bits-ones) > maxSweepHosts {
+		return nil, fmt.Errorf("%w: %s 超过 %d 个地址", errInvalidSweep, s, maxSweepHosts)
+	}
+
+	ifaces, _ := listInterfaces()
+	for _, iface := range ifaces {
+		for _, addr := range iface.Addresses {
+			_, local, err := net.ParseCIDR(addr.Network)
+			if err != nil {
+				continue
+			}
+			localOnes, _ := local.Mask.Size()
+			if local.Contains(network.IP) && localOnes <= ones {
+				return network, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("%w: %s 不在本机接口的子网内，ARP只能发现直连网段的主机", errInvalidSweep, s)
+}
+
+// sweepNetwork 向网段内每个地址发送一个UDP包，由内核发出ARP请求，应答的主机会出现在邻居表中；
+// 不需要原始套接字权限
+func sweepNetwork(ctx context.Context, network *net.IPNet) error {
+	conn, err := net.ListenUDP("udp4", nil)
+	if err != nil {
+		return fmt.Errorf("无法进行扫描: %v", err)
+	}
+	defer conn.Close()
+
+	base := network.IP.To4()
+	ones, _ := network.Mask.Size()
+	count := 1 << (32 - ones)
+	for i := 0; i < count; i++ {
+		ip := make(net.IP, net.IPv4len)
+		for b := 0; b < net.IPv4len; b++ {
+			ip[b] = base[b] | byte(i>>(8*(3-b)))
+		}
+		// 跳过网络地址和广播地址（/31、/32没有这两个地址）
+		if count > 2 && (i == 0 || i == count-1) {
+			continue
+		}
+		conn.WriteToUDP([]byte{0}, &net.UDPAddr{IP: ip, Port: defaultWakePort})
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(sweepProbeInterval):
+		}
+	}
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(sweepWait):
+		return nil
+	}
+}
+
+// discoveryTimeout 返回一次发现最长需要的时间，用于延长响应的写超时
+func discoveryTimeout(sweep *net.IPNet, resolve bool) time.Duration {
+	var timeout time.Duration
+	if sweep != nil {
+		ones, _ := sweep.Mask.Size()
+		timeout += time.Duration(1<<(32-ones))*sweepProbeInterval + sweepWait
+	}
+	if resolve {
+		timeout += reverseDNSTotal
+	}
+	return timeout
+}
+
+// localNetworks 返回可以扫描的本机IPv4子网
+func localNetworks() []string {
+	var networks []string
+	ifaces, _ := listInterfaces()
+	for _, iface := range ifaces {
+		for _, addr := range iface.Addresses {
+			networks = append(networks, addr.Network)
+		}
+	}
+	return networks
+}
+
+// importHost 将发现的主机登记为设备，name 为空时依次使用主机名和IP地址；
+// 主机在本机接口的子网内时，使用该子网的定向广播地址
+func importHost(h DiscoveredHost, name string) (Device, error) {
+	mac, err := wol.ParseMAC(h.MAC)
+	if err != nil {
+		return Device{}, err
+	}
+	h.MAC = wol.FormatMAC(mac)
+	if d, ok := registry.Find(h.MAC); ok && d.MAC == h.MAC {
+		return Device{}, fmt.Errorf("MAC地址 %s 已登记为设备 %s", d.MAC, d.Name)
+	}
+
+	d := Device{Name: strings.TrimSpace(name), MAC: h.MAC}
+	if h.IP != "" {
+		d.Notes = "自动发现于 " + h.IP
+	}
+	if d.Name == "" {
+		d.Name = h.Hostname
+	}
+	if d.Name == "" {
+		d.Name = h.IP
+	}
+	if ip := net.ParseIP(h.IP); ip != nil && ip.To4() != nil {
+		ifaces, _ := listInterfaces()
+		for _, iface := range ifaces {
+			for _, addr := range iface.Addresses {
+				if _, local, err := net.ParseCIDR(addr.Network); err == nil && local.Contains(ip) {
+					d.Broadcast = addr.Broadcast
+				}
+			}
+		}
+	}
+	return registry.Add(d)
+}
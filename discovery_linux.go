@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"syscall"
+
+	"github.com/tdh62/wake_on_lan_proxy/wol"
+)
+
+// netlink邻居消息（ndmsg）的常量，见 linux/neighbour.h
+const (
+	ndmsgLen   = 12 // family(1) pad(3) ifindex(4) state(2) flags(1) type(1)
+	ndaDst     = 1
+	ndaLLAddr  = 2
+	nudInvalid = 0x01 | 0x20 | 0x40 // NUD_INCOMPLETE | NUD_FAILED | NUD_NOARP
+	nudReach   = 0x02               // NUD_REACHABLE
+)
+
+// netlinkNeighbors 通过netlink读取内核邻居表，包括IPv4和IPv6邻居
+func netlinkNeighbors() ([]neighbor, error) {
+	data, err := syscall.NetlinkRIB(syscall.RTM_GETNEIGH, syscall.AF_UNSPEC)
+	if err != nil {
+		return nil, fmt.Errorf("无法读取netlink邻居表: %v", err)
+	}
+	msgs, err := syscall.ParseNetlinkMessage(data)
+	if err != nil {
+		return nil, fmt.Errorf("无法解析netlink邻居表: %v", err)
+	}
+
+	names := make(map[int]string)
+	return parseNeighborMessages(msgs, func(index int) string {
+		if name, ok := names[index]; ok {
+			return name
+		}
+		if iface, err := net.InterfaceByIndex(index); err == nil {
+			names[index] = iface.Name
+		}
+		return names[index]
+	}), nil
+}
+
+// parseNeighborMessages 解析 RTM_NEWNEIGH 消息，跳过未解析完成、失败和没有链路层地址的记录
+func parseNeighborMessages(msgs []syscall.NetlinkMessage, ifname func(index int) string) []neighbor {
+	var neighbors []neighbor
+	for _, m := range msgs {
+		if m.Header.Type != syscall.RTM_NEWNEIGH || len(m.Data) < ndmsgLen {
+			continue
+		}
+		index := int(int32(binary.NativeEndian.Uint32(m.Data[4:8])))
+		state := binary.NativeEndian.Uint16(m.Data[8:10])
+		if state == 0 || state&nudInvalid != 0 {
+			continue
+		}
+
+		var ip net.IP
+		var mac net.HardwareAddr
+		attrs := m.Data[ndmsgLen:]
+		for len(attrs) >= syscall.SizeofRtAttr {
+			size := int(binary.NativeEndian.Uint16(attrs[0:2]))
+			kind := binary.NativeEndian.Uint16(attrs[2:4])
+			if size < syscall.SizeofRtAttr || size > len(attrs) {
+				break
+			}
+			value := attrs[syscall.SizeofRtAttr:size]
+			switch kind {
+			case ndaDst:
+				ip = net.IP(append([]byte(nil), value...))
+			case ndaLLAddr:
+				mac = net.HardwareAddr(append([]byte(nil), value...))
+			}
+			// 属性按4字节对齐
+			aligned := (size + syscall.RTA_ALIGNTO - 1) &^ (syscall.RTA_ALIGNTO - 1)
+			if aligned > len(attrs) {
+				break
+			}
+			attrs = attrs[aligned:]
+		}
+
+		if (len(ip) != net.IPv4len && len(ip) != net.IPv6len) || len(mac) != 6 {
+			continue
+		}
+		neighbors = append(neighbors, neighbor{IP: ip, MAC: wol.FormatMAC(mac), Interface: ifname(index), Reachable: state&nudReach != 0})
+	}
+	return neighbors
+}
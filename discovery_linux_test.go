@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/binary"
+	"net"
+	"syscall"
+	"testing"
+)
+
+// neighborMessage 构造一条 RTM_NEWNEIGH 消息
+func neighborMessage(index int32, state uint16, ip net.IP, mac net.HardwareAddr) syscall.NetlinkMessage {
+	data := make([]byte, ndmsgLen)
+	binary.NativeEndian.PutUint32(data[4:8], uint32(index))
+	binary.NativeEndian.PutUint16(data[8:10], state)
+	for _, attr := range []struct {
+		kind  uint16
+		value []byte
+	}{{ndaDst, ip}, {ndaLLAddr, mac}} {
+		if attr.value == nil {
+			continue
+		}
+		b := make([]byte, (syscall.SizeofRtAttr+len(attr.value)+3)&^3)
+		binary.NativeEndian.PutUint16(b[0:2], uint16(syscall.SizeofRtAttr+len(attr.value)))
+		binary.NativeEndian.PutUint16(b[2:4], attr.kind)
+		copy(b[syscall.SizeofRtAttr:], attr.value)
+		data = append(data, b...)
+	}
+	return syscall.NetlinkMessage{Header: syscall.NlMsghdr{Type: syscall.RTM_NEWNEIGH}, Data: data}
+}
+
+func TestParseNeighborMessages(t *testing.T) {
+	const (
+		reachable  = 0x02
+		stale      = 0x04
+		incomplete = 0x01
+		failed     = 0x20
+	)
+	mac := net.HardwareAddr{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0x01}
+	msgs := []syscall.NetlinkMessage{
+		neighborMessage(2, reachable, net.ParseIP("192.168.1.3").To4(), mac),
+		neighborMessage(2, stale, net.ParseIP("fe80::1"), mac),
+		neighborMessage(2, incomplete, net.ParseIP("192.168.1.4").To4(), nil),
+		neighborMessage(2, failed, net.ParseIP("192.168.1.5").To4(), mac),
+		neighborMessage(3, reachable, net.ParseIP("192.168.1.6").To4(), nil),
+		{Header: syscall.NlMsghdr{Type: syscall.NLMSG_DONE}},
+	}
+
+	got := parseNeighborMessages(msgs, func(index int) string {
+		return map[int]string{2: "eth0"}[index]
+	})
+	if len(got) != 2 {
+		t.Fatalf("parseNeighborMessages() = %+v, want 2 neighbors", got)
+	}
+	for i, wantIP := range []string{"192.168.1.3", "fe80::1"} {
+		if !got[i].IP.Equal(net.ParseIP(wantIP)) || got[i].MAC != "AA:BB:CC:DD:EE:01" || got[i].Interface != "eth0" {
+			t.Errorf("neighbor %d = %+v, want %s AA:BB:CC:DD:EE:01 on eth0", i, got[i], wantIP)
+		}
+	}
+	if !got[0].Reachable || got[1].Reachable {
+		t.Errorf("Reachable = %v, %v, want only the REACHABLE entry", got[0].Reachable, got[1].Reachable)
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package main
+
+import "errors"
+
+// netlinkNeighbors 非Linux平台没有netlink，只能读取 /proc/net/arp
+func netlinkNeighbors() ([]neighbor, error) {
+	return nil, errors.New("netlink邻居表仅支持Linux")
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// useTestNeighbors 用固定的记录替换系统邻居表
+func useTestNeighbors(t *testing.T, neighbors ...neighbor) {
+	t.Helper()
+
+	old := readNeighbors
+	readNeighbors = func() ([]neighbor, error) { return neighbors, nil }
+	t.Cleanup(func() { readNeighbors = old })
+}
+
+func TestDiscoverHosts(t *testing.T) {
+	reg := useTestRegistry(t)
+	devices := addTestDevices(t, reg, Device{Name: "nas", MAC: "AA:BB:CC:DD:EE:01"})
+	useTestNeighbors(t,
+		neighbor{IP: net.ParseIP("fe80::1"), MAC: "aa:bb:cc:dd:ee:02", Interface: "eth0"},
+		neighbor{IP: net.ParseIP("192.168.1.20"), MAC: "aa:bb:cc:dd:ee:02", Interface: "eth0"},
+		neighbor{IP: net.ParseIP("192.168.1.3"), MAC: "aa-bb-cc-dd-ee-01", Interface: "eth0"},
+		neighbor{IP: net.ParseIP("192.168.1.3"), MAC: "AA:BB:CC:DD:EE:01", Interface: "eth0"}, // /proc/net/arp 和netlink中的重复记录
+		neighbor{IP: net.ParseIP("192.168.1.4"), MAC: "00:00:00:00:00:00", Interface: "eth0"},
+		neighbor{IP: net.ParseIP("224.0.0.251"), MAC: "01:00:5e:00:00:fb", Interface: "eth0"},
+		neighbor{IP: net.ParseIP("192.168.1.5"), MAC: "ff:ff:ff:ff:ff:ff", Interface: "eth0"},
+		neighbor{IP: net.ParseIP("127.0.0.1"), MAC: "aa:bb:cc:dd:ee:03", Interface: "lo"},
+	)
+
+	hosts, err := discoverHosts(context.Background(), nil, false)
+	if err != nil {
+		t.Fatalf("discoverHosts() error = %v", err)
+	}
+	want := []DiscoveredHost{
+		{IP: "192.168.1.3", MAC: "AA:BB:CC:DD:EE:01", Interface: "eth0", DeviceID: devices["nas"].ID, Device: "nas"},
+		{IP: "192.168.1.20", MAC: "AA:BB:CC:DD:EE:02", Interface: "eth0"},
+		{IP: "fe80::1", MAC: "AA:BB:CC:DD:EE:02", Interface: "eth0"},
+	}
+	if len(hosts) != len(want) {
+		t.Fatalf("hosts = %+v, want %+v", hosts, want)
+	}
+	for i := range want {
+		if hosts[i] != want[i] {
+			t.Errorf("hosts[%d] = %+v, want %+v", i, hosts[i], want[i])
+		}
+	}
+}
+
+func TestDiscoverHostsError(t *testing.T) {
+	useTestRegistry(t)
+	old := readNeighbors
+	readNeighbors = func() ([]neighbor, error) { return nil, errors.New("无法读取邻居表") }
+	t.Cleanup(func() { readNeighbors = old })
+
+	if _, err := discoverHosts(context.Background(), nil, false); err == nil {
+		t.Fatal("discoverHosts() error = nil, want error")
+	}
+}
+
+func TestParseSweep(t *testing.T) {
+	for _, s := range []string{"", "192.168.1.1", "fe80::/64", "10.0.0.0/16", "198.51.100.0/24"} {
+		if _, err := parseSweep(s); !errors.Is(err, errInvalidSweep) {
+			t.Errorf("parseSweep(%q) error = %v, want errInvalidSweep", s, err)
+		}
+	}
+
+	networks := localNetworks()
+	if len(networks) == 0 {
+		t.Skip("no local IPv4 networks")
+	}
+	_, local, _ := net.ParseCIDR(networks[0])
+	ones, _ := local.Mask.Size()
+	if ones < 22 {
+		t.Skipf("local network %s is larger than the sweep limit", local)
+	}
+	network, err := parseSweep(local.String())
+	if err != nil || network.String() != local.String() {
+		t.Errorf("parseSweep(%q) = %v, %v, want %s", local, network, err, local)
+	}
+}
+
+func TestImportHost(t *testing.T) {
+	useTestRegistry(t)
+
+	tests := []struct {
+		host     DiscoveredHost
+		name     string
+		wantName string
+	}{
+		{host: DiscoveredHost{IP: "192.0.2.10", MAC: "aa:bb:cc:dd:ee:10", Hostname: "nas.lan"}, name: "书房NAS", wantName: "书房NAS"},
+		{host: DiscoveredHost{IP: "192.0.2.11", MAC: "aa:bb:cc:dd:ee:11", Hostname: "pc.lan"}, wantName: "pc.lan"},
+		{host: DiscoveredHost{IP: "192.0.2.12", MAC: "aa:bb:cc:dd:ee:12"}, wantName: "192.0.2.12"},
+	}
+	for _, tt := range tests {
+		d, err := importHost(tt.host, tt.name)
+		if err != nil {
+			t.Fatalf("importHost(%+v) error = %v", tt.host, err)
+		}
+		if d.Name != tt.wantName || d.MAC != strings.ToUpper(tt.host.MAC) || !strings.Contains(d.Notes, tt.host.IP) {
+			t.Errorf("importHost(%+v) = %+v, want name %q", tt.host, d, tt.wantName)
+		}
+	}
+
+	if _, err := importHost(DiscoveredHost{IP: "192.0.2.13", MAC: "AA-BB-CC-DD-EE-10"}, "dup"); err == nil {
+		t.Error("importHost() of a registered MAC error = nil, want error")
+	}
+	if _, err := importHost(DiscoveredHost{MAC: "invalid"}, "bad"); err == nil {
+		t.Error("importHost() of an invalid MAC error = nil, want error")
+	}
+}
+
+func TestHandleAPIDiscovery(t *testing.T) {
+	useTestRegistry(t)
+	useTestNeighbors(t, neighbor{IP: net.ParseIP("192.168.1.20"), MAC: "aa:bb:cc:dd:ee:02", Interface: "eth0"})
+
+	rec := httptest.NewRecorder()
+	handleAPIDiscovery(rec, httptest.NewRequest(http.MethodGet, "/api/v1/discovery", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200 (body: %s)", rec.Code, rec.Body.String())
+	}
+	var resp apiDiscoveryResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("response is not JSON: %v", err)
+	}
+	if len(resp.Hosts) != 1 || resp.Hosts[0].MAC != "AA:BB:CC:DD:EE:02" {
+		t.Errorf("hosts = %+v, want the neighbor", resp.Hosts)
+	}
+
+	rec = httptest.NewRecorder()
+	handleAPIDiscovery(rec, httptest.NewRequest(http.MethodGet, "/api/v1/discovery?sweep=10.0.0.0/8", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("status for oversized sweep = %d, want 400", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	handleAPIDiscovery(rec, httptest.NewRequest(http.MethodPost, "/api/v1/discovery", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("status for POST = %d, want 405", rec.Code)
+	}
+}
+
+func TestHandleAPIDiscoveryImport(t *testing.T) {
+	reg := useTestRegistry(t)
+	addTestDevices(t, reg, Device{Name: "nas", MAC: "AA:BB:CC:DD:EE:01"})
+
+	body := `{"hosts":[{"mac":"aa:bb:cc:dd:ee:01","ip":"192.0.2.1"},{"mac":"aa:bb:cc:dd:ee:02","ip":"192.0.2.2","hostname":"pc.lan"}]}`
+	rec := httptest.NewRecorder()
+	handleAPIDiscoveryImport(rec, httptest.NewRequest(http.MethodPost, "/api/v1/discovery/import", strings.NewReader(body)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200 (body: %s)", rec.Code, rec.Body.String())
+	}
+	var resp apiDiscoveryImportResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("response is not JSON: %v", err)
+	}
+	if resp.Imported != 1 || resp.Failed != 1 || resp.Results[0].Error == "" || resp.Results[1].Device == nil {
+		t.Fatalf("response = %+v, want the registered MAC to fail and the other to be imported", resp)
+	}
+	if d, ok := reg.Find("pc.lan"); !ok || d.MAC != "AA:BB:CC:DD:EE:02" {
+		t.Errorf("imported device = %+v, %v, want pc.lan", d, ok)
+	}
+
+	for _, body := range []string{"{", `{"hosts":[]}`} {
+		rec := httptest.NewRecorder()
+		handleAPIDiscoveryImport(rec, httptest.NewRequest(http.MethodPost, "/api/v1/discovery/import", strings.NewReader(body)))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("status for %s = %d, want 400", body, rec.Code)
+		}
+	}
+}
+
+func TestHandleDiscovery(t *testing.T) {
+	reg := useTestRegistry(t)
+	addTestDevices(t, reg, Device{Name: "nas", MAC: "AA:BB:CC:DD:EE:01"})
+	useTestNeighbors(t,
+		neighbor{IP: net.ParseIP("192.168.1.3"), MAC: "aa:bb:cc:dd:ee:01", Interface: "eth0"},
+		neighbor{IP: net.ParseIP("192.168.1.20"), MAC: "aa:bb:cc:dd:ee:02", Interface: "eth0"},
+	)
+
+	rec := httptest.NewRecorder()
+	handleDiscovery(rec, httptest.NewRequest(http.MethodGet, "/discovery", nil))
+	body := rec.Body.String()
+	for _, want := range []string{"已登记为 nas", `action="/discovery/import"`, `value="AA:BB:CC:DD:EE:02"`} {
+		if !strings.Contains(body, want) {
+			t.Errorf("discovery page does not contain %q", want)
+		}
+	}
+
+	form := url.Values{"mac": {"AA:BB:CC:DD:EE:02"}, "ip": {"192.168.1.20"}, "name": {"客厅电视"}}
+	req := httptest.NewRequest(http.MethodPost, "/discovery/import", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec = httptest.NewRecorder()
+	handleDiscoveryImport(rec, req)
+	if body := rec.Body.String(); !strings.Contains(body, "设备 客厅电视 已导入") || !strings.Contains(body, "已登记为 客厅电视") {
+		t.Errorf("import did not register the host, page = %s", body)
+	}
+}
@@ -0,0 +1,8 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd || dragonfly || windows)
+
+package main
+
+// lockFile 其他平台不支持文件锁，修改前仍会重新读取设备文件，但不能排除同时写入
+func lockFile(path string) (unlock func(), err error) {
+	return func() {}, nil
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+var (
+	errInvalidGroup  = errors.New("无效的设备分组")
+	errGroupNotFound = errors.New("分组不存在")
+)
+
+// Group 一组一起唤醒的设备
+type Group struct {
+	ID         string      `json:"id"`
+	Name       string      `json:"name"`
+	Sequential bool        `json:"sequential,omitempty"` // 按步骤顺序唤醒，否则同时唤醒所有设备
+	Steps      []GroupStep `json:"steps"`
+}
+
+// GroupStep 唤醒序列中的一步
+type GroupStep struct {
+	Device     string   `json:"device"`                // 设备ID
+	Delay      Duration `json:"delay,omitempty"`       // 唤醒后等待多久再进行下一步
+	WaitOnline bool     `json:"wait_online,omitempty"` // 等待设备上线（使用设备的上线验证配置）后再进行下一步
+}
+
+// StepResult 唤醒序列中一步的结果
+type StepResult struct {
+	Device     string        `json:"device"`
+	DeviceName string        `json:"device_name"`
+	Success    bool          `json:"success"`
+	Skipped    bool          `json:"skipped,omitempty"` // 前面的步骤失败，没有执行
+	Error      string        `json:"error,omitempty"`
+	Verify     *VerifyResult `json:"verify,omitempty"`
+}
+
+// Summary 返回用于页面提示的步骤结果
+func (s StepResult) Summary() string {
+	switch {
+	case s.Skipped:
+		return "已跳过: 前面的步骤失败"
+	case s.Error != "":
+		return "失败: " + s.Error
+	case s.Verify != nil:
+		return s.Verify.Summary()
+	default:
+		return "唤醒包已发送"
+	}
+}
+
+// GroupResult 唤醒分组的结果
+type GroupResult struct {
+	Group   string       `json:"group"`
+	Success bool         `json:"success"`
+	Error   string       `json:"error,omitempty"`
+	Steps   []StepResult `json:"steps"`
+}
+
+// normalizeGroup 整理分组字段并检查步骤
+func normalizeGroup(g *Group) error {
+	g.Name = strings.TrimSpace(g.Name)
+	if g.Name == "" {
+		return fmt.Errorf("%w: 分组名称不能为空", errInvalidGroup)
+	}
+	if len(g.Steps) == 0 {
+		return fmt.Errorf("%w: 分组中至少需要一台设备", errInvalidGroup)
+	}
+	for _, step := range g.Steps {
+		if step.Delay < 0 {
+			return fmt.Errorf("%w: 等待时间不能为负数", errInvalidGroup)
+		}
+	}
+	return nil
+}
+
+// removeGroupDevice 从所有分组中移除设备，返回新的分组列表；
+// 移除后没有设备的分组一并删除
+func removeGroupDevice(groups []Group, deviceID string) []Group {
+	result := make([]Group, 0, len(groups))
+	for _, g := range groups {
+		steps := make([]GroupStep, 0, len(g.Steps))
+		for _, step := range g.Steps {
+			if step.Device != deviceID {
+				steps = append(steps, step)
+			}
+		}
+		if len(steps) == 0 {
+			continue
+		}
+		g.Steps = steps
+		result = append(result, g)
+	}
+	return result
+}
+
+// parseGroupSteps 解析页面表单中的步骤，每行一台设备，可在末尾加上等待时间或"等待上线"：
+//
+//	storage 等待上线
+//	compute-1 30s
+//	compute-2
+func parseGroupSteps(text string) ([]GroupStep, error) {
+	var steps []GroupStep
+	for _, line := range strings.Split(text, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		var step GroupStep
+		if len(fields) > 1 {
+			last := fields[len(fields)-1]
+			if last == "等待上线" || strings.EqualFold(last, "wait") {
+				step.WaitOnline = true
+				fields = fields[:len(fields)-1]
+			} else if d, err := time.ParseDuration(last); err == nil {
+				step.Delay = Duration(d)
+				fields = fields[:len(fields)-1]
+			}
+		}
+
+		ref := strings.Join(fields, " ")
+		device, ok := registry.Find(ref)
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", errDeviceNotFound, ref)
+		}
+		step.Device = device.ID
+		steps = append(steps, step)
+	}
+	return steps, nil
+}
+
+// timeout 估计唤醒分组最长需要的时间，用于延长HTTP写入超时
+func (g Group) timeout() time.Duration {
+	var total time.Duration
+	for _, step := range g.Steps {
+		d, ok := registry.Get(step.Device)
+		if !ok {
+			continue
+		}
+		// 两种模式下各步骤都依次发送唤醒包，重复发送的时间都要计入
+		total += d.target().withDefaults().repeatDuration()
+		if !g.Sequential {
+			continue
+		}
+		total += time.Duration(step.Delay)
+		if step.WaitOnline && d.Verify != nil {
+			total += d.Verify.timeout()
+		}
+	}
+	return total
+}
+
+// wakeGroup 唤醒分组中的设备
+//
+// 顺序模式下每一步发送唤醒包后，等待设定的时间或等待设备上线再进行下一步；
+// 某一步失败时跳过后面的步骤，避免依赖它的设备在它之前启动
+func wakeGroup(ctx context.Context, g Group, wake func(WakeTarget) error) GroupResult {
+	result := GroupResult{Group: g.Name, Success: true, Steps: make([]StepResult, 0, len(g.Steps))}
+	if len(g.Steps) == 0 {
+		result.Success = false
+		result.Error = "分组中没有设备"
+		return result
+	}
+
+	failed := false
+	for _, step := range g.Steps {
+		sr := StepResult{Device: step.Device}
+		device, ok := registry.Get(step.Device)
+		if ok {
+			sr.DeviceName = device.Name
+		}
+
+		switch {
+		case failed:
+			sr.Skipped = true
+		case !ok:
+			sr.Error = errDeviceNotFound.Error()
+		default:
+			if err := wake(device.target().withDefaults()); err != nil {
+				sr.Error = err.Error()
+				break
+			}
+			sr.Success = true
+			if !g.Sequential {
+				break
+			}
+			if step.WaitOnline {
+				if device.Verify == nil {
+					sr.Success = false
+					sr.Error = "设备没有配置上线验证，无法等待上线"
+					break
+				}
+				v := verifyWake(ctx, *device.Verify, device.MAC)
+				sr.Verify = &v
+				sr.Success = v.Online
+			}
+			if sr.Success && step.Delay > 0 {
+				select {
+				case <-ctx.Done():
+					sr.Success = false
+					sr.Error = ctx.Err().Error()
+				case <-time.After(time.Duration(step.Delay)):
+				}
+			}
+		}
+
+		if !sr.Success {
+			result.Success = false
+			// 同时唤醒时各设备互不影响
+			failed = g.Sequential
+		}
+		log.Printf("分组 %s: 设备 %s %s", g.Name, sr.DeviceName, sr.Summary())
+		result.Steps = append(result.Steps, sr)
+	}
+	return result
+}
+
+// GroupView 用于页面展示的分组，步骤中的设备ID替换为设备名称
+type GroupView struct {
+	Group
+	StepNames []string
+}
+
+func groupViews(groups []Group, devices []Device) []GroupView {
+	names := make(map[string]string, len(devices))
+	for _, d := range devices {
+		names[d.ID] = d.Name
+	}
+
+	views := make([]GroupView, 0, len(groups))
+	for _, g := range groups {
+		v := GroupView{Group: g}
+		for _, step := range g.Steps {
+			name := names[step.Device]
+			if g.Sequential && step.WaitOnline {
+				name += " (等待上线)"
+			} else if g.Sequential && step.Delay > 0 {
+				name += fmt.Sprintf(" (等待 %s)", step.Delay)
+			}
+			v.StepNames = append(v.StepNames, name)
+		}
+		views = append(views, v)
+	}
+	return views
+}
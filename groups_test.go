@@ -0,0 +1,348 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// addTestDevices 登记一组测试设备，返回按名称索引的设备
+func addTestDevices(t *testing.T, reg *DeviceRegistry, devices ...Device) map[string]Device {
+	t.Helper()
+
+	added := make(map[string]Device, len(devices))
+	for _, d := range devices {
+		d, err := reg.Add(d)
+		if err != nil {
+			t.Fatalf("Add() error = %v", err)
+		}
+		added[d.Name] = d
+	}
+	return added
+}
+
+func TestParseGroupSteps(t *testing.T) {
+	reg := useTestRegistry(t)
+	devices := addTestDevices(t, reg,
+		Device{Name: "storage", MAC: "11:11:11:11:11:11"},
+		Device{Name: "compute 1", MAC: "22:22:22:22:22:22"},
+		Device{Name: "compute-2", MAC: "33:33:33:33:33:33"},
+	)
+
+	steps, err := parseGroupSteps("storage 等待上线\r\n\ncompute 1 30s\n33-33-33-33-33-33\n")
+	if err != nil {
+		t.Fatalf("parseGroupSteps() error = %v", err)
+	}
+	want := []GroupStep{
+		{Device: devices["storage"].ID, WaitOnline: true},
+		{Device: devices["compute 1"].ID, Delay: Duration(30 * time.Second)},
+		{Device: devices["compute-2"].ID},
+	}
+	if len(steps) != len(want) {
+		t.Fatalf("parseGroupSteps() = %+v, want %+v", steps, want)
+	}
+	for i := range want {
+		if steps[i] != want[i] {
+			t.Errorf("steps[%d] = %+v, want %+v", i, steps[i], want[i])
+		}
+	}
+
+	if _, err := parseGroupSteps("storage\nmissing"); !errors.Is(err, errDeviceNotFound) {
+		t.Errorf("parseGroupSteps() unknown device error = %v", err)
+	}
+}
+
+func TestWakeGroupSequence(t *testing.T) {
+	reg := useTestRegistry(t)
+	useFastVerify(t)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	defer ln.Close()
+	port := ln.Addr().(*net.TCPAddr).Port
+
+	devices := addTestDevices(t, reg,
+		Device{Name: "storage", MAC: "11:11:11:11:11:11", Verify: &VerifyConfig{Method: verifyTCP, Host: "127.0.0.1", Port: port}},
+		Device{Name: "compute", MAC: "22:22:22:22:22:22"},
+	)
+	group := Group{Name: "rack", Sequential: true, Steps: []GroupStep{
+		{Device: devices["storage"].ID, WaitOnline: true},
+		{Device: devices["compute"].ID, Delay: Duration(50 * time.Millisecond)},
+	}}
+
+	var order []string
+	result := wakeGroup(context.Background(), group, func(target WakeTarget) error {
+		order = append(order, target.MAC)
+		return nil
+	})
+
+	if !result.Success || len(result.Steps) != 2 {
+		t.Fatalf("wakeGroup() = %+v, want two successful steps", result)
+	}
+	if strings.Join(order, ",") != "11:11:11:11:11:11,22:22:22:22:22:22" {
+		t.Errorf("wake order = %v", order)
+	}
+	if v := result.Steps[0].Verify; v == nil || !v.Online {
+		t.Errorf("storage step verify = %+v, want online", v)
+	}
+}
+
+func TestWakeGroupFailure(t *testing.T) {
+	reg := useTestRegistry(t)
+	devices := addTestDevices(t, reg,
+		Device{Name: "storage", MAC: "11:11:11:11:11:11"},
+		Device{Name: "compute", MAC: "22:22:22:22:22:22"},
+	)
+	steps := []GroupStep{{Device: devices["storage"].ID}, {Device: devices["compute"].ID}}
+	failStorage := func(target WakeTarget) error {
+		if target.MAC == "11:11:11:11:11:11" {
+			return errors.New("send failed")
+		}
+		return nil
+	}
+
+	// 顺序模式下失败后跳过后续步骤
+	result := wakeGroup(context.Background(), Group{Name: "rack", Sequential: true, Steps: steps}, failStorage)
+	if result.Success || result.Steps[0].Error != "send failed" || !result.Steps[1].Skipped {
+		t.Errorf("sequential result = %+v, want the second step skipped", result)
+	}
+
+	// 同时唤醒时其他设备不受影响
+	result = wakeGroup(context.Background(), Group{Name: "rack", Steps: steps}, failStorage)
+	if result.Success || result.Steps[1].Skipped || !result.Steps[1].Success {
+		t.Errorf("parallel result = %+v, want the second step woken", result)
+	}
+}
+
+func TestRegistryGroups(t *testing.T) {
+	reg := useTestRegistry(t)
+	devices := addTestDevices(t, reg,
+		Device{Name: "storage", MAC: "11:11:11:11:11:11"},
+		Device{Name: "compute", MAC: "22:22:22:22:22:22"},
+	)
+
+	group, err := reg.AddGroup(Group{Name: " rack ", Sequential: true, Steps: []GroupStep{
+		{Device: devices["storage"].ID},
+		{Device: devices["compute"].ID},
+	}})
+	if err != nil {
+		t.Fatalf("AddGroup() error = %v", err)
+	}
+	if group.ID == "" || group.Name != "rack" {
+		t.Errorf("AddGroup() = %+v", group)
+	}
+
+	if _, err := reg.AddGroup(Group{Name: "RACK", Steps: group.Steps}); !errors.Is(err, errInvalidGroup) {
+		t.Errorf("AddGroup() duplicate name error = %v", err)
+	}
+	if _, err := reg.AddGroup(Group{Name: "other", Steps: []GroupStep{{Device: "missing"}}}); !errors.Is(err, errDeviceNotFound) {
+		t.Errorf("AddGroup() unknown device error = %v", err)
+	}
+
+	// 删除设备时同时从分组中移除
+	if err := reg.Remove(devices["storage"].ID); err != nil {
+		t.Fatalf("Remove() error = %v", err)
+	}
+	reopened, err := openDeviceRegistry(reg.path)
+	if err != nil {
+		t.Fatalf("openDeviceRegistry() error = %v", err)
+	}
+	g, ok := reopened.FindGroup("Rack")
+	if !ok || len(g.Steps) != 1 || g.Steps[0].Device != devices["compute"].ID {
+		t.Errorf("reopened group = %+v, %v", g, ok)
+	}
+
+	if err := reg.RemoveGroup(group.ID); err != nil {
+		t.Fatalf("RemoveGroup() error = %v", err)
+	}
+	if err := reg.RemoveGroup(group.ID); err != errGroupNotFound {
+		t.Errorf("RemoveGroup() twice error = %v", err)
+	}
+}
+
+func TestHandleAPIGroupWakeNotFound(t *testing.T) {
+	useTestRegistry(t)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/groups/wake", strings.NewReader(`{"group":"missing"}`))
+	rec := httptest.NewRecorder()
+	handleAPIGroupWake(rec, req)
+
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want 404", rec.Code)
+	}
+}
+
+func TestHandleGroupWakeRendersSteps(t *testing.T) {
+	reg := useTestRegistry(t)
+
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("ListenUDP() error = %v", err)
+	}
+	defer conn.Close()
+	port := conn.LocalAddr().(*net.UDPAddr).Port
+
+	devices := addTestDevices(t, reg, Device{Name: "storage", MAC: "11:11:11:11:11:11", Broadcast: "127.0.0.1", Port: port})
+	if _, err := reg.AddGroup(Group{Name: "rack", Steps: []GroupStep{{Device: devices["storage"].ID}}}); err != nil {
+		t.Fatalf("AddGroup() error = %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/groups/wake", strings.NewReader("id=rack"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+	handleGroupWake(rec, req)
+
+	body := rec.Body.String()
+	if !strings.Contains(body, "分组 rack 已全部唤醒") || !strings.Contains(body, "<li>storage: 唤醒包已发送</li>") {
+		t.Errorf("page does not show the step results:\n%s", body)
+	}
+}
+
+func TestRegistryUpdateGroup(t *testing.T) {
+	reg := useTestRegistry(t)
+	devices := addTestDevices(t, reg,
+		Device{Name: "storage", MAC: "11:11:11:11:11:11"},
+		Device{Name: "compute", MAC: "22:22:22:22:22:22"},
+	)
+	rack, err := reg.AddGroup(Group{Name: "rack", Steps: []GroupStep{{Device: devices["storage"].ID}}})
+	if err != nil {
+		t.Fatalf("AddGroup() error = %v", err)
+	}
+	if _, err := reg.AddGroup(Group{Name: "other", Steps: rack.Steps}); err != nil {
+		t.Fatalf("AddGroup() error = %v", err)
+	}
+
+	// 保留原名称时不算重名
+	updated, err := reg.UpdateGroup(Group{ID: rack.ID, Name: "Rack", Sequential: true, Steps: []GroupStep{
+		{Device: devices["compute"].ID},
+	}})
+	if err != nil {
+		t.Fatalf("UpdateGroup() error = %v", err)
+	}
+	if g, ok := reg.FindGroup(rack.ID); !ok || g.Name != "Rack" || !g.Sequential || g.Steps[0].Device != devices["compute"].ID {
+		t.Errorf("FindGroup() = %+v, want %+v", g, updated)
+	}
+
+	if _, err := reg.UpdateGroup(Group{ID: rack.ID, Name: "OTHER", Steps: rack.Steps}); !errors.Is(err, errInvalidGroup) {
+		t.Errorf("UpdateGroup() duplicate name error = %v", err)
+	}
+	if _, err := reg.UpdateGroup(Group{ID: rack.ID, Name: "rack"}); !errors.Is(err, errInvalidGroup) {
+		t.Errorf("UpdateGroup() empty steps error = %v", err)
+	}
+	if _, err := reg.UpdateGroup(Group{ID: "missing", Name: "x", Steps: rack.Steps}); err != errGroupNotFound {
+		t.Errorf("UpdateGroup() unknown group error = %v", err)
+	}
+}
+
+func TestRemoveLastGroupDevice(t *testing.T) {
+	reg := useTestRegistry(t)
+	devices := addTestDevices(t, reg, Device{Name: "storage", MAC: "11:11:11:11:11:11"})
+	if _, err := reg.AddGroup(Group{Name: "rack", Steps: []GroupStep{{Device: devices["storage"].ID}}}); err != nil {
+		t.Fatalf("AddGroup() error = %v", err)
+	}
+
+	// 最后一台设备删除后分组一并删除，不会留下唤醒时什么都不做的空分组
+	if err := reg.Remove(devices["storage"].ID); err != nil {
+		t.Fatalf("Remove() error = %v", err)
+	}
+	if groups := reg.Groups(); len(groups) != 0 {
+		t.Errorf("Groups() = %+v, want none", groups)
+	}
+
+	result := wakeGroup(context.Background(), Group{Name: "empty"}, func(WakeTarget) error { return nil })
+	if result.Success || result.Error == "" {
+		t.Errorf("wakeGroup() empty group = %+v, want failure", result)
+	}
+}
+
+func TestGroupTimeoutIncludesRepeat(t *testing.T) {
+	reg := useTestRegistry(t)
+	devices := addTestDevices(t, reg,
+		Device{Name: "storage", MAC: "11:11:11:11:11:11", Repeat: 5, RepeatInterval: Duration(time.Second)},
+		Device{Name: "compute", MAC: "22:22:22:22:22:22"},
+	)
+	steps := []GroupStep{
+		{Device: devices["storage"].ID, Delay: Duration(10 * time.Second)},
+		{Device: devices["compute"].ID},
+	}
+	storage := devices["storage"].target().withDefaults().repeatDuration()
+	compute := devices["compute"].target().withDefaults().repeatDuration()
+	if storage < 4*time.Second {
+		t.Fatalf("repeatDuration() = %v, want at least 4s", storage)
+	}
+
+	if got, want := (Group{Steps: steps}).timeout(), storage+compute; got != want {
+		t.Errorf("parallel timeout() = %v, want %v", got, want)
+	}
+	if got, want := (Group{Sequential: true, Steps: steps}).timeout(), storage+compute+10*time.Second; got != want {
+		t.Errorf("sequential timeout() = %v, want %v", got, want)
+	}
+}
+
+// groupRequest 发送带路径参数的分组API请求
+func groupRequest(t *testing.T, method, id, body string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	req := httptest.NewRequest(method, "/api/v1/groups/"+id, strings.NewReader(body))
+	req.SetPathValue("id", id)
+	rec := httptest.NewRecorder()
+	handleAPIGroup(rec, req)
+	return rec
+}
+
+func TestHandleAPIGroupsCRUD(t *testing.T) {
+	reg := useTestRegistry(t)
+	devices := addTestDevices(t, reg,
+		Device{Name: "storage", MAC: "11:11:11:11:11:11"},
+		Device{Name: "compute", MAC: "22:22:22:22:22:22"},
+	)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/groups",
+		strings.NewReader(`{"name":"rack","sequential":true,"steps":[{"device":"storage","wait_online":true},{"device":"22-22-22-22-22-22","delay":"30s"}]}`))
+	rec := httptest.NewRecorder()
+	handleAPIGroups(rec, req)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create status = %d, body = %s", rec.Code, rec.Body)
+	}
+	group, ok := reg.FindGroup("rack")
+	if !ok || len(group.Steps) != 2 || group.Steps[0].Device != devices["storage"].ID || group.Steps[1].Delay != Duration(30*time.Second) {
+		t.Fatalf("created group = %+v, %v", group, ok)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/api/v1/groups", strings.NewReader(`{"name":"bad","steps":[{"device":"missing"}]}`))
+	rec = httptest.NewRecorder()
+	handleAPIGroups(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("create with unknown device status = %d, want 400", rec.Code)
+	}
+
+	if rec := groupRequest(t, http.MethodGet, group.ID, ""); rec.Code != http.StatusOK {
+		t.Errorf("get status = %d", rec.Code)
+	}
+	if rec := groupRequest(t, http.MethodPut, group.ID, `{"name":"rack","steps":[]}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("update with no steps status = %d, want 400", rec.Code)
+	}
+	if rec := groupRequest(t, http.MethodPut, "rack", `{"name":"rack-2","steps":[{"device":"compute"}]}`); rec.Code != http.StatusOK {
+		t.Fatalf("update status = %d, body = %s", rec.Code, rec.Body)
+	}
+	if g, _ := reg.FindGroup(group.ID); g.Name != "rack-2" || g.Sequential || len(g.Steps) != 1 {
+		t.Errorf("updated group = %+v", g)
+	}
+
+	if rec := groupRequest(t, http.MethodDelete, group.ID, ""); rec.Code != http.StatusNoContent {
+		t.Errorf("delete status = %d", rec.Code)
+	}
+	if rec := groupRequest(t, http.MethodDelete, group.ID, ""); rec.Code != http.StatusNotFound {
+		t.Errorf("delete twice status = %d, want 404", rec.Code)
+	}
+	if rec := groupRequest(t, http.MethodPatch, "missing", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("unknown group status = %d, want 404", rec.Code)
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// Home Assistant MQTT自动发现：每个登记的设备发布一个唤醒按钮（button）和一个在线状态（binary_sensor），
+// 配置主题为 <discovery_prefix>/<component>/<node_id>/<设备ID>/config，node_id 取自MQTT客户端ID
+const (
+	hassButton       = "button"
+	hassBinarySensor = "binary_sensor"
+)
+
+// hassNodeInvalid 匹配Home Assistant节点ID中不允许的字符
+var hassNodeInvalid = regexp.MustCompile(`[^a-zA-Z0-9_-]`)
+
+// hassDevice Home Assistant设备注册表中的设备信息，同一设备的实体归在一起
+type hassDevice struct {
+	Identifiers []string    `json:"identifiers"`
+	Name        string      `json:"name"`
+	Connections [][2]string `json:"connections,omitempty"`
+	Model       string      `json:"model,omitempty"`
+}
+
+// hassEntity 自动发现配置消息
+type hassEntity struct {
+	Name              string     `json:"name"`
+	UniqueID          string     `json:"unique_id"`
+	Icon              string     `json:"icon,omitempty"`
+	CommandTopic      string     `json:"command_topic,omitempty"`
+	StateTopic        string     `json:"state_topic,omitempty"`
+	PayloadOn         string     `json:"payload_on,omitempty"`
+	PayloadOff        string     `json:"payload_off,omitempty"`
+	DeviceClass       string     `json:"device_class,omitempty"`
+	AvailabilityTopic string     `json:"availability_topic"`
+	Device            hassDevice `json:"device"`
+}
+
+// hassNodeID 将MQTT客户端ID转换为合法的节点ID
+func hassNodeID(clientID string) string {
+	return hassNodeInvalid.ReplaceAllString(clientID, "_")
+}
+
+func (b *MQTTBridge) discoveryTopic(component, id string) string {
+	return b.discoveryPrefix + "/" + component + "/" + b.nodeID + "/" + id + "/config"
+}
+
+// discoveryConfigs 返回设备的自动发现配置，键为配置主题
+func (b *MQTTBridge) discoveryConfigs(d Device) map[string]string {
+	device := hassDevice{
+		Identifiers: []string{b.nodeID + "_" + d.ID},
+		Name:        d.Name,
+		Connections: [][2]string{{"mac", strings.ToLower(d.MAC)}},
+		Model:       "Wake-on-LAN",
+	}
+	entities := map[string]hassEntity{
+		hassButton: {
+			Name:              "唤醒",
+			UniqueID:          b.nodeID + "_" + d.ID + "_wake",
+			Icon:              "mdi:power",
+			CommandTopic:      b.topic(d.ID, "wake"),
+			AvailabilityTopic: b.topic("status"),
+			Device:            device,
+		},
+		hassBinarySensor: {
+			Name:              "在线",
+			UniqueID:          b.nodeID + "_" + d.ID + "_online",
+			StateTopic:        b.topic(d.ID, "state"),
+			PayloadOn:         mqttOnline,
+			PayloadOff:        mqttOffline,
+			DeviceClass:       "connectivity",
+			AvailabilityTopic: b.topic("status"),
+			Device:            device,
+		},
+	}
+
+	configs := make(map[string]string, len(entities))
+	for component, e := range entities {
+		payload, _ := json.Marshal(e)
+		configs[b.discoveryTopic(component, d.ID)] = string(payload)
+	}
+	return configs
+}
+
+// syncDiscovery 发布登记表中设备的自动发现配置，并清除已删除设备的配置，
+// 与上次发布相同的配置不重复发布
+func (b *MQTTBridge) syncDiscovery() {
+	current := make(map[string]string)
+	for _, d := range registry.List() {
+		for topic, payload := range b.discoveryConfigs(d) {
+			current[topic] = payload
+		}
+	}
+
+	b.mu.Lock()
+	previous := b.discovered
+	b.discovered = current
+	b.mu.Unlock()
+
+	for topic, payload := range current {
+		if previous[topic] != payload {
+			b.publish(topic, true, payload)
+		}
+	}
+	for topic := range previous {
+		if _, ok := current[topic]; !ok {
+			b.publish(topic, true, "") // 空的保留消息使Home Assistant删除实体
+		}
+	}
+}
+
+// watchRegistry 设备登记表修改后同步自动发现配置
+func (b *MQTTBridge) watchRegistry(changes <-chan struct{}) {
+	defer b.wg.Done()
+
+	for {
+		select {
+		case <-b.done:
+			return
+		case <-changes:
+			b.syncDiscovery()
+		}
+	}
+}
+
+// handleStaleDiscovery 清除broker中保留的、不再登记的设备的配置，
+// 如服务停止期间删除的设备
+func (b *MQTTBridge) handleStaleDiscovery(_ mqtt.Client, msg mqtt.Message) {
+	if len(msg.Payload()) == 0 {
+		return
+	}
+
+	b.mu.Lock()
+	_, ok := b.discovered[msg.Topic()]
+	b.mu.Unlock()
+	if !ok {
+		b.publish(msg.Topic(), true, "")
+	}
+}
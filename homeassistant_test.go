@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func useTestDiscovery(c *Config) {
+	c.MQTTDiscovery = true
+	c.MQTTClientID = "wol service"
+}
+
+func TestHassDiscovery(t *testing.T) {
+	reg := useTestRegistry(t)
+	devices := addTestDevices(t, reg,
+		Device{Name: "书房NAS", MAC: "AA:BB:CC:DD:EE:20"},
+		Device{Name: "pc", MAC: "AA:BB:CC:DD:EE:21"},
+	)
+	broker := startTestBroker(t)
+	useTestMQTT(t, broker, useTestDiscovery)
+
+	nas := devices["书房NAS"]
+	button := "homeassistant/button/wol_service/" + nas.ID + "/config"
+	sensor := "homeassistant/binary_sensor/wol_service/" + nas.ID + "/config"
+	broker.waitRetained(t, button, `"command_topic":"wol/`+nas.ID+`/wake"`)
+	broker.waitRetained(t, sensor, `"state_topic":"wol/`+nas.ID+`/state"`)
+
+	broker.mu.Lock()
+	var entity hassEntity
+	err := json.Unmarshal([]byte(broker.retained[sensor]), &entity)
+	broker.mu.Unlock()
+	if err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	if entity.Device.Name != "书房NAS" || entity.Device.Connections[0] != [2]string{"mac", "aa:bb:cc:dd:ee:20"} ||
+		entity.AvailabilityTopic != "wol/status" || entity.PayloadOn != mqttOnline || entity.UniqueID != "wol_service_"+nas.ID+"_online" {
+		t.Errorf("binary_sensor config = %+v", entity)
+	}
+
+	// 删除设备后清除其配置，重命名后重新发布
+	pc := devices["pc"]
+	if err := reg.Remove(pc.ID); err != nil {
+		t.Fatalf("Remove() error = %v", err)
+	}
+	broker.waitFor(t, "pc config to be cleared", func(b *testBroker) bool {
+		_, button := b.retained["homeassistant/button/wol_service/"+pc.ID+"/config"]
+		_, sensor := b.retained["homeassistant/binary_sensor/wol_service/"+pc.ID+"/config"]
+		return !button && !sensor
+	})
+
+	nas.Name = "NAS"
+	if err := reg.Update(nas); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	broker.waitRetained(t, button, `"name":"NAS"`)
+}
+
+func TestHassDiscoveryClearsStaleDevices(t *testing.T) {
+	reg := useTestRegistry(t)
+	devices := addTestDevices(t, reg, Device{Name: "pc", MAC: "AA:BB:CC:DD:EE:22"})
+	broker := startTestBroker(t)
+
+	// 服务停止期间删除的设备，其配置仍保留在broker中
+	stale := "homeassistant/button/wol_service/deadbeef/config"
+	other := "homeassistant/button/other_node/deadbeef/config"
+	broker.retained[stale] = `{"name":"唤醒"}`
+	broker.retained[other] = `{"name":"唤醒"}`
+
+	useTestMQTT(t, broker, useTestDiscovery)
+	broker.waitRetained(t, "homeassistant/button/wol_service/"+devices["pc"].ID+"/config", `"name":"唤醒"`)
+	broker.waitFor(t, "stale config to be cleared", func(b *testBroker) bool {
+		_, ok := b.retained[stale]
+		return !ok
+	})
+
+	broker.mu.Lock()
+	defer broker.mu.Unlock()
+	if _, ok := broker.retained[other]; !ok {
+		t.Error("config of another node should be kept")
+	}
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// httpProxyOnlineCache 后端在该时间内确认过在线时不再重复探测
+const httpProxyOnlineCache = 10 * time.Second
+
+// HTTPProxyConfig 一个按需唤醒的HTTP反向代理：指定主机名的请求转发到设备上的Web应用
+type HTTPProxyConfig struct {
+	Host     string   `json:"host" yaml:"host" toml:"host"`             // 请求的主机名，如 nas.example.com
+	Device   string   `json:"device" yaml:"device" toml:"device"`       // 已登记设备的ID、名称或MAC地址
+	Upstream string   `json:"upstream" yaml:"upstream" toml:"upstream"` // 上游地址，如 http://192.168.1.50:8096
+	MaxWait  Duration `json:"max_wait" yaml:"max_wait" toml:"max_wait"` // 等待上游上线的最长时间，为0时使用 proxy_max_wait
+}
+
+func (c HTTPProxyConfig) validate() error {
+	if c.Host == "" || c.Device == "" {
+		return fmt.Errorf("HTTP代理需要指定主机名和设备")
+	}
+	u, err := url.Parse(c.Upstream)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("HTTP代理 %s 的上游地址无效: %s", c.Host, c.Upstream)
+	}
+	if c.MaxWait < 0 {
+		return fmt.Errorf("HTTP代理 %s 的等待时间不能为负数", c.Host)
+	}
+	return nil
+}
+
+// HTTPProxy 按需唤醒的HTTP反向代理
+//
+// 上游不可达时唤醒设备，并向浏览器返回自动刷新的"正在唤醒"页面，
+// 上游响应后透明地转发请求
+type HTTPProxy struct {
+	host     string
+	upstream *url.URL
+	proxy    *httputil.ReverseProxy
+	maxWait  time.Duration
+	waker    *deviceWaker
+
+	mu          sync.Mutex
+	lastOnline  time.Time // 最近一次确认上游在线的时间
+	wakingSince time.Time // 本轮唤醒开始的时间，上游在线时为零值
+}
+
+// WakingData "正在唤醒"页面数据
+type WakingData struct {
+	Host    string
+	Elapsed time.Duration
+	MaxWait time.Duration
+	Failed  bool
+	Error   string
+}
+
+func newHTTPProxy(cfg HTTPProxyConfig) (*HTTPProxy, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	upstream, _ := url.Parse(cfg.Upstream)
+
+	maxWait := time.Duration(cfg.MaxWait)
+	if maxWait == 0 {
+		maxWait = time.Duration(config.ProxyMaxWait)
+	}
+	p := &HTTPProxy{
+		host:     strings.ToLower(cfg.Host),
+		upstream: upstream,
+		maxWait:  maxWait,
+		waker:    newDeviceWaker(cfg.Device),
+	}
+	p.proxy = &httputil.ReverseProxy{
+		Rewrite: func(r *httputil.ProxyRequest) {
+			r.SetURL(upstream)
+			r.SetXForwarded()
+			r.Out.Host = r.In.Host
+		},
+		ErrorHandler: p.handleUpstreamError,
+	}
+	return p, nil
+}
+
+func (p *HTTPProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if p.online() {
+		// 服务的读写超时针对本服务的页面和API，代理的上传、视频流等长连接不受限制
+		rc := http.NewResponseController(w)
+		rc.SetReadDeadline(time.Time{})
+		rc.SetWriteDeadline(time.Time{})
+		p.proxy.ServeHTTP(w, r)
+		return
+	}
+	p.serveWaking(w, r)
+}
+
+// online 检查上游是否可以连接，最近确认过在线时直接返回
+func (p *HTTPProxy) online() bool {
+	p.mu.Lock()
+	recent := time.Since(p.lastOnline) < httpProxyOnlineCache
+	p.mu.Unlock()
+	if recent {
+		return true
+	}
+
+	conn, err := net.DialTimeout("tcp", upstreamAddr(p.upstream), time.Duration(config.VerifyInterval))
+	if err != nil {
+		return false
+	}
+	conn.Close()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.wakingSince.IsZero() {
+		log.Printf("HTTP代理 %s: 上游 %s 已在 %s 后上线", p.host, p.upstream.Host, time.Since(p.wakingSince).Round(time.Second))
+		p.wakingSince = time.Time{}
+	}
+	p.lastOnline = time.Now()
+	return true
+}
+
+// handleUpstreamError 转发失败时（如上游刚进入休眠）改为唤醒
+func (p *HTTPProxy) handleUpstreamError(w http.ResponseWriter, r *http.Request, err error) {
+	p.mu.Lock()
+	p.lastOnline = time.Time{}
+	p.mu.Unlock()
+
+	log.Printf("HTTP代理 %s: 转发到 %s 失败: %v", p.host, p.upstream.Host, err)
+	p.serveWaking(w, r)
+}
+
+// serveWaking 唤醒设备，浏览器请求返回自动刷新的等待页面，其他请求返回503
+func (p *HTTPProxy) serveWaking(w http.ResponseWriter, r *http.Request) {
+	p.mu.Lock()
+	if p.wakingSince.IsZero() {
+		p.wakingSince = time.Now()
+	}
+	elapsed := time.Since(p.wakingSince)
+	failed := elapsed > p.maxWait
+	if failed {
+		// 下一次请求重新开始一轮唤醒
+		p.wakingSince = time.Time{}
+	}
+	p.mu.Unlock()
+
+	data := WakingData{Host: p.host, Elapsed: elapsed.Round(time.Second), MaxWait: p.maxWait, Failed: failed}
+	if failed {
+		p.waker.reset()
+		data.Error = fmt.Sprintf("设备在 %s 内没有上线", p.maxWait)
+	} else if err := p.waker.wake(requestOrigin(r, sourceProxy), fmt.Sprintf("HTTP代理 %s: 上游 %s 不可达，来自 %s 的请求", p.host, p.upstream.Host, r.RemoteAddr)); err != nil {
+		data.Failed = true
+		data.Error = fmt.Sprintf("唤醒失败: %v", err)
+	}
+
+	w.Header().Set("Retry-After", "5")
+	w.Header().Set("Cache-Control", "no-store")
+	if r.Method != http.MethodGet || !strings.Contains(r.Header.Get("Accept"), "text/html") {
+		msg := "上游正在唤醒，请稍后重试"
+		if data.Failed {
+			msg = data.Error
+		}
+		http.Error(w, msg, http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusServiceUnavailable)
+	if err := wakingTmpl.Execute(w, data); err != nil {
+		log.Printf("渲染页面失败: %v", err)
+	}
+}
+
+// upstreamAddr 返回上游URL的 host:port，未指定端口时按协议补全
+func upstreamAddr(u *url.URL) string {
+	if u.Port() != "" {
+		return u.Host
+	}
+	if u.Scheme == "https" {
+		return net.JoinHostPort(u.Hostname(), "443")
+	}
+	return net.JoinHostPort(u.Hostname(), "80")
+}
+
+// httpProxies 按主机名索引的HTTP代理
+var httpProxies = map[string]*HTTPProxy{}
+
+// routeHTTPProxies 按请求的主机名分发到HTTP代理，其他请求交给 next
+//
+// 代理的请求不经过本服务的认证，认证由上游应用自己处理
+func routeHTTPProxies(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if p, ok := httpProxies[strings.ToLower(host)]; ok {
+			p.ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
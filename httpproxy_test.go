@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newTestHTTPProxy(t *testing.T, upstream string, wake func(WakeTarget) error) *HTTPProxy {
+	t.Helper()
+
+	reg := useTestRegistry(t)
+	if _, err := reg.Add(Device{Name: "NAS", MAC: "11:22:33:44:55:66"}); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	useFastVerify(t)
+
+	p, err := newHTTPProxy(HTTPProxyConfig{Host: "NAS.example.com", Device: "NAS", Upstream: upstream, MaxWait: Duration(time.Minute)})
+	if err != nil {
+		t.Fatalf("newHTTPProxy() error = %v", err)
+	}
+	p.waker.send = func(_ context.Context, target WakeTarget) error { return wake(target) }
+	return p
+}
+
+func proxyGet(h http.Handler, accept string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "http://nas.example.com:24000/web/index.html", nil)
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestHTTPProxyForwardsToOnlineUpstream(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.Host+r.URL.Path)
+	}))
+	defer upstream.Close()
+
+	var wakes atomic.Int32
+	p := newTestHTTPProxy(t, upstream.URL, func(WakeTarget) error { wakes.Add(1); return nil })
+
+	rec := proxyGet(p, "text/html")
+	if rec.Code != http.StatusOK || rec.Body.String() != "nas.example.com:24000/web/index.html" {
+		t.Errorf("status = %d body = %q, want the upstream response", rec.Code, rec.Body.String())
+	}
+	if wakes.Load() != 0 {
+		t.Errorf("device was woken %d times, want 0", wakes.Load())
+	}
+}
+
+func TestHTTPProxyWakesUpstream(t *testing.T) {
+	addr := unusedAddr(t)
+
+	var wakes atomic.Int32
+	p := newTestHTTPProxy(t, "http://"+addr, func(target WakeTarget) error {
+		if target.MAC != "11:22:33:44:55:66" {
+			t.Errorf("woke MAC %s", target.MAC)
+		}
+		wakes.Add(1)
+		return nil
+	})
+
+	// 浏览器看到自动刷新的等待页面
+	rec := proxyGet(p, "text/html,application/xhtml+xml")
+	if rec.Code != http.StatusServiceUnavailable || rec.Header().Get("Retry-After") == "" {
+		t.Fatalf("status = %d, want 503 with Retry-After", rec.Code)
+	}
+	if body := rec.Body.String(); !strings.Contains(body, `http-equiv="refresh"`) || !strings.Contains(body, "正在唤醒") {
+		t.Errorf("body does not look like the waking page: %s", body)
+	}
+
+	// 其他客户端得到普通的503，多次请求共享一次唤醒
+	if rec := proxyGet(p, "application/json"); rec.Code != http.StatusServiceUnavailable || strings.Contains(rec.Body.String(), "<html") {
+		t.Errorf("API client: status = %d body = %q", rec.Code, rec.Body.String())
+	}
+	if wakes.Load() != 1 {
+		t.Errorf("device was woken %d times, want 1", wakes.Load())
+	}
+
+	// 上游上线后透明转发
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { io.WriteString(w, "jellyfin") })}
+	go srv.Serve(ln)
+	defer srv.Close()
+
+	if rec := proxyGet(p, "text/html"); rec.Code != http.StatusOK || rec.Body.String() != "jellyfin" {
+		t.Errorf("after wake: status = %d body = %q", rec.Code, rec.Body.String())
+	}
+}
+
+func TestRouteHTTPProxies(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "proxied")
+	}))
+	defer upstream.Close()
+
+	p := newTestHTTPProxy(t, upstream.URL, func(WakeTarget) error { return nil })
+	old := httpProxies
+	httpProxies = map[string]*HTTPProxy{p.host: p}
+	t.Cleanup(func() { httpProxies = old })
+
+	h := routeHTTPProxies(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "index")
+	}))
+
+	if rec := proxyGet(h, ""); rec.Body.String() != "proxied" {
+		t.Errorf("configured host: body = %q, want proxied", rec.Body.String())
+	}
+	req := httptest.NewRequest(http.MethodGet, "http://wol.example.com/", nil)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Body.String() != "index" {
+		t.Errorf("other host: body = %q, want index", rec.Body.String())
+	}
+}
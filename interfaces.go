@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+
+	"github.com/tdh62/wake_on_lan_proxy/wol"
+)
+
+// InterfaceInfo 本地网络接口及其IPv4子网信息
+type InterfaceInfo struct {
+	Name      string             `json:"name"`
+	MAC       string             `json:"mac,omitempty"`
+	Addresses []InterfaceAddress `json:"addresses"`
+}
+
+// InterfaceAddress 接口上的一个IPv4地址及其子网的定向广播地址
+type InterfaceAddress struct {
+	IP        string `json:"ip"`
+	Network   string `json:"network"`
+	Broadcast string `json:"broadcast"`
+}
+
+// listInterfaces 列出已启用、支持广播的非回环接口及其IPv4子网
+func listInterfaces() ([]InterfaceInfo, error) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, fmt.Errorf("无法获取网络接口: %v", err)
+	}
+
+	var result []InterfaceInfo
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 || iface.Flags&net.FlagBroadcast == 0 {
+			continue
+		}
+
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+
+		info := InterfaceInfo{Name: iface.Name}
+		if len(iface.HardwareAddr) > 0 {
+			info.MAC = wol.FormatMAC(iface.HardwareAddr)
+		}
+		for _, addr := range addrs {
+			ipnet, ok := addr.(*net.IPNet)
+			if !ok || ipnet.IP.To4() == nil {
+				continue
+			}
+			network := &net.IPNet{IP: ipnet.IP.Mask(ipnet.Mask), Mask: ipnet.Mask}
+			info.Addresses = append(info.Addresses, InterfaceAddress{
+				IP:        ipnet.IP.String(),
+				Network:   network.String(),
+				Broadcast: directedBroadcast(ipnet).String(),
+			})
+		}
+		if len(info.Addresses) > 0 {
+			result = append(result, info)
+		}
+	}
+	return result, nil
+}
+
+// directedBroadcast 计算IPv4子网的定向广播地址，即主机位全部置1
+func directedBroadcast(n *net.IPNet) net.IP {
+	ip := n.IP.To4()
+	if ip == nil {
+		return nil
+	}
+	mask := n.Mask
+	if len(mask) == net.IPv6len {
+		mask = mask[12:]
+	}
+
+	broadcast := make(net.IP, net.IPv4len)
+	for i := range ip {
+		broadcast[i] = ip[i] | ^mask[i]
+	}
+	return broadcast
+}
+
+// allInterfacesTransport 在每个本地接口上向其子网的定向广播地址发送魔术包，忽略目的地址和接口
+//
+// 只要有一个接口发送成功即视为成功，失败的接口记录到日志
+type allInterfacesTransport struct {
+	udp *wol.UDPTransport
+}
+
+func (t allInterfacesTransport) Send(ctx context.Context, dst wol.Destination, packet []byte) (int, error) {
+	interfaces, err := listInterfaces()
+	if err != nil {
+		return 0, err
+	}
+
+	total := 0
+	var errs []error
+	var rejected error
+	for _, iface := range interfaces {
+		for _, addr := range iface.Addresses {
+			// 跳过不在允许列表中的子网
+			if err := checkDestination(net.ParseIP(addr.Broadcast)); err != nil {
+				rejected = err
+				continue
+			}
+			n, err := t.udp.Send(ctx, wol.Destination{Host: addr.Broadcast, Port: dst.Port, Interface: iface.Name, SourceIP: addr.IP}, packet)
+			if err != nil {
+				log.Printf("在接口 %s (%s) 上发送失败: %v", iface.Name, addr.Broadcast, err)
+				errs = append(errs, fmt.Errorf("%s: %v", iface.Name, err))
+				continue
+			}
+			total += n
+		}
+	}
+
+	if total == 0 {
+		if len(errs) == 0 && rejected != nil {
+			return 0, rejected
+		}
+		if len(errs) == 0 {
+			return 0, fmt.Errorf("%w: 没有可用于广播的IPv4接口", errInvalidInterface)
+		}
+		return 0, fmt.Errorf("所有接口发送失败: %w", errors.Join(errs...))
+	}
+	return total, nil
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"net"
+	"testing"
+)
+
+func TestDirectedBroadcast(t *testing.T) {
+	tests := []struct {
+		cidr string
+		want string
+	}{
+		{cidr: "192.168.1.10/24", want: "192.168.1.255"},
+		{cidr: "10.0.5.1/16", want: "10.0.255.255"},
+		{cidr: "172.16.3.130/25", want: "172.16.3.255"},
+		{cidr: "172.16.3.10/25", want: "172.16.3.127"},
+		{cidr: "192.168.1.1/32", want: "192.168.1.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.cidr, func(t *testing.T) {
+			ip, network, err := net.ParseCIDR(tt.cidr)
+			if err != nil {
+				t.Fatalf("ParseCIDR() error = %v", err)
+			}
+			network.IP = ip
+
+			if got := directedBroadcast(network).String(); got != tt.want {
+				t.Errorf("directedBroadcast(%s) = %s, want %s", tt.cidr, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDirectedBroadcastIPv6(t *testing.T) {
+	_, network, _ := net.ParseCIDR("fd00::1/64")
+	if got := directedBroadcast(network); got != nil {
+		t.Errorf("directedBroadcast(IPv6) = %v, want nil", got)
+	}
+}
@@ -1,383 +1,314 @@
 package main
 
 import (
-	"encoding/hex"
+	"context"
+	"errors"
+	"flag"
 	"fmt"
-	"html/template"
 	"log"
 	"net"
 	"net/http"
-	"regexp"
+	"os"
+	"strconv"
 	"strings"
+	"time"
+
+	"github.com/tdh62/wake_on_lan_proxy/wol"
 )
 
 type PageData struct {
-	Message string
-	Success bool
+	Message    string
+	Success    bool
+	Devices    []Device
+	Interfaces []InterfaceInfo
+	Schedules  []ScheduleView
+	Groups     []GroupView
+	Result     *GroupResult // 唤醒分组的逐步结果
+	User       string       // 当前登录的用户，未启用认证时为空
+
+	DefaultBroadcast string
+	DefaultPort      int
+	VerifyTimeout    Duration
+	DefaultRepeat    int
+	RepeatInterval   Duration
+	Timezone         string // 定时任务的默认时区
+}
+
+// HistoryData 唤醒历史页面的数据
+type HistoryData struct {
+	User    string
+	Entries []AuditEntry // 本页的记录，最新的在前
+	Total   int
+	Page    int
+	Pages   int
+	Prev    int // 上一页的页码，为0时没有上一页
+	Next    int // 下一页的页码，为0时没有下一页
+}
+
+// DiscoveryData 设备发现页面的数据
+type DiscoveryData struct {
+	User     string
+	Message  string
+	Success  bool
+	Sweep    string   // 扫描的网段，为空时不扫描
+	Resolve  bool     // 是否反向解析主机名
+	Networks []string // 本机的IPv4子网，作为扫描网段的候选
+	Hosts    []DiscoveredHost
+}
+
+var (
+	errInvalidMAC       = errors.New("无效的MAC地址")
+	errInvalidAddress   = errors.New("无法解析广播地址")
+	errInvalidPassword  = errors.New("无效的SecureOn密码")
+	errInvalidTransport = errors.New("不支持的发送方式")
+	errInvalidInterface = errors.New("无效的网络接口")
+	errInvalidRepeat    = errors.New("无效的重复发送设置")
+
+	errRawSocketPermission = errors.New("没有发送原始以太网帧的权限，需要root或CAP_NET_RAW")
+)
+
+// wolErrors wol 包的错误类别对应的本服务错误，用于选择HTTP状态码和退出码
+var wolErrors = []struct{ kind, local error }{
+	{wol.ErrInvalidMAC, errInvalidMAC},
+	{wol.ErrInvalidPassword, errInvalidPassword},
+	{wol.ErrInvalidAddress, errInvalidAddress},
+	{wol.ErrInvalidInterface, errInvalidInterface},
+	{wol.ErrUnsupported, errInvalidTransport},
+	{wol.ErrPermission, errRawSocketPermission},
+}
+
+// wrapWOLError 用本服务的错误包装 wol 包的错误，使 errors.Is 对两者都成立
+func wrapWOLError(err error) error {
+	for _, e := range wolErrors {
+		if errors.Is(err, e.kind) {
+			return fmt.Errorf("%w: %w", e.local, err)
+		}
+	}
+	return err
 }
 
+// registry 服务端设备登记表
+var registry *DeviceRegistry
+
 func main() {
-	http.HandleFunc("/", handleIndex)
-	http.HandleFunc("/wake", handleWake)
+	cmd, args := "serve", os.Args[1:]
+	// 没有指定命令时启动服务，兼容 wol-service -listen :24000 的用法
+	if len(args) > 0 && (!strings.HasPrefix(args[0], "-") || args[0] == "-h" || args[0] == "--help") {
+		cmd, args = args[0], args[1:]
+	}
+	if cmd == "serve" {
+		runServe(args)
+		return
+	}
+	os.Exit(runCommand(cmd, args, os.Stdin, os.Stdout))
+}
+
+// runServe 实现 serve 子命令，启动Web服务和已配置的中继、代理和定时任务
+func runServe(args []string) {
+	cfg, rest, err := loadConfigFlags(newCommandFlags("serve", "[参数]"), args)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(rest) > 0 {
+		log.Fatalf("未知的参数: %s", strings.Join(rest, " "))
+	}
+	config = cfg
+
+	registry, err = openDeviceRegistry(config.DataFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	// 命令行修改了设备文件时重新读取
+	go registry.watchFile(registryPollInterval)
+	auditLog, err = openAuditLog(config.auditPath(), time.Duration(config.AuditRetention), config.AuditMaxEntries)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	handle("/", handleIndex)
+	handle("/wake", handleWake)
+	handle("/history", handleHistory)
+	handle("/discovery", handleDiscovery)
+	handle("/discovery/import", handleDiscoveryImport)
+	handle("/devices/add", handleDeviceAdd)
+	handle("/devices/delete", handleDeviceDelete)
+	handle("/groups/add", handleGroupAdd)
+	handle("/groups/delete", handleGroupDelete)
+	handle("/groups/wake", handleGroupWake)
+	handle("/schedules/add", handleScheduleAdd)
+	handle("/schedules/delete", handleScheduleDelete)
+	handle("/api/v1/wake", handleAPIWake)
+	handle("/api/v1/wake/bulk", handleAPIBulkWake)
+	handle("/api/v1/interfaces", handleAPIInterfaces)
+	handle("/api/v1/relay/stats", handleAPIRelayStats)
+	handle("/api/v1/schedules", handleAPISchedules)
+	handle("/api/v1/groups", handleAPIGroups)
+	handle("/api/v1/groups/wake", handleAPIGroupWake)
+	handle("/api/v1/groups/{id}", handleAPIGroup)
+	handle("/api/v1/audit", handleAPIAudit)
+	handle("/api/v1/audit/export", handleAPIAuditExport)
+	handle("/api/v1/webhooks/deliveries", handleAPIWebhookDeliveries)
+	handle("/api/v1/discovery", handleAPIDiscovery)
+	handle("/api/v1/discovery/import", handleAPIDiscoveryImport)
+	handle("/login", handleLogin)
+	handle("/logout", handleLogout)
+	http.Handle("/metrics", handleMetrics)
+
+	if config.RelayListen != "" {
+		relay, err = newRelay(config)
+		if err != nil {
+			log.Fatal(err)
+		}
+		go relay.serve()
+		fmt.Printf("中继模式已启用，监听地址: %s\n", relay.Addr())
+	}
+
+	go runScheduler()
+
+	if len(config.Webhooks) > 0 {
+		webhooks = newWebhookDispatcher(config.Webhooks)
+		fmt.Printf("已配置 %d 个webhook\n", len(config.Webhooks))
+	}
+
+	if config.MQTTBroker != "" {
+		mqttBridge = newMQTTBridge(config)
+		fmt.Printf("MQTT已启用，broker: %s，主题前缀: %s\n", config.MQTTBroker, config.MQTTTopicPrefix)
+		if config.MQTTDiscovery {
+			fmt.Printf("已启用Home Assistant自动发现，主题前缀: %s\n", config.MQTTDiscoveryPrefix)
+		}
+	}
+
+	for _, cfg := range config.TCPProxies {
+		proxy, err := newTCPProxy(cfg)
+		if err != nil {
+			log.Fatal(err)
+		}
+		go proxy.serve()
+		tcpProxies = append(tcpProxies, proxy)
+		fmt.Printf("TCP代理已启用: %s -> %s (设备: %s)\n", proxy.Addr(), cfg.Backend, cfg.Device)
+	}
 
-	fmt.Println("Wake-on-LAN服务已启动，监听端口: 24000")
-	fmt.Println("访问 http://localhost:24000 使用服务")
-	log.Fatal(http.ListenAndServe(":24000", nil))
+	for _, cfg := range config.HTTPProxies {
+		proxy, err := newHTTPProxy(cfg)
+		if err != nil {
+			log.Fatal(err)
+		}
+		httpProxies[proxy.host] = proxy
+		fmt.Printf("HTTP代理已启用: %s -> %s (设备: %s)\n", proxy.host, cfg.Upstream, cfg.Device)
+	}
+
+	server := &http.Server{
+		Addr:         config.Listen,
+		ReadTimeout:  time.Duration(config.ReadTimeout),
+		WriteTimeout: time.Duration(config.WriteTimeout),
+		IdleTimeout:  time.Duration(config.IdleTimeout),
+		Handler:      routeHTTPProxies(requireAuth(http.DefaultServeMux)),
+	}
+
+	if config.Auth.Enabled() {
+		fmt.Printf("已启用认证: %d 个用户, %d 个API令牌\n", len(config.Auth.Users), len(config.Auth.Tokens))
+	}
+	fmt.Printf("Wake-on-LAN服务已启动，监听地址: %s\n", config.Listen)
+	log.Fatal(server.ListenAndServe())
+}
+
+// renderIndex 渲染首页，并附带当前设备列表
+func renderIndex(w http.ResponseWriter, r *http.Request, data PageData) {
+	data.User = requestUser(r)
+	data.Devices = registry.List()
+	data.Schedules = scheduleViews(data.Devices, time.Now(), 3)
+	data.Groups = groupViews(registry.Groups(), data.Devices)
+	data.Timezone = time.Local.String()
+	data.Interfaces, _ = listInterfaces()
+	data.DefaultBroadcast = config.DefaultBroadcast
+	data.DefaultPort = config.DefaultPort
+	data.VerifyTimeout = config.VerifyTimeout
+	data.DefaultRepeat = config.Repeat
+	data.RepeatInterval = config.RepeatInterval
+
+	if err := indexTmpl.Execute(w, data); err != nil {
+		log.Printf("渲染页面失败: %v", err)
+	}
 }
 
 func handleIndex(w http.ResponseWriter, r *http.Request) {
-	tmpl := `<!DOCTYPE html>
-<html lang="zh-CN">
-<head>
-    <meta charset="UTF-8">
-    <meta name="viewport" content="width=device-width, initial-scale=1.0">
-    <title>局域网唤醒服务</title>
-    <style>
-        * {
-            margin: 0;
-            padding: 0;
-            box-sizing: border-box;
-        }
-        body {
-            font-family: 'Segoe UI', Tahoma, Geneva, Verdana, sans-serif;
-            background: linear-gradient(135deg, #667eea 0%, #764ba2 100%);
-            min-height: 100vh;
-            display: flex;
-            justify-content: center;
-            align-items: center;
-            padding: 20px;
-        }
-        .container {
-            background: white;
-            border-radius: 20px;
-            box-shadow: 0 20px 60px rgba(0, 0, 0, 0.3);
-            padding: 40px;
-            max-width: 600px;
-            width: 100%;
-        }
-        h1 {
-            color: #333;
-            text-align: center;
-            margin-bottom: 30px;
-            font-size: 28px;
-        }
-        h2 {
-            color: #555;
-            font-size: 18px;
-            margin-bottom: 15px;
-            margin-top: 30px;
-        }
-        .form-group {
-            margin-bottom: 20px;
-        }
-        label {
-            display: block;
-            color: #555;
-            font-weight: 600;
-            margin-bottom: 8px;
-            font-size: 14px;
-        }
-        input[type="text"] {
-            width: 100%;
-            padding: 12px 15px;
-            border: 2px solid #e0e0e0;
-            border-radius: 8px;
-            font-size: 16px;
-            transition: border-color 0.3s;
-        }
-        input[type="text"]:focus {
-            outline: none;
-            border-color: #667eea;
-        }
-        .hint {
-            font-size: 12px;
-            color: #888;
-            margin-top: 5px;
-        }
-        button {
-            width: 100%;
-            padding: 14px;
-            background: linear-gradient(135deg, #667eea 0%, #764ba2 100%);
-            color: white;
-            border: none;
-            border-radius: 8px;
-            font-size: 16px;
-            font-weight: 600;
-            cursor: pointer;
-            transition: transform 0.2s, box-shadow 0.2s;
-        }
-        button:hover {
-            transform: translateY(-2px);
-            box-shadow: 0 10px 20px rgba(102, 126, 234, 0.4);
-        }
-        button:active {
-            transform: translateY(0);
-        }
-        .message {
-            padding: 15px;
-            border-radius: 8px;
-            margin-bottom: 20px;
-            font-size: 14px;
-        }
-        .success {
-            background-color: #d4edda;
-            color: #155724;
-            border: 1px solid #c3e6cb;
-        }
-        .error {
-            background-color: #f8d7da;
-            color: #721c24;
-            border: 1px solid #f5c6cb;
-        }
-        .history-section {
-            margin-top: 30px;
-            padding-top: 30px;
-            border-top: 2px solid #e0e0e0;
-        }
-        .history-header {
-            display: flex;
-            justify-content: space-between;
-            align-items: center;
-            margin-bottom: 15px;
-        }
-        .clear-all-btn {
-            padding: 6px 12px;
-            font-size: 12px;
-            background: #dc3545;
-            width: auto;
-        }
-        .clear-all-btn:hover {
-            background: #c82333;
-        }
-        .history-list {
-            max-height: 300px;
-            overflow-y: auto;
-        }
-        .history-item {
-            background: #f8f9fa;
-            border: 1px solid #e0e0e0;
-            border-radius: 8px;
-            padding: 12px;
-            margin-bottom: 10px;
-            display: flex;
-            justify-content: space-between;
-            align-items: center;
-            cursor: pointer;
-            transition: all 0.2s;
-        }
-        .history-item:hover {
-            background: #e9ecef;
-            border-color: #667eea;
-            transform: translateX(5px);
-        }
-        .history-info {
-            flex: 1;
-        }
-        .history-name {
-            font-weight: 600;
-            color: #333;
-            margin-bottom: 4px;
-        }
-        .history-details {
-            font-size: 12px;
-            color: #666;
-        }
-        .history-actions {
-            display: flex;
-            gap: 8px;
-        }
-        .delete-btn {
-            padding: 6px 12px;
-            font-size: 12px;
-            background: #dc3545;
-            width: auto;
-        }
-        .delete-btn:hover {
-            background: #c82333;
-        }
-        .empty-history {
-            text-align: center;
-            color: #999;
-            padding: 20px;
-            font-size: 14px;
-        }
-    </style>
-</head>
-<body>
-    <div class="container">
-        <h1>🌐 局域网唤醒服务</h1>
-        {{if .Message}}
-        <div class="message {{if .Success}}success{{else}}error{{end}}">
-            {{.Message}}
-        </div>
-        {{end}}
-        <form action="/wake" method="POST" id="wakeForm" onsubmit="saveToHistory(event)">
-            <div class="form-group">
-                <label for="deviceName">设备名称（可选）</label>
-                <input type="text" id="deviceName" name="deviceName" placeholder="例如: 我的电脑">
-                <div class="hint">为设备设置一个易记的名称</div>
-            </div>
-            <div class="form-group">
-                <label for="mac">目标设备MAC地址</label>
-                <input type="text" id="mac" name="mac" placeholder="例如: AA:BB:CC:DD:EE:FF" required>
-                <div class="hint">支持格式: AA:BB:CC:DD:EE:FF 或 AA-BB-CC-DD-EE-FF</div>
-            </div>
-            <div class="form-group">
-                <label for="ip">广播地址（可选）</label>
-                <input type="text" id="ip" name="ip" placeholder="例如: 192.168.1.255" value="255.255.255.255">
-                <div class="hint">默认使用全局广播地址 255.255.255.255</div>
-            </div>
-            <button type="submit">发送唤醒包</button>
-        </form>
-
-        <div class="history-section">
-            <div class="history-header">
-                <h2>📋 历史记录</h2>
-                <button class="clear-all-btn" onclick="clearAllHistory()">清空全部</button>
-            </div>
-            <div class="history-list" id="historyList">
-                <div class="empty-history">暂无历史记录</div>
-            </div>
-        </div>
-    </div>
-
-    <script>
-        const MAX_HISTORY = 10;
-
-        // 页面加载时显示历史记录
-        window.onload = function() {
-            displayHistory();
-        };
-
-        // 保存到历史记录
-        function saveToHistory(event) {
-            const deviceName = document.getElementById('deviceName').value.trim();
-            const mac = document.getElementById('mac').value.trim();
-            const ip = document.getElementById('ip').value.trim();
-
-            if (!mac) return;
-
-            const record = {
-                deviceName: deviceName || mac,
-                mac: mac,
-                ip: ip,
-                timestamp: new Date().toISOString()
-            };
-
-            let history = getHistory();
-
-            // 检查是否已存在相同MAC地址的记录，如果存在则更新
-            const existingIndex = history.findIndex(item => item.mac.toLowerCase() === mac.toLowerCase());
-            if (existingIndex !== -1) {
-                history.splice(existingIndex, 1);
-            }
-
-            // 添加到开头
-            history.unshift(record);
-
-            // 限制历史记录数量
-            if (history.length > MAX_HISTORY) {
-                history = history.slice(0, MAX_HISTORY);
-            }
-
-            localStorage.setItem('wolHistory', JSON.stringify(history));
-        }
-
-        // 获取历史记录
-        function getHistory() {
-            const history = localStorage.getItem('wolHistory');
-            return history ? JSON.parse(history) : [];
-        }
-
-        // 显示历史记录
-        function displayHistory() {
-            const history = getHistory();
-            const historyList = document.getElementById('historyList');
-
-            if (history.length === 0) {
-                historyList.innerHTML = '<div class="empty-history">暂无历史记录</div>';
-                return;
-            }
-
-            historyList.innerHTML = history.map((record, index) => {
-                const date = new Date(record.timestamp);
-                const dateStr = date.toLocaleString('zh-CN', {
-                    month: '2-digit',
-                    day: '2-digit',
-                    hour: '2-digit',
-                    minute: '2-digit'
-                });
-
-                return ` + "`" + `
-                    <div class="history-item" onclick="loadFromHistory(${index})">
-                        <div class="history-info">
-                            <div class="history-name">${escapeHtml(record.deviceName)}</div>
-                            <div class="history-details">MAC: ${escapeHtml(record.mac)} | IP: ${escapeHtml(record.ip)} | ${dateStr}</div>
-                        </div>
-                        <div class="history-actions">
-                            <button class="delete-btn" onclick="deleteHistory(event, ${index})">删除</button>
-                        </div>
-                    </div>
-                ` + "`" + `;
-            }).join('');
-        }
-
-        // 从历史记录加载
-        function loadFromHistory(index) {
-            const history = getHistory();
-            if (index >= 0 && index < history.length) {
-                const record = history[index];
-                document.getElementById('deviceName').value = record.deviceName;
-                document.getElementById('mac').value = record.mac;
-                document.getElementById('ip').value = record.ip;
-
-                // 滚动到表单顶部
-                window.scrollTo({ top: 0, behavior: 'smooth' });
-            }
-        }
-
-        // 删除单个历史记录
-        function deleteHistory(event, index) {
-            event.stopPropagation();
-
-            if (confirm('确定要删除这条记录吗？')) {
-                let history = getHistory();
-                history.splice(index, 1);
-                localStorage.setItem('wolHistory', JSON.stringify(history));
-                displayHistory();
-            }
-        }
-
-        // 清空所有历史记录
-        function clearAllHistory() {
-            if (confirm('确定要清空所有历史记录吗？')) {
-                localStorage.removeItem('wolHistory');
-                displayHistory();
-            }
-        }
-
-        // HTML转义函数
-        function escapeHtml(text) {
-            const div = document.createElement('div');
-            div.textContent = text;
-            return div.innerHTML;
-        }
-    </script>
-</body>
-</html>`
-
-	t, err := template.New("index").Parse(tmpl)
+	renderIndex(w, r, PageData{})
+}
+
+// handleHistory 分页显示审计日志中的唤醒历史
+func handleHistory(w http.ResponseWriter, r *http.Request) {
+	page, _ := pageParams(r)
+	entries, total := auditLog.Page((page-1)*auditPageSize, auditPageSize)
+
+	data := HistoryData{User: requestUser(r), Entries: entries, Total: total, Page: page}
+	data.Pages = max((total+auditPageSize-1)/auditPageSize, 1)
+	if page > 1 {
+		data.Prev = min(page-1, data.Pages)
+	}
+	if page < data.Pages {
+		data.Next = page + 1
+	}
+
+	if err := historyTmpl.Execute(w, data); err != nil {
+		log.Printf("渲染页面失败: %v", err)
+	}
+}
+
+// renderDiscovery 读取邻居表并渲染设备发现页面，data.Sweep 不为空时先扫描该网段
+func renderDiscovery(w http.ResponseWriter, r *http.Request, data DiscoveryData) {
+	data.User = requestUser(r)
+	data.Networks = localNetworks()
+
+	var sweep *net.IPNet
+	if data.Sweep != "" {
+		network, err := parseSweep(data.Sweep)
+		if err != nil {
+			data.Message, data.Success = err.Error(), false
+		} else {
+			sweep = network
+			log.Printf("%s 请求扫描网段 %s", requestActor(r), sweep)
+		}
+	}
+	// 网段无效时仍然列出邻居表中已有的主机
+	extendWriteDeadline(w, discoveryTimeout(sweep, data.Resolve))
+	hosts, err := discoverHosts(r.Context(), sweep, data.Resolve)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		data.Message, data.Success = err.Error(), false
+	}
+	data.Hosts = hosts
+
+	if err := discoveryTmpl.Execute(w, data); err != nil {
+		log.Printf("渲染页面失败: %v", err)
+	}
+}
+
+// handleDiscovery 显示邻居表中的主机，可选扫描网段和反向解析主机名
+func handleDiscovery(w http.ResponseWriter, r *http.Request) {
+	renderDiscovery(w, r, DiscoveryData{
+		Sweep:   strings.TrimSpace(r.FormValue("sweep")),
+		Resolve: r.FormValue("resolve") != "",
+	})
+}
+
+// handleDiscoveryImport 将发现页面中的一台主机登记为设备
+func handleDiscoveryImport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/discovery", http.StatusSeeOther)
 		return
 	}
 
-	data := PageData{
-		Message: "",
-		Success: false,
+	host := DiscoveredHost{MAC: r.FormValue("mac"), IP: r.FormValue("ip"), Hostname: r.FormValue("hostname")}
+	device, err := importHost(host, r.FormValue("name"))
+	if err != nil {
+		renderDiscovery(w, r, DiscoveryData{Message: fmt.Sprintf("导入失败: %v", err)})
+		return
 	}
+	log.Printf("%s 导入了设备 %s (%s)", requestActor(r), device.Name, device.MAC)
 
-	t.Execute(w, data)
+	renderDiscovery(w, r, DiscoveryData{Message: fmt.Sprintf("设备 %s 已导入", device.Name), Success: true})
 }
 
 func handleWake(w http.ResponseWriter, r *http.Request) {
@@ -386,441 +317,471 @@ func handleWake(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	macAddr := r.FormValue("mac")
-	broadcastIP := r.FormValue("ip")
-
-	if broadcastIP == "" {
-		broadcastIP = "255.255.255.255"
-	}
-
-	err := sendWakeOnLAN(macAddr, broadcastIP)
-
-	tmpl := `<!DOCTYPE html>
-<html lang="zh-CN">
-<head>
-    <meta charset="UTF-8">
-    <meta name="viewport" content="width=device-width, initial-scale=1.0">
-    <title>局域网唤醒服务</title>
-    <style>
-        * {
-            margin: 0;
-            padding: 0;
-            box-sizing: border-box;
-        }
-        body {
-            font-family: 'Segoe UI', Tahoma, Geneva, Verdana, sans-serif;
-            background: linear-gradient(135deg, #667eea 0%, #764ba2 100%);
-            min-height: 100vh;
-            display: flex;
-            justify-content: center;
-            align-items: center;
-            padding: 20px;
-        }
-        .container {
-            background: white;
-            border-radius: 20px;
-            box-shadow: 0 20px 60px rgba(0, 0, 0, 0.3);
-            padding: 40px;
-            max-width: 600px;
-            width: 100%;
-        }
-        h1 {
-            color: #333;
-            text-align: center;
-            margin-bottom: 30px;
-            font-size: 28px;
-        }
-        h2 {
-            color: #555;
-            font-size: 18px;
-            margin-bottom: 15px;
-            margin-top: 30px;
-        }
-        .form-group {
-            margin-bottom: 20px;
-        }
-        label {
-            display: block;
-            color: #555;
-            font-weight: 600;
-            margin-bottom: 8px;
-            font-size: 14px;
-        }
-        input[type="text"] {
-            width: 100%;
-            padding: 12px 15px;
-            border: 2px solid #e0e0e0;
-            border-radius: 8px;
-            font-size: 16px;
-            transition: border-color 0.3s;
-        }
-        input[type="text"]:focus {
-            outline: none;
-            border-color: #667eea;
-        }
-        .hint {
-            font-size: 12px;
-            color: #888;
-            margin-top: 5px;
-        }
-        button {
-            width: 100%;
-            padding: 14px;
-            background: linear-gradient(135deg, #667eea 0%, #764ba2 100%);
-            color: white;
-            border: none;
-            border-radius: 8px;
-            font-size: 16px;
-            font-weight: 600;
-            cursor: pointer;
-            transition: transform 0.2s, box-shadow 0.2s;
-        }
-        button:hover {
-            transform: translateY(-2px);
-            box-shadow: 0 10px 20px rgba(102, 126, 234, 0.4);
-        }
-        button:active {
-            transform: translateY(0);
-        }
-        .message {
-            padding: 15px;
-            border-radius: 8px;
-            margin-bottom: 20px;
-            font-size: 14px;
-        }
-        .success {
-            background-color: #d4edda;
-            color: #155724;
-            border: 1px solid #c3e6cb;
-        }
-        .error {
-            background-color: #f8d7da;
-            color: #721c24;
-            border: 1px solid #f5c6cb;
-        }
-        .history-section {
-            margin-top: 30px;
-            padding-top: 30px;
-            border-top: 2px solid #e0e0e0;
-        }
-        .history-header {
-            display: flex;
-            justify-content: space-between;
-            align-items: center;
-            margin-bottom: 15px;
-        }
-        .clear-all-btn {
-            padding: 6px 12px;
-            font-size: 12px;
-            background: #dc3545;
-            width: auto;
-        }
-        .clear-all-btn:hover {
-            background: #c82333;
-        }
-        .history-list {
-            max-height: 300px;
-            overflow-y: auto;
-        }
-        .history-item {
-            background: #f8f9fa;
-            border: 1px solid #e0e0e0;
-            border-radius: 8px;
-            padding: 12px;
-            margin-bottom: 10px;
-            display: flex;
-            justify-content: space-between;
-            align-items: center;
-            cursor: pointer;
-            transition: all 0.2s;
-        }
-        .history-item:hover {
-            background: #e9ecef;
-            border-color: #667eea;
-            transform: translateX(5px);
-        }
-        .history-info {
-            flex: 1;
-        }
-        .history-name {
-            font-weight: 600;
-            color: #333;
-            margin-bottom: 4px;
-        }
-        .history-details {
-            font-size: 12px;
-            color: #666;
-        }
-        .history-actions {
-            display: flex;
-            gap: 8px;
-        }
-        .delete-btn {
-            padding: 6px 12px;
-            font-size: 12px;
-            background: #dc3545;
-            width: auto;
-        }
-        .delete-btn:hover {
-            background: #c82333;
-        }
-        .empty-history {
-            text-align: center;
-            color: #999;
-            padding: 20px;
-            font-size: 14px;
-        }
-    </style>
-</head>
-<body>
-    <div class="container">
-        <h1>🌐 局域网唤醒服务</h1>
-        {{if .Message}}
-        <div class="message {{if .Success}}success{{else}}error{{end}}">
-            {{.Message}}
-        </div>
-        {{end}}
-        <form action="/wake" method="POST" id="wakeForm" onsubmit="saveToHistory(event)">
-            <div class="form-group">
-                <label for="deviceName">设备名称（可选）</label>
-                <input type="text" id="deviceName" name="deviceName" placeholder="例如: 我的电脑">
-                <div class="hint">为设备设置一个易记的名称</div>
-            </div>
-            <div class="form-group">
-                <label for="mac">目标设备MAC地址</label>
-                <input type="text" id="mac" name="mac" placeholder="例如: AA:BB:CC:DD:EE:FF" required>
-                <div class="hint">支持格式: AA:BB:CC:DD:EE:FF 或 AA-BB-CC-DD-EE-FF</div>
-            </div>
-            <div class="form-group">
-                <label for="ip">广播地址（可选）</label>
-                <input type="text" id="ip" name="ip" placeholder="例如: 192.168.1.255" value="255.255.255.255">
-                <div class="hint">默认使用全局广播地址 255.255.255.255</div>
-            </div>
-            <button type="submit">发送唤醒包</button>
-        </form>
-
-        <div class="history-section">
-            <div class="history-header">
-                <h2>📋 历史记录</h2>
-                <button class="clear-all-btn" onclick="clearAllHistory()">清空全部</button>
-            </div>
-            <div class="history-list" id="historyList">
-                <div class="empty-history">暂无历史记录</div>
-            </div>
-        </div>
-    </div>
-
-    <script>
-        const MAX_HISTORY = 10;
-
-        // 页面加载时显示历史记录
-        window.onload = function() {
-            displayHistory();
-        };
-
-        // 保存到历史记录
-        function saveToHistory(event) {
-            const deviceName = document.getElementById('deviceName').value.trim();
-            const mac = document.getElementById('mac').value.trim();
-            const ip = document.getElementById('ip').value.trim();
-
-            if (!mac) return;
-
-            const record = {
-                deviceName: deviceName || mac,
-                mac: mac,
-                ip: ip,
-                timestamp: new Date().toISOString()
-            };
-
-            let history = getHistory();
-
-            // 检查是否已存在相同MAC地址的记录，如果存在则更新
-            const existingIndex = history.findIndex(item => item.mac.toLowerCase() === mac.toLowerCase());
-            if (existingIndex !== -1) {
-                history.splice(existingIndex, 1);
-            }
-
-            // 添加到开头
-            history.unshift(record);
-
-            // 限制历史记录数量
-            if (history.length > MAX_HISTORY) {
-                history = history.slice(0, MAX_HISTORY);
-            }
-
-            localStorage.setItem('wolHistory', JSON.stringify(history));
-        }
-
-        // 获取历史记录
-        function getHistory() {
-            const history = localStorage.getItem('wolHistory');
-            return history ? JSON.parse(history) : [];
-        }
-
-        // 显示历史记录
-        function displayHistory() {
-            const history = getHistory();
-            const historyList = document.getElementById('historyList');
-
-            if (history.length === 0) {
-                historyList.innerHTML = '<div class="empty-history">暂无历史记录</div>';
-                return;
-            }
-
-            historyList.innerHTML = history.map((record, index) => {
-                const date = new Date(record.timestamp);
-                const dateStr = date.toLocaleString('zh-CN', {
-                    month: '2-digit',
-                    day: '2-digit',
-                    hour: '2-digit',
-                    minute: '2-digit'
-                });
-
-                return ` + "`" + `
-                    <div class="history-item" onclick="loadFromHistory(${index})">
-                        <div class="history-info">
-                            <div class="history-name">${escapeHtml(record.deviceName)}</div>
-                            <div class="history-details">MAC: ${escapeHtml(record.mac)} | IP: ${escapeHtml(record.ip)} | ${dateStr}</div>
-                        </div>
-                        <div class="history-actions">
-                            <button class="delete-btn" onclick="deleteHistory(event, ${index})">删除</button>
-                        </div>
-                    </div>
-                ` + "`" + `;
-            }).join('');
-        }
-
-        // 从历史记录加载
-        function loadFromHistory(index) {
-            const history = getHistory();
-            if (index >= 0 && index < history.length) {
-                const record = history[index];
-                document.getElementById('deviceName').value = record.deviceName;
-                document.getElementById('mac').value = record.mac;
-                document.getElementById('ip').value = record.ip;
-
-                // 滚动到表单顶部
-                window.scrollTo({ top: 0, behavior: 'smooth' });
-            }
-        }
-
-        // 删除单个历史记录
-        function deleteHistory(event, index) {
-            event.stopPropagation();
-
-            if (confirm('确定要删除这条记录吗？')) {
-                let history = getHistory();
-                history.splice(index, 1);
-                localStorage.setItem('wolHistory', JSON.stringify(history));
-                displayHistory();
-            }
-        }
-
-        // 清空所有历史记录
-        function clearAllHistory() {
-            if (confirm('确定要清空所有历史记录吗？')) {
-                localStorage.removeItem('wolHistory');
-                displayHistory();
-            }
-        }
-
-        // HTML转义函数
-        function escapeHtml(text) {
-            const div = document.createElement('div');
-            div.textContent = text;
-            return div.innerHTML;
-        }
-    </script>
-</body>
-</html>`
-
-	t, _ := template.New("index").Parse(tmpl)
+	target := WakeTarget{
+		MAC:           r.FormValue("mac"),
+		Broadcast:     r.FormValue("ip"),
+		Password:      r.FormValue("password"),
+		Transport:     r.FormValue("transport"),
+		Interface:     r.FormValue("iface"),
+		SourceIP:      r.FormValue("source"),
+		AllInterfaces: r.FormValue("all") != "",
+	}
+
+	// 指定了设备ID时使用登记的设备信息
+	var verify *VerifyConfig
+	if id := r.FormValue("device"); id != "" {
+		device, ok := registry.Get(id)
+		if !ok {
+			renderIndex(w, r, PageData{Message: fmt.Sprintf("发送失败: %v", errDeviceNotFound)})
+			return
+		}
+		target = device.target()
+		verify = device.Verify
+	}
+
+	// 表单中填写的重复次数优先于设备和配置中的设置
+	if v := strings.TrimSpace(r.FormValue("repeat")); v != "" {
+		repeat, err := strconv.Atoi(v)
+		if err != nil {
+			renderIndex(w, r, PageData{Message: fmt.Sprintf("发送失败: %v: %s", errInvalidRepeat, v)})
+			return
+		}
+		target.Repeat = repeat
+	}
+
+	target = target.withDefaults()
+
+	log.Printf("%s 请求唤醒 MAC: %s", requestActor(r), target.MAC)
+	extendWriteDeadline(w, target.repeatDuration())
+	ctx := requestOrigin(r, sourceWeb)
+	packets, err := sendWakeOnLANWith(ctx, nil, target)
 
 	data := PageData{}
 	if err != nil {
 		data.Message = fmt.Sprintf("发送失败: %v", err)
 		data.Success = false
 	} else {
-		data.Message = fmt.Sprintf("唤醒包已成功发送到 %s (广播地址: %s)", macAddr, broadcastIP)
+		data.Message = fmt.Sprintf("唤醒包已成功发送到 %s (%s, 共 %d 个)", target.MAC, target.destination(), packets)
 		data.Success = true
 	}
 
-	t.Execute(w, data)
+	// 设备配置了上线验证时等待验证结果
+	if err == nil && verify != nil {
+		extendWriteDeadline(w, verify.timeout())
+		result := verifyWake(ctx, *verify, target.MAC)
+		data.Message += "，" + result.Summary()
+		data.Success = result.Online
+	}
+
+	renderIndex(w, r, data)
 }
 
-func sendWakeOnLAN(macAddr string, broadcastIP string) error {
-	// 解析MAC地址
-	mac, err := parseMACAddress(macAddr)
-	if err != nil {
-		return fmt.Errorf("无效的MAC地址: %v", err)
+func handleDeviceAdd(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
 	}
 
-	// 创建魔术包
-	magicPacket := createMagicPacket(mac)
+	device := Device{
+		Name:      r.FormValue("name"),
+		MAC:       r.FormValue("mac"),
+		Broadcast: r.FormValue("ip"),
+		Password:  r.FormValue("password"),
+		Transport: r.FormValue("transport"),
+		Interface: r.FormValue("iface"),
+		SourceIP:  r.FormValue("source"),
+		Notes:     r.FormValue("notes"),
+
+		AllInterfaces: r.FormValue("all") != "",
+	}
+	if method := r.FormValue("verify_method"); method != "" {
+		device.Verify = &VerifyConfig{Method: method, Host: r.FormValue("verify_host")}
+		if p := strings.TrimSpace(r.FormValue("verify_port")); p != "" {
+			port, err := strconv.Atoi(p)
+			if err != nil {
+				renderIndex(w, r, PageData{Message: fmt.Sprintf("保存失败: 无效的验证端口: %s", p)})
+				return
+			}
+			device.Verify.Port = port
+		}
+		if t := strings.TrimSpace(r.FormValue("verify_timeout")); t != "" {
+			if err := device.Verify.Timeout.UnmarshalText([]byte(t)); err != nil {
+				renderIndex(w, r, PageData{Message: fmt.Sprintf("保存失败: 无效的验证超时: %s", t)})
+				return
+			}
+		}
+	}
+	if p := strings.TrimSpace(r.FormValue("port")); p != "" {
+		port, err := strconv.Atoi(p)
+		if err != nil {
+			renderIndex(w, r, PageData{Message: fmt.Sprintf("保存失败: 无效的端口: %s", p)})
+			return
+		}
+		device.Port = port
+	}
+	if v := strings.TrimSpace(r.FormValue("repeat")); v != "" {
+		repeat, err := strconv.Atoi(v)
+		if err != nil {
+			renderIndex(w, r, PageData{Message: fmt.Sprintf("保存失败: 无效的重复次数: %s", v)})
+			return
+		}
+		device.Repeat = repeat
+	}
+	if v := strings.TrimSpace(r.FormValue("repeat_interval")); v != "" {
+		if err := device.RepeatInterval.UnmarshalText([]byte(v)); err != nil {
+			renderIndex(w, r, PageData{Message: fmt.Sprintf("保存失败: 无效的重复间隔: %s", v)})
+			return
+		}
+	}
 
-	// 解析广播地址
-	broadcastAddr, err := net.ResolveUDPAddr("udp", broadcastIP+":9")
+	device, err := registry.Add(device)
 	if err != nil {
-		return fmt.Errorf("无法解析广播地址: %v", err)
+		renderIndex(w, r, PageData{Message: fmt.Sprintf("保存失败: %v", err)})
+		return
 	}
+	log.Printf("%s 添加了设备 %s (%s)", requestActor(r), device.Name, device.MAC)
 
-	// 创建UDP连接，监听所有接口
-	localAddr, err := net.ResolveUDPAddr("udp", ":0")
-	if err != nil {
-		return fmt.Errorf("无法解析本地地址: %v", err)
+	renderIndex(w, r, PageData{Message: fmt.Sprintf("设备 %s 已保存", device.Name), Success: true})
+}
+
+func handleDeviceDelete(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	if err := registry.Remove(r.FormValue("id")); err != nil {
+		renderIndex(w, r, PageData{Message: fmt.Sprintf("删除失败: %v", err)})
+		return
 	}
+	log.Printf("%s 删除了设备 %s", requestActor(r), r.FormValue("id"))
+
+	renderIndex(w, r, PageData{Message: "设备已删除", Success: true})
+}
 
-	conn, err := net.ListenUDP("udp", localAddr)
+func handleGroupAdd(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	steps, err := parseGroupSteps(r.FormValue("steps"))
 	if err != nil {
-		return fmt.Errorf("无法创建UDP连接: %v", err)
+		renderIndex(w, r, PageData{Message: fmt.Sprintf("保存失败: %v", err)})
+		return
+	}
+	group, err := registry.AddGroup(Group{
+		Name:       r.FormValue("name"),
+		Sequential: r.FormValue("sequential") != "",
+		Steps:      steps,
+	})
+	if err != nil {
+		renderIndex(w, r, PageData{Message: fmt.Sprintf("保存失败: %v", err)})
+		return
 	}
-	defer conn.Close()
+	log.Printf("%s 添加了分组 %s", requestActor(r), group.Name)
 
-	// 发送魔术包到广播地址
-	n, err := conn.WriteToUDP(magicPacket, broadcastAddr)
+	renderIndex(w, r, PageData{Message: fmt.Sprintf("分组 %s 已保存", group.Name), Success: true})
+}
+
+func handleGroupDelete(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	if err := registry.RemoveGroup(r.FormValue("id")); err != nil {
+		renderIndex(w, r, PageData{Message: fmt.Sprintf("删除失败: %v", err)})
+		return
+	}
+	log.Printf("%s 删除了分组 %s", requestActor(r), r.FormValue("id"))
+
+	renderIndex(w, r, PageData{Message: "分组已删除", Success: true})
+}
+
+func handleGroupWake(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	group, ok := registry.FindGroup(r.FormValue("id"))
+	if !ok {
+		renderIndex(w, r, PageData{Message: fmt.Sprintf("发送失败: %v", errGroupNotFound)})
+		return
+	}
+
+	log.Printf("%s 请求唤醒分组 %s", requestActor(r), group.Name)
+	extendWriteDeadline(w, group.timeout())
+	ctx := requestOrigin(r, sourceWeb)
+	result := wakeGroup(ctx, group, wakeWith(ctx))
+
+	data := PageData{Success: result.Success, Result: &result}
+	if result.Success {
+		data.Message = fmt.Sprintf("分组 %s 已全部唤醒", group.Name)
+	} else {
+		data.Message = fmt.Sprintf("分组 %s 唤醒未完成", group.Name)
+	}
+	renderIndex(w, r, data)
+}
+
+func handleScheduleAdd(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	schedule := Schedule{
+		Cron:      r.FormValue("cron"),
+		Timezone:  r.FormValue("timezone"),
+		SkipDates: strings.Split(r.FormValue("skip_dates"), ","),
+	}
+	schedule, err := registry.AddSchedule(r.FormValue("device"), schedule)
 	if err != nil {
-		return fmt.Errorf("发送数据包失败: %v", err)
+		renderIndex(w, r, PageData{Message: fmt.Sprintf("保存失败: %v", err)})
+		return
+	}
+	log.Printf("%s 添加了定时任务 %s (%s)", requestActor(r), schedule.ID, schedule.Cron)
+
+	renderIndex(w, r, PageData{Message: "定时任务已保存", Success: true})
+}
+
+func handleScheduleDelete(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	if err := registry.RemoveSchedule(r.FormValue("device"), r.FormValue("id")); err != nil {
+		renderIndex(w, r, PageData{Message: fmt.Sprintf("删除失败: %v", err)})
+		return
 	}
+	log.Printf("%s 删除了定时任务 %s", requestActor(r), r.FormValue("id"))
 
-	log.Printf("已发送唤醒包到 MAC: %s, 广播地址: %s, 发送字节数: %d", macAddr, broadcastIP, n)
+	renderIndex(w, r, PageData{Message: "定时任务已删除", Success: true})
+}
+
+// 唤醒包的发送方式
+const (
+	transportUDP      = "udp"      // UDP广播，默认方式
+	transportEthernet = "ethernet" // 原始以太网帧，EtherType 0x0842
+)
+
+// maxWakeRepeat 一次唤醒最多发送的唤醒包个数
+const maxWakeRepeat = 20
+
+// maxRepeatInterval 重复发送的最长间隔
+const maxRepeatInterval = 10 * time.Second
+
+// validateRepeat 检查重复次数和间隔，为0表示使用默认值
+func validateRepeat(repeat int, interval Duration) error {
+	if repeat < 0 || repeat > maxWakeRepeat {
+		return fmt.Errorf("%w: 重复次数应在1到%d之间: %d", errInvalidRepeat, maxWakeRepeat, repeat)
+	}
+	if interval < 0 || time.Duration(interval) > maxRepeatInterval {
+		return fmt.Errorf("%w: 重复间隔应在0到%s之间: %s", errInvalidRepeat, maxRepeatInterval, interval)
+	}
 	return nil
 }
 
-func parseMACAddress(macAddr string) ([]byte, error) {
-	// 移除常见的分隔符
-	macAddr = strings.ReplaceAll(macAddr, ":", "")
-	macAddr = strings.ReplaceAll(macAddr, "-", "")
-	macAddr = strings.ReplaceAll(macAddr, " ", "")
+// WakeTarget 一次唤醒请求的目标
+type WakeTarget struct {
+	MAC           string
+	Broadcast     string
+	Port          int
+	Password      string // SecureOn密码，可选
+	Transport     string // 发送方式，为空时使用UDP
+	Interface     string // 发送使用的网络接口，以太网方式必填
+	SourceIP      string // UDP方式绑定的源地址，可选
+	AllInterfaces bool   // UDP方式下在所有接口的定向广播地址上发送
+
+	Repeat         int      // 发送的唤醒包个数，为0时使用配置中的默认值
+	RepeatInterval Duration // 重复发送的间隔，为0时使用配置中的默认值
+}
 
-	// 验证格式
-	matched, _ := regexp.MatchString("^[0-9A-Fa-f]{12}$", macAddr)
-	if !matched {
-		return nil, fmt.Errorf("MAC地址格式不正确，应为12位十六进制字符")
+// withDefaults 用配置中的默认值补全未填写的广播地址、端口和发送方式
+func (t WakeTarget) withDefaults() WakeTarget {
+	if t.Broadcast == "" {
+		t.Broadcast = config.DefaultBroadcast
+	}
+	if t.Port == 0 {
+		t.Port = config.DefaultPort
+	}
+	if t.Transport == "" {
+		t.Transport = transportUDP
+	}
+	if t.Repeat == 0 {
+		t.Repeat = config.Repeat
+	}
+	if t.RepeatInterval == 0 {
+		t.RepeatInterval = config.RepeatInterval
 	}
+	return t
+}
 
-	// 转换为字节数组
-	mac, err := hex.DecodeString(macAddr)
-	if err != nil {
-		return nil, err
+// repeatDuration 返回重复发送所有唤醒包需要的时间
+func (t WakeTarget) repeatDuration() time.Duration {
+	if t.Repeat <= 1 {
+		return 0
 	}
+	return time.Duration(t.Repeat-1) * time.Duration(t.RepeatInterval)
+}
 
-	return mac, nil
+// destination 返回用于提示和日志的发送目标描述
+func (t WakeTarget) destination() string {
+	switch {
+	case t.Transport == transportEthernet:
+		return fmt.Sprintf("以太网接口: %s", t.Interface)
+	case t.AllInterfaces:
+		return fmt.Sprintf("所有接口的定向广播, 端口: %d", t.Port)
+	case t.Interface != "":
+		return fmt.Sprintf("广播地址: %s, 端口: %d, 接口: %s", t.Broadcast, t.Port, t.Interface)
+	case t.SourceIP != "":
+		return fmt.Sprintf("广播地址: %s, 端口: %d, 源地址: %s", t.Broadcast, t.Port, t.SourceIP)
+	default:
+		return fmt.Sprintf("广播地址: %s, 端口: %d", t.Broadcast, t.Port)
+	}
 }
 
-func createMagicPacket(mac []byte) []byte {
-	// 魔术包格式: 6个0xFF字节 + 16次重复的MAC地址
-	packet := make([]byte, 102)
+// validate 检查发送方式及其所需的参数
+func (t WakeTarget) validate() error {
+	if err := validateRepeat(t.Repeat, t.RepeatInterval); err != nil {
+		return err
+	}
 
-	// 前6个字节为0xFF
-	for i := 0; i < 6; i++ {
-		packet[i] = 0xFF
+	switch t.Transport {
+	case "", transportUDP:
+		source := net.ParseIP(t.SourceIP)
+		if t.SourceIP != "" && source == nil {
+			return fmt.Errorf("%w: 无效的源地址: %s", errInvalidAddress, t.SourceIP)
+		}
+		if t.AllInterfaces {
+			return nil
+		}
+		if addr, _ := wol.SplitHostZone(t.Broadcast); source != nil && net.ParseIP(addr) != nil && (source.To4() == nil) != (net.ParseIP(addr).To4() == nil) {
+			return fmt.Errorf("%w: 源地址 %s 与广播地址 %s 的协议不一致", errInvalidAddress, t.SourceIP, t.Broadcast)
+		}
+		return wrapWOLError(wol.CheckAddress(t.Broadcast, t.Interface))
+	case transportEthernet:
+		if t.Interface == "" {
+			return fmt.Errorf("%w: 以太网方式需要指定网络接口", errInvalidInterface)
+		}
+		if t.AllInterfaces {
+			return fmt.Errorf("%w: 在所有接口上发送仅支持UDP方式", errInvalidTransport)
+		}
+		return nil
+	default:
+		return fmt.Errorf("%w: %s", errInvalidTransport, t.Transport)
 	}
+}
 
-	// 后面重复16次MAC地址
-	for i := 0; i < 16; i++ {
-		copy(packet[6+i*6:], mac)
+func sendWakeOnLAN(target WakeTarget) error {
+	_, err := sendWakeOnLANWith(context.Background(), nil, target)
+	return err
+}
+
+// sendWake 在 ctx 下发送唤醒包，ctx 中的来源会写入审计日志
+func sendWake(ctx context.Context, target WakeTarget) error {
+	_, err := sendWakeOnLANWith(ctx, nil, target)
+	return err
+}
+
+// wakeWith 返回在 ctx 下发送唤醒包的函数，用于来源固定的一组唤醒
+func wakeWith(ctx context.Context) func(WakeTarget) error {
+	return func(target WakeTarget) error {
+		return sendWake(ctx, target)
 	}
+}
+
+// sendWakeOnLANWith 与 sendWakeOnLAN 相同，返回实际发送的唤醒包个数，udp 不为空时复用其中的UDP套接字
+//
+// 按 target.Repeat 重复发送，每次间隔 target.RepeatInterval；只要发出了一个包即视为成功，
+// 之后的发送失败只记录到日志。ctx 被取消时停止剩余的重复发送。
+// 每次尝试都写入审计日志，来源取自 ctx（见 withWakeOrigin）
+func sendWakeOnLANWith(ctx context.Context, udp *wol.UDPTransport, target WakeTarget) (packets int, err error) {
+	// 解析MAC地址
+	mac, err := wol.ParseMAC(target.MAC)
+	if err != nil {
+		err = wrapWOLError(err)
+		recordWake(ctx, target, "", 0, err)
+		return 0, err
+	}
+	// 之后的每次尝试都以规范化的MAC地址记录
+	defer func() { recordWake(ctx, target, wol.FormatMAC(mac), packets, err) }()
+
+	// 解析SecureOn密码
+	password, err := wol.ParsePassword(target.Password)
+	if err != nil {
+		return 0, wrapWOLError(err)
+	}
+
+	if err := target.validate(); err != nil {
+		return 0, err
+	}
+
+	if err := checkMAC(wol.FormatMAC(mac)); err != nil {
+		log.Printf("已拒绝唤醒请求, MAC: %s: %v", target.MAC, err)
+		return 0, err
+	}
+	if target.Transport == transportEthernet {
+		if err := checkInterface(target.Interface); err != nil {
+			log.Printf("已拒绝唤醒请求, MAC: %s: %v", target.MAC, err)
+			return 0, err
+		}
+	}
+
+	if udp == nil {
+		udp = newUDPTransport()
+		defer udp.Close()
+	}
+	var transport wol.Transport = udp
+	switch {
+	case target.Transport == transportEthernet:
+		transport = &wol.EthernetTransport{Timeout: time.Duration(config.SendTimeout)}
+	case target.AllInterfaces:
+		transport = allInterfacesTransport{udp: udp}
+	}
+	if limiter := packetLimiterOf(ctx); limiter != nil {
+		transport = limitedTransport{Transport: transport, limiter: limiter}
+	}
+
+	sender := wol.Sender{
+		Transport: transport,
+		Broadcast: target.Broadcast,
+		Port:      target.Port,
+		Interface: target.Interface,
+		SourceIP:  target.SourceIP,
+		Repeat:    target.Repeat,
+		Interval:  time.Duration(target.RepeatInterval),
+	}
+	result, err := sender.Send(ctx, wol.MagicPacket(mac, password))
+	if err != nil {
+		if errors.Is(err, errTargetNotAllowed) {
+			log.Printf("已拒绝唤醒请求, MAC: %s: %v", target.MAC, err)
+		}
+		return 0, wrapWOLError(err)
+	}
+	if result.Err != nil {
+		if errors.Is(result.Err, wol.ErrSend) {
+			sendErrors.WithLabelValues(transportLabel(target.Transport)).Inc()
+		}
+		log.Printf("重复发送唤醒包失败, MAC: %s, 已发送 %d 个: %v", target.MAC, result.Packets, result.Err)
+	}
+
+	log.Printf("已发送唤醒包到 MAC: %s, %s, 发送包数: %d, 发送字节数: %d", target.MAC, target.destination(), result.Packets, result.Bytes)
+	return result.Packets, nil
+}
+
+// recordWake 将一次唤醒尝试写入审计日志和指标，并发布到MQTT和webhook，
+// mac 为解析后的MAC地址，无效时为空
+func recordWake(ctx context.Context, target WakeTarget, mac string, packets int, err error) {
+	auditWake(ctx, target, mac, packets, err)
+	observeWake(ctx, target, mac, err)
+	mqttBridge.publishWake(ctx, mac, packets, err)
+	webhooks.fireWake(ctx, target, mac, packets, err)
+}
 
-	return packet
+// newUDPTransport 返回按配置的发送超时和 target_allowlist 发送的UDP方式，使用后需要关闭
+func newUDPTransport() *wol.UDPTransport {
+	return &wol.UDPTransport{Allow: checkDestination, Timeout: time.Duration(config.SendTimeout)}
 }
@@ -1,172 +1,95 @@
 package main
 
 import (
-	"bytes"
-	"encoding/hex"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 )
 
-func TestParseMACAddress(t *testing.T) {
+func TestWakeTargetValidate(t *testing.T) {
 	tests := []struct {
 		name    string
-		input   string
-		want    string
-		wantErr bool
+		target  WakeTarget
+		wantErr error
 	}{
-		{
-			name:    "Valid MAC with colons",
-			input:   "AA:BB:CC:DD:EE:FF",
-			want:    "aabbccddeeff",
-			wantErr: false,
-		},
-		{
-			name:    "Valid MAC with hyphens",
-			input:   "AA-BB-CC-DD-EE-FF",
-			want:    "aabbccddeeff",
-			wantErr: false,
-		},
-		{
-			name:    "Valid MAC without separators",
-			input:   "AABBCCDDEEFF",
-			want:    "aabbccddeeff",
-			wantErr: false,
-		},
-		{
-			name:    "Valid MAC lowercase",
-			input:   "aa:bb:cc:dd:ee:ff",
-			want:    "aabbccddeeff",
-			wantErr: false,
-		},
-		{
-			name:    "Valid MAC with spaces",
-			input:   "AA BB CC DD EE FF",
-			want:    "aabbccddeeff",
-			wantErr: false,
-		},
-		{
-			name:    "Invalid MAC - too short",
-			input:   "AA:BB:CC:DD:EE",
-			want:    "",
-			wantErr: true,
-		},
-		{
-			name:    "Invalid MAC - too long",
-			input:   "AA:BB:CC:DD:EE:FF:00",
-			want:    "",
-			wantErr: true,
-		},
-		{
-			name:    "Invalid MAC - invalid characters",
-			input:   "GG:HH:II:JJ:KK:LL",
-			want:    "",
-			wantErr: true,
-		},
-		{
-			name:    "Empty MAC",
-			input:   "",
-			want:    "",
-			wantErr: true,
-		},
+		{name: "Default", target: WakeTarget{}, wantErr: nil},
+		{name: "UDP", target: WakeTarget{Transport: transportUDP}, wantErr: nil},
+		{name: "UDP with source IP", target: WakeTarget{Transport: transportUDP, SourceIP: "192.168.1.10"}, wantErr: nil},
+		{name: "UDP with invalid source IP", target: WakeTarget{Transport: transportUDP, SourceIP: "not-an-ip"}, wantErr: errInvalidAddress},
+		{name: "Ethernet with interface", target: WakeTarget{Transport: transportEthernet, Interface: "eth0"}, wantErr: nil},
+		{name: "Ethernet without interface", target: WakeTarget{Transport: transportEthernet}, wantErr: errInvalidInterface},
+		{name: "Ethernet on all interfaces", target: WakeTarget{Transport: transportEthernet, Interface: "eth0", AllInterfaces: true}, wantErr: errInvalidTransport},
+		{name: "Unknown transport", target: WakeTarget{Transport: "carrier-pigeon"}, wantErr: errInvalidTransport},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := parseMACAddress(tt.input)
-			if (err != nil) != tt.wantErr {
-				t.Errorf("parseMACAddress() error = %v, wantErr %v", err, tt.wantErr)
-				return
-			}
-			if !tt.wantErr {
-				gotHex := hex.EncodeToString(got)
-				if gotHex != tt.want {
-					t.Errorf("parseMACAddress() = %v, want %v", gotHex, tt.want)
-				}
+			err := tt.target.validate()
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("validate() error = %v, want %v", err, tt.wantErr)
 			}
 		})
 	}
 }
 
-func TestCreateMagicPacket(t *testing.T) {
+func TestWakeTargetValidateIPv6(t *testing.T) {
 	tests := []struct {
-		name string
-		mac  []byte
+		name    string
+		target  WakeTarget
+		wantErr bool
 	}{
-		{
-			name: "Standard MAC address",
-			mac:  []byte{0xAA, 0xBB, 0xCC, 0xDD, 0xEE, 0xFF},
-		},
-		{
-			name: "All zeros MAC",
-			mac:  []byte{0x00, 0x00, 0x00, 0x00, 0x00, 0x00},
-		},
-		{
-			name: "All ones MAC",
-			mac:  []byte{0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF},
-		},
+		{name: "Multicast with zone", target: WakeTarget{Broadcast: "ff02::1%eth0"}},
+		{name: "Multicast with interface", target: WakeTarget{Broadcast: "ff02::1", Interface: "eth0"}},
+		{name: "IPv6 source", target: WakeTarget{Broadcast: "2001:db8::10", SourceIP: "2001:db8::1"}},
+		{name: "Multicast without interface", target: WakeTarget{Broadcast: "ff02::1"}, wantErr: true},
+		{name: "IPv4 source for IPv6 target", target: WakeTarget{Broadcast: "ff02::1%eth0", SourceIP: "192.168.1.10"}, wantErr: true},
+		{name: "IPv6 source for IPv4 target", target: WakeTarget{Broadcast: "192.168.1.255", SourceIP: "2001:db8::1"}, wantErr: true},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			packet := createMagicPacket(tt.mac)
-
-			// 检查包长度
-			if len(packet) != 102 {
-				t.Errorf("Magic packet length = %d, want 102", len(packet))
-			}
-
-			// 检查前6个字节是否都是0xFF
-			for i := 0; i < 6; i++ {
-				if packet[i] != 0xFF {
-					t.Errorf("Byte %d = 0x%02X, want 0xFF", i, packet[i])
-				}
-			}
-
-			// 检查后面是否重复了16次MAC地址
-			for i := 0; i < 16; i++ {
-				offset := 6 + i*6
-				macSlice := packet[offset : offset+6]
-				if !bytes.Equal(macSlice, tt.mac) {
-					t.Errorf("MAC repetition %d = %v, want %v", i, macSlice, tt.mac)
-				}
+			err := tt.target.validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validate() error = %v, wantErr %v", err, tt.wantErr)
 			}
 		})
 	}
 }
 
-func TestCreateMagicPacketStructure(t *testing.T) {
-	mac := []byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06}
-	packet := createMagicPacket(mac)
-
-	// 验证魔术包的完整结构
-	expected := make([]byte, 102)
+func TestSendWakeOnLANIPv6Unicast(t *testing.T) {
+	useTestRegistry(t)
 
-	// 前6个字节为0xFF
-	for i := 0; i < 6; i++ {
-		expected[i] = 0xFF
+	conn, err := net.ListenUDP("udp6", &net.UDPAddr{IP: net.IPv6loopback})
+	if err != nil {
+		t.Skipf("IPv6 not available: %v", err)
 	}
+	defer conn.Close()
+	port := conn.LocalAddr().(*net.UDPAddr).Port
 
-	// 后面重复16次MAC地址
-	for i := 0; i < 16; i++ {
-		copy(expected[6+i*6:], mac)
-	}
-
-	if !bytes.Equal(packet, expected) {
-		t.Errorf("Magic packet structure mismatch")
-		t.Logf("Got:      %x", packet)
-		t.Logf("Expected: %x", expected)
+	for _, host := range []string{"::1", "[::1]"} {
+		if err := sendWakeOnLAN(WakeTarget{MAC: "AA:BB:CC:DD:EE:FF", Broadcast: host, Port: port}); err != nil {
+			t.Fatalf("sendWakeOnLAN(%s) error = %v", host, err)
+		}
 	}
+	receivePackets(t, conn, 2)
 }
 
-func BenchmarkParseMACAddress(b *testing.B) {
-	macAddr := "AA:BB:CC:DD:EE:FF"
-	for i := 0; i < b.N; i++ {
-		parseMACAddress(macAddr)
+func TestHandleIndexRendersDevices(t *testing.T) {
+	r := useTestRegistry(t)
+	if _, err := r.Add(Device{Name: "书房NAS", MAC: "AA:BB:CC:DD:EE:FF", Transport: transportEthernet, Interface: "eth0"}); err != nil {
+		t.Fatalf("Add() error = %v", err)
 	}
-}
 
-func BenchmarkCreateMagicPacket(b *testing.B) {
-	mac := []byte{0xAA, 0xBB, 0xCC, 0xDD, 0xEE, 0xFF}
-	for i := 0; i < b.N; i++ {
-		createMagicPacket(mac)
+	rec := httptest.NewRecorder()
+	handleIndex(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	body := rec.Body.String()
+	for _, want := range []string{"书房NAS", "AA:BB:CC:DD:EE:FF", "以太网接口: eth0"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("index page does not contain %q", want)
+		}
 	}
 }
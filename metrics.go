@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/tdh62/wake_on_lan_proxy/wol"
+)
+
+// Prometheus 指标，在 /metrics 输出
+var (
+	wakeRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "wol_wake_requests_total",
+		Help: "唤醒请求数，result 为 success、invalid（输入错误）、rejected（发送策略拒绝）或 error（发送失败）",
+	}, []string{"device", "source", "transport", "result"})
+
+	macValidationFailures = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "wol_mac_validation_failures_total",
+		Help: "唤醒请求和设备登记中无效的MAC地址数",
+	})
+
+	sendErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "wol_send_errors_total",
+		Help: "发送唤醒包失败的次数，包括重复发送中失败的包",
+	}, []string{"transport"})
+
+	verifyDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "wol_verify_duration_seconds",
+		Help:    "唤醒后上线验证的用时，online 为 true 时即设备的上线用时",
+		Buckets: []float64{1, 2, 5, 10, 20, 30, 45, 60, 90, 120, 180, 300},
+	}, []string{"method", "online"})
+
+	relayPacketsReceived = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "wol_relay_packets_received_total",
+		Help: "中继收到的数据包数",
+	})
+
+	relayPackets = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "wol_relay_packets_total",
+		Help: "中继处理的数据包数，result 为 forwarded、rejected、suppressed、invalid 或 failed",
+	}, []string{"result"})
+
+	httpDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "wol_http_request_duration_seconds",
+		Help:    "HTTP请求的处理用时，handler 为注册的路径",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"handler", "method", "code"})
+)
+
+// handleMetrics 输出Prometheus格式的指标
+var handleMetrics = promhttp.Handler()
+
+// handle 注册HTTP处理函数，并记录其请求用时
+func handle(pattern string, handler http.HandlerFunc) {
+	http.Handle(pattern, promhttp.InstrumentHandlerDuration(
+		httpDuration.MustCurryWith(prometheus.Labels{"handler": pattern}), handler))
+}
+
+// wakeResult 将唤醒错误归类为指标的 result 标签
+func wakeResult(err error) string {
+	switch {
+	case err == nil:
+		return "success"
+	case errors.Is(err, errTargetNotAllowed):
+		return "rejected"
+	case wakeErrorStatus(err) == http.StatusBadRequest:
+		return "invalid"
+	default:
+		return "error"
+	}
+}
+
+// transportLabel 将发送方式归为固定的几个标签值；发送方式来自请求，
+// 直接作为标签会让客户端制造任意多的时间序列
+func transportLabel(transport string) string {
+	switch transport {
+	case "", transportUDP:
+		return transportUDP
+	case transportEthernet:
+		return transportEthernet
+	default:
+		return "invalid"
+	}
+}
+
+// observeWake 记录一次唤醒尝试，来源取自 ctx，mac 为解析后的MAC地址，无效时为空
+func observeWake(ctx context.Context, target WakeTarget, mac string, err error) {
+	if errors.Is(err, errInvalidMAC) {
+		macValidationFailures.Inc()
+	}
+	if errors.Is(err, wol.ErrSend) {
+		sendErrors.WithLabelValues(transportLabel(target.Transport)).Inc()
+	}
+
+	device := ""
+	if d, ok := registry.Find(mac); ok && mac != "" {
+		device = d.Name
+	}
+	source := ""
+	if origin := originOf(ctx); origin != nil {
+		source = origin.source
+	}
+	wakeRequests.WithLabelValues(device, source, transportLabel(target.Transport), wakeResult(err)).Inc()
+}
+
+// observeVerify 记录上线验证的用时，无法进行探测时不记录
+func observeVerify(result VerifyResult) {
+	if result.Error != "" {
+		return
+	}
+	online := "false"
+	if result.Online {
+		online = "true"
+	}
+	verifyDuration.WithLabelValues(result.Method, online).Observe(result.Elapsed.Round(time.Millisecond).Seconds())
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/tdh62/wake_on_lan_proxy/wol"
+)
+
+func TestSendWakeOnLANMetrics(t *testing.T) {
+	reg := useTestRegistry(t)
+	useFastVerify(t)
+	addTestDevices(t, reg, Device{Name: "nas", MAC: "AA:BB:CC:DD:EE:01"})
+	conn := listenTestUDP(t)
+	port := conn.LocalAddr().(*net.UDPAddr).Port
+
+	success := wakeRequests.WithLabelValues("nas", sourceAPI, transportUDP, "success")
+	invalid := wakeRequests.WithLabelValues("", sourceAPI, transportUDP, "invalid")
+	beforeSuccess, beforeInvalid := testutil.ToFloat64(success), testutil.ToFloat64(invalid)
+	beforeMAC := testutil.ToFloat64(macValidationFailures)
+
+	ctx := withWakeOrigin(context.Background(), sourceAPI, "", "")
+	sendWakeOnLANWith(ctx, nil, WakeTarget{MAC: "aa-bb-cc-dd-ee-01", Broadcast: "127.0.0.1", Port: port}.withDefaults())
+	sendWakeOnLANWith(ctx, nil, WakeTarget{MAC: "not-a-mac"}.withDefaults())
+
+	if got := testutil.ToFloat64(success) - beforeSuccess; got != 1 {
+		t.Errorf("successful wakes of nas = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(invalid) - beforeInvalid; got != 1 {
+		t.Errorf("invalid wakes = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(macValidationFailures) - beforeMAC; got != 1 {
+		t.Errorf("MAC validation failures = %v, want 1", got)
+	}
+}
+
+func TestWakeMetricsTransportLabel(t *testing.T) {
+	useTestRegistry(t)
+
+	invalid := wakeRequests.WithLabelValues("", sourceAPI, "invalid", "invalid")
+	before, series := testutil.ToFloat64(invalid), testutil.CollectAndCount(wakeRequests)
+
+	// 请求中任意的发送方式都归为 invalid，不会产生新的时间序列
+	ctx := withWakeOrigin(context.Background(), sourceAPI, "", "")
+	sendWakeOnLANWith(ctx, nil, WakeTarget{MAC: "AA:BB:CC:DD:EE:03", Transport: "bogus-1"}.withDefaults())
+	sendWakeOnLANWith(ctx, nil, WakeTarget{MAC: "AA:BB:CC:DD:EE:03", Transport: "bogus-2"}.withDefaults())
+
+	if got := testutil.ToFloat64(invalid) - before; got != 2 {
+		t.Errorf("wakes with an invalid transport = %v, want 2", got)
+	}
+	if got := testutil.CollectAndCount(wakeRequests); got != series {
+		t.Errorf("wake request series = %d, want %d", got, series)
+	}
+}
+
+func TestRelayMetrics(t *testing.T) {
+	r := newTestRelay(t, Config{RelayAllowlist: []string{"AA:BB:CC:DD:EE:02"}}, func(context.Context, WakeTarget) error { return nil })
+	src := &net.UDPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 9}
+
+	before := map[string]float64{}
+	for _, result := range []string{"forwarded", "rejected", "invalid"} {
+		before[result] = testutil.ToFloat64(relayPackets.WithLabelValues(result))
+	}
+	beforeReceived := testutil.ToFloat64(relayPacketsReceived)
+
+	allowed, _ := wol.ParseMAC("AA:BB:CC:DD:EE:02")
+	other, _ := wol.ParseMAC("AA:BB:CC:DD:EE:03")
+	r.handlePacket(wol.MagicPacket(allowed, nil), src)
+	r.handlePacket(wol.MagicPacket(other, nil), src)
+	r.handlePacket([]byte("garbage"), src)
+
+	if got := testutil.ToFloat64(relayPacketsReceived) - beforeReceived; got != 3 {
+		t.Errorf("relay packets received = %v, want 3", got)
+	}
+	for result, was := range before {
+		if got := testutil.ToFloat64(relayPackets.WithLabelValues(result)) - was; got != 1 {
+			t.Errorf("relay packets %s = %v, want 1", result, got)
+		}
+	}
+}
+
+func TestHandleMetrics(t *testing.T) {
+	mux := http.NewServeMux()
+	old := http.DefaultServeMux
+	http.DefaultServeMux = mux
+	t.Cleanup(func() { http.DefaultServeMux = old })
+
+	handle("/test", func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusTeapot) })
+	mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/test", nil))
+
+	rec := httptest.NewRecorder()
+	handleMetrics.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := rec.Body.String()
+	for _, want := range []string{
+		`wol_http_request_duration_seconds_count{code="418",handler="/test",method="get"} 1`,
+		"wol_wake_requests_total",
+		"wol_relay_packets_total",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics output does not contain %q", want)
+		}
+	}
+}
+
+func TestRequireAuthMetrics(t *testing.T) {
+	useTestAuth(t)
+
+	rec := httptest.NewRecorder()
+	whoami.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("status = %d, want 401 for unauthenticated scrapes", rec.Code)
+	}
+}
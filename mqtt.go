@@ -0,0 +1,295 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// MQTT主题，<prefix> 为 mqtt_topic_prefix，<id> 为设备ID：
+//
+//	<prefix>/status        服务在线状态 online/offline，保留消息，断线时由遗嘱消息设为 offline
+//	<prefix>/<device>/wake 唤醒命令，<device> 可以是设备ID、名称或MAC地址
+//	<prefix>/<id>/result   最近一次唤醒的结果（JSON），保留消息
+//	<prefix>/<id>/state    设备在线状态 online/offline，保留消息
+const (
+	mqttOnline  = "online"
+	mqttOffline = "offline"
+
+	mqttQoS = 1
+)
+
+// mqttPublishTimeout 等待broker确认一条消息的最长时间
+const mqttPublishTimeout = 5 * time.Second
+
+// MQTTBridge 连接MQTT broker，接收唤醒命令并发布唤醒结果和设备在线状态
+type MQTTBridge struct {
+	client   mqtt.Client
+	prefix   string
+	interval time.Duration
+	wake     func(context.Context, Device) error
+	done     chan struct{}
+	wg       sync.WaitGroup
+
+	// Home Assistant自动发现，discoveryPrefix 为空时不启用
+	discoveryPrefix string
+	nodeID          string
+
+	mu         sync.Mutex
+	states     map[string]bool   // 设备ID对应的最近一次发布的在线状态
+	discovered map[string]string // 已发布的自动发现配置，键为主题
+}
+
+// mqttBridge 当前运行的MQTT连接，未启用时为nil
+var mqttBridge *MQTTBridge
+
+// mqttWakeResult 发布到 result 主题的唤醒结果
+type mqttWakeResult struct {
+	Time    time.Time `json:"time"`
+	Device  string    `json:"device"`
+	MAC     string    `json:"mac"`
+	Source  string    `json:"source,omitempty"`
+	User    string    `json:"user,omitempty"`
+	Success bool      `json:"success"`
+	Packets int       `json:"packets"`
+	Error   string    `json:"error,omitempty"`
+}
+
+// newMQTTBridge 按配置连接broker，连接断开后自动重连
+func newMQTTBridge(cfg Config) *MQTTBridge {
+	b := &MQTTBridge{
+		prefix:   cfg.MQTTTopicPrefix,
+		interval: time.Duration(cfg.MQTTStateInterval),
+		wake:     wakeDevice,
+		done:     make(chan struct{}),
+		states:   make(map[string]bool),
+	}
+	if cfg.MQTTDiscovery {
+		b.discoveryPrefix = cfg.MQTTDiscoveryPrefix
+		b.nodeID = hassNodeID(cfg.MQTTClientID)
+	}
+
+	opts := mqtt.NewClientOptions().
+		AddBroker(cfg.MQTTBroker).
+		SetClientID(cfg.MQTTClientID).
+		SetUsername(cfg.MQTTUsername).
+		SetPassword(cfg.MQTTPassword).
+		SetWill(b.topic("status"), mqttOffline, mqttQoS, true).
+		SetConnectRetry(true).
+		SetAutoReconnect(true).
+		SetMaxReconnectInterval(time.Minute).
+		SetOrderMatters(false). // 唤醒命令可能要等待上线验证，不阻塞其他消息
+		SetOnConnectHandler(b.onConnect).
+		SetConnectionLostHandler(func(_ mqtt.Client, err error) {
+			log.Printf("MQTT连接断开: %v", err)
+		})
+	b.client = mqtt.NewClient(opts)
+	b.client.Connect()
+
+	if b.interval > 0 {
+		b.wg.Add(1)
+		go b.pollStates()
+	}
+	if b.discoveryPrefix != "" {
+		b.wg.Add(1)
+		go b.watchRegistry(registry.Watch())
+	}
+	return b
+}
+
+// Close 发布离线状态并断开连接
+func (b *MQTTBridge) Close() {
+	close(b.done)
+	b.wg.Wait()
+	if b.client.IsConnectionOpen() {
+		b.client.Publish(b.topic("status"), mqttQoS, true, mqttOffline).WaitTimeout(mqttPublishTimeout)
+	}
+	b.client.Disconnect(250)
+}
+
+func (b *MQTTBridge) topic(parts ...string) string {
+	return b.prefix + "/" + strings.Join(parts, "/")
+}
+
+// onConnect 在每次连接（包括重连）成功后发布在线状态并订阅唤醒命令
+func (b *MQTTBridge) onConnect(c mqtt.Client) {
+	log.Printf("已连接MQTT broker")
+	b.publish(b.topic("status"), true, mqttOnline)
+
+	token := c.Subscribe(b.topic("+", "wake"), mqttQoS, b.handleWake)
+	if token.WaitTimeout(mqttPublishTimeout) && token.Error() != nil {
+		log.Printf("订阅MQTT唤醒命令失败: %v", token.Error())
+	}
+
+	// broker可能丢失了保留消息，重连后重新发布自动发现配置，
+	// 并在下一次探测时重新发布所有设备的在线状态
+	b.mu.Lock()
+	b.states = make(map[string]bool)
+	b.discovered = nil
+	b.mu.Unlock()
+
+	if b.discoveryPrefix != "" {
+		b.syncDiscovery()
+		token := c.Subscribe(b.discoveryPrefix+"/+/"+b.nodeID+"/+/config", mqttQoS, b.handleStaleDiscovery)
+		if token.WaitTimeout(mqttPublishTimeout) && token.Error() != nil {
+			log.Printf("订阅Home Assistant自动发现配置失败: %v", token.Error())
+		}
+	}
+}
+
+// handleWake 处理 <prefix>/<device>/wake 命令，消息内容被忽略
+//
+// 保留消息在每次订阅（包括重连和服务重启）时都会重新收到，不能作为唤醒命令
+func (b *MQTTBridge) handleWake(_ mqtt.Client, msg mqtt.Message) {
+	ref := strings.TrimSuffix(strings.TrimPrefix(msg.Topic(), b.prefix+"/"), "/wake")
+	if msg.Retained() {
+		log.Printf("已忽略保留的MQTT唤醒命令: %s，请发布非保留消息", msg.Topic())
+		return
+	}
+	device, ok := registry.Find(ref)
+	if !ok {
+		log.Printf("MQTT唤醒命令的设备不存在: %s", ref)
+		return
+	}
+
+	log.Printf("MQTT请求唤醒设备 %s", device.Name)
+	if err := b.wake(withWakeOrigin(context.Background(), sourceMQTT, "", ""), device); err != nil {
+		log.Printf("MQTT唤醒设备 %s 失败: %v", device.Name, err)
+	}
+}
+
+// wakeDevice 按设备的配置唤醒，设备配置了上线验证时等待验证完成
+func wakeDevice(ctx context.Context, device Device) error {
+	if _, err := sendWakeOnLANWith(ctx, nil, device.target().withDefaults()); err != nil {
+		return err
+	}
+	if device.Verify != nil {
+		verifyWake(ctx, *device.Verify, device.MAC)
+	}
+	return nil
+}
+
+// publishWake 发布已登记设备的唤醒结果，未启用MQTT时不做任何事
+func (b *MQTTBridge) publishWake(ctx context.Context, mac string, packets int, err error) {
+	if b == nil || mac == "" {
+		return
+	}
+	device, ok := registry.Find(mac)
+	if !ok {
+		return
+	}
+
+	result := mqttWakeResult{
+		Time:    time.Now(),
+		Device:  device.Name,
+		MAC:     device.MAC,
+		Success: err == nil,
+		Packets: packets,
+	}
+	if err != nil {
+		result.Error = err.Error()
+	}
+	if origin := originOf(ctx); origin != nil {
+		result.Source, result.User = origin.source, origin.user
+	}
+	payload, _ := json.Marshal(result)
+	b.publish(b.topic(device.ID, "result"), true, payload)
+}
+
+// publishVerification 根据上线验证的结果发布设备在线状态，无法进行探测时不发布
+func (b *MQTTBridge) publishVerification(mac string, result VerifyResult) {
+	if b == nil || result.Error != "" {
+		return
+	}
+	if device, ok := registry.Find(mac); ok {
+		b.publishState(device, result.Online)
+	}
+}
+
+// publishState 发布设备在线状态，与上次发布的相同时跳过
+func (b *MQTTBridge) publishState(device Device, online bool) {
+	b.mu.Lock()
+	last, ok := b.states[device.ID]
+	b.states[device.ID] = online
+	b.mu.Unlock()
+	if ok && last == online {
+		return
+	}
+
+	state := mqttOffline
+	if online {
+		state = mqttOnline
+	}
+	b.publish(b.topic(device.ID, "state"), true, state)
+}
+
+// pollStates 定期探测配置了上线验证的设备，发布在线状态的变化
+func (b *MQTTBridge) pollStates() {
+	defer b.wg.Done()
+
+	ticker := time.NewTicker(b.interval)
+	defer ticker.Stop()
+	for {
+		if b.client.IsConnectionOpen() {
+			b.checkStates()
+		}
+		select {
+		case <-b.done:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (b *MQTTBridge) checkStates() {
+	for _, d := range registry.List() {
+		if d.Verify == nil {
+			continue
+		}
+		online, err := probe(context.Background(), *d.Verify, d.MAC)
+		if err != nil {
+			continue
+		}
+		b.publishState(d, online)
+	}
+}
+
+// publish 发布一条消息，不等待broker确认，避免broker不可用时拖慢唤醒请求；
+// 未连接时丢弃消息，在线状态会在重连后重新发布
+func (b *MQTTBridge) publish(topic string, retained bool, payload interface{}) {
+	if !b.client.IsConnectionOpen() {
+		return
+	}
+	token := b.client.Publish(topic, mqttQoS, retained, payload)
+	go func() {
+		if !token.WaitTimeout(mqttPublishTimeout) {
+			log.Printf("发布MQTT消息超时: %s", topic)
+		} else if err := token.Error(); err != nil {
+			log.Printf("发布MQTT消息失败: %s: %v", topic, err)
+		}
+	}()
+}
+
+// validateMQTTBroker 检查broker地址，如 tcp://localhost:1883 或 ssl://broker:8883
+func validateMQTTBroker(broker string) error {
+	u, err := url.Parse(broker)
+	if err != nil {
+		return fmt.Errorf("无效的MQTT broker地址: %s", broker)
+	}
+	switch u.Scheme {
+	case "tcp", "mqtt", "ssl", "tls", "mqtts", "ws", "wss":
+	default:
+		return fmt.Errorf("不支持的MQTT broker协议: %s", broker)
+	}
+	if u.Host == "" {
+		return fmt.Errorf("无效的MQTT broker地址: %s", broker)
+	}
+	return nil
+}
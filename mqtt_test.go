@@ -0,0 +1,345 @@
+package main
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/eclipse/paho.mqtt.golang/packets"
+
+	"github.com/tdh62/wake_on_lan_proxy/wol"
+)
+
+// testBroker 测试用的最小MQTT 3.1.1 broker，支持保留消息、遗嘱消息和 + 通配符，
+// 转发给订阅者时使用QoS 0
+type testBroker struct {
+	ln net.Listener
+
+	mu       sync.Mutex
+	retained map[string]string
+	subs     map[net.Conn][]string
+	will     *packets.PublishPacket // 最近一个连接的遗嘱消息
+}
+
+func startTestBroker(t *testing.T) *testBroker {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	b := &testBroker{ln: ln, retained: make(map[string]string), subs: make(map[net.Conn][]string)}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go b.serveConn(conn)
+		}
+	}()
+	return b
+}
+
+func (b *testBroker) url() string {
+	return "tcp://" + b.ln.Addr().String()
+}
+
+func (b *testBroker) serveConn(conn net.Conn) {
+	var will *packets.PublishPacket
+	defer func() {
+		conn.Close()
+		b.mu.Lock()
+		delete(b.subs, conn)
+		b.mu.Unlock()
+		if will != nil {
+			b.route(will)
+		}
+	}()
+
+	for {
+		cp, err := packets.ReadPacket(conn)
+		if err != nil {
+			return
+		}
+		switch p := cp.(type) {
+		case *packets.ConnectPacket:
+			if p.WillFlag {
+				will = packets.NewControlPacket(packets.Publish).(*packets.PublishPacket)
+				will.TopicName, will.Payload, will.Retain = p.WillTopic, p.WillMessage, p.WillRetain
+				b.mu.Lock()
+				b.will = will
+				b.mu.Unlock()
+			}
+			b.write(conn, packets.NewControlPacket(packets.Connack))
+		case *packets.SubscribePacket:
+			ack := packets.NewControlPacket(packets.Suback).(*packets.SubackPacket)
+			ack.MessageID = p.MessageID
+			ack.ReturnCodes = make([]byte, len(p.Topics))
+			b.mu.Lock()
+			b.subs[conn] = append(b.subs[conn], p.Topics...)
+			ack.Write(conn)
+			// 订阅后立即收到匹配的保留消息
+			for topic, payload := range b.retained {
+				for _, filter := range p.Topics {
+					if topicMatches(filter, topic) {
+						out := packets.NewControlPacket(packets.Publish).(*packets.PublishPacket)
+						out.TopicName, out.Payload, out.Retain = topic, []byte(payload), true
+						out.Write(conn)
+						break
+					}
+				}
+			}
+			b.mu.Unlock()
+		case *packets.PublishPacket:
+			if p.Qos > 0 {
+				ack := packets.NewControlPacket(packets.Puback).(*packets.PubackPacket)
+				ack.MessageID = p.MessageID
+				b.write(conn, ack)
+			}
+			b.route(p)
+		case *packets.PingreqPacket:
+			b.write(conn, packets.NewControlPacket(packets.Pingresp))
+		case *packets.DisconnectPacket:
+			will = nil
+			return
+		}
+	}
+}
+
+func (b *testBroker) write(conn net.Conn, p packets.ControlPacket) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	p.Write(conn)
+}
+
+// route 保存保留消息，并转发给订阅了匹配主题的连接
+func (b *testBroker) route(p *packets.PublishPacket) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if p.Retain {
+		if len(p.Payload) == 0 {
+			delete(b.retained, p.TopicName)
+		} else {
+			b.retained[p.TopicName] = string(p.Payload)
+		}
+	}
+	for conn, filters := range b.subs {
+		for _, filter := range filters {
+			if topicMatches(filter, p.TopicName) {
+				out := packets.NewControlPacket(packets.Publish).(*packets.PublishPacket)
+				out.TopicName, out.Payload = p.TopicName, p.Payload
+				out.Write(conn)
+				break
+			}
+		}
+	}
+}
+
+// inject 模拟其他客户端发布一条消息
+func (b *testBroker) inject(topic, payload string) {
+	p := packets.NewControlPacket(packets.Publish).(*packets.PublishPacket)
+	p.TopicName, p.Payload = topic, []byte(payload)
+	b.route(p)
+}
+
+func topicMatches(filter, topic string) bool {
+	fs, ts := strings.Split(filter, "/"), strings.Split(topic, "/")
+	for i, f := range fs {
+		if f == "#" {
+			return true
+		}
+		if i >= len(ts) || (f != "+" && f != ts[i]) {
+			return false
+		}
+	}
+	return len(fs) == len(ts)
+}
+
+// waitFor 等待条件成立，超时则测试失败
+func (b *testBroker) waitFor(t *testing.T, what string, cond func(b *testBroker) bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		b.mu.Lock()
+		ok := cond(b)
+		b.mu.Unlock()
+		if ok {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	t.Fatalf("timed out waiting for %s, retained = %v", what, b.retained)
+}
+
+// waitRetained 等待主题的保留消息包含 want
+func (b *testBroker) waitRetained(t *testing.T, topic, want string) {
+	t.Helper()
+	b.waitFor(t, topic+" to contain "+want, func(b *testBroker) bool {
+		return strings.Contains(b.retained[topic], want)
+	})
+}
+
+// waitSubscribed 等待有客户端订阅了 filter
+func (b *testBroker) waitSubscribed(t *testing.T, filter string) {
+	t.Helper()
+	b.waitFor(t, "subscription to "+filter, func(b *testBroker) bool {
+		for _, filters := range b.subs {
+			for _, f := range filters {
+				if f == filter {
+					return true
+				}
+			}
+		}
+		return false
+	})
+}
+
+// useTestMQTT 连接到测试broker，并作为当前的MQTT连接，
+// 默认不探测设备在线状态，configure 可以修改连接使用的配置
+func useTestMQTT(t *testing.T, broker *testBroker, configure func(c *Config)) *MQTTBridge {
+	t.Helper()
+
+	cfg := config
+	cfg.MQTTBroker = broker.url()
+	cfg.MQTTStateInterval = 0
+	if configure != nil {
+		configure(&cfg)
+	}
+	b := newMQTTBridge(cfg)
+	old := mqttBridge
+	mqttBridge = b
+	t.Cleanup(func() {
+		mqttBridge = old
+		b.Close()
+	})
+	broker.waitRetained(t, "wol/status", mqttOnline)
+	broker.waitSubscribed(t, "wol/+/wake")
+	return b
+}
+
+func listenTestTCP(t *testing.T) net.Listener {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	return ln
+}
+
+func TestMQTTWakeCommand(t *testing.T) {
+	reg := useTestRegistry(t)
+	useFastVerify(t)
+	conn := listenTestUDP(t)
+	ln := listenTestTCP(t)
+	devices := addTestDevices(t, reg, Device{
+		Name:      "nas",
+		MAC:       "AA:BB:CC:DD:EE:10",
+		Broadcast: "127.0.0.1",
+		Port:      conn.LocalAddr().(*net.UDPAddr).Port,
+		Verify:    &VerifyConfig{Method: verifyTCP, Host: "127.0.0.1", Port: ln.Addr().(*net.TCPAddr).Port},
+	})
+	broker := startTestBroker(t)
+	useTestMQTT(t, broker, nil)
+
+	broker.inject("wol/nas/wake", "PRESS")
+	receivePackets(t, conn, 1)
+
+	id := devices["nas"].ID
+	broker.waitRetained(t, "wol/"+id+"/result", `"success":true`)
+	broker.waitRetained(t, "wol/"+id+"/result", `"source":"mqtt"`)
+	broker.waitRetained(t, "wol/"+id+"/state", mqttOnline)
+}
+
+func TestMQTTIgnoresRetainedWake(t *testing.T) {
+	reg := useTestRegistry(t)
+	conn := listenTestUDP(t)
+	port := conn.LocalAddr().(*net.UDPAddr).Port
+	devices := addTestDevices(t, reg,
+		Device{Name: "nas", MAC: "AA:BB:CC:DD:EE:13", Broadcast: "127.0.0.1", Port: port},
+		Device{Name: "pc", MAC: "AA:BB:CC:DD:EE:14", Broadcast: "127.0.0.1", Port: port},
+	)
+	broker := startTestBroker(t)
+	// 之前以保留消息发布的唤醒命令，订阅时会立即收到
+	broker.mu.Lock()
+	broker.retained["wol/nas/wake"] = "PRESS"
+	broker.mu.Unlock()
+	useTestMQTT(t, broker, nil)
+
+	// 保留消息在普通命令之前送达，收到的第一个唤醒包应该来自普通命令
+	broker.inject("wol/pc/wake", "PRESS")
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	buf := make([]byte, 1024)
+	n, _, err := conn.ReadFromUDP(buf)
+	if err != nil {
+		t.Fatalf("no packet received: %v", err)
+	}
+	if mac, _, err := wol.ParseMagicPacket(buf[:n]); err != nil || wol.FormatMAC(mac) != "AA:BB:CC:DD:EE:14" {
+		t.Errorf("received wake for %v (%v), want only the non-retained command", mac, err)
+	}
+	conn.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+	if _, _, err := conn.ReadFromUDP(buf); err == nil {
+		t.Errorf("received a second packet, want the retained command ignored")
+	}
+	broker.waitRetained(t, "wol/"+devices["pc"].ID+"/result", `"success":true`)
+}
+
+func TestMQTTPublishesWakesFromOtherSources(t *testing.T) {
+	reg := useTestRegistry(t)
+	conn := listenTestUDP(t)
+	devices := addTestDevices(t, reg, Device{Name: "pc", MAC: "AA:BB:CC:DD:EE:11"})
+	broker := startTestBroker(t)
+	useTestMQTT(t, broker, nil)
+
+	ctx := withWakeOrigin(context.Background(), sourceWeb, "admin", "192.0.2.1")
+	sendWakeOnLANWith(ctx, nil, WakeTarget{MAC: "aa:bb:cc:dd:ee:11", Broadcast: "127.0.0.1", Port: conn.LocalAddr().(*net.UDPAddr).Port}.withDefaults())
+
+	broker.waitRetained(t, "wol/"+devices["pc"].ID+"/result", `"user":"admin"`)
+}
+
+func TestMQTTStatePolling(t *testing.T) {
+	reg := useTestRegistry(t)
+	useFastVerify(t)
+	ln := listenTestTCP(t)
+	devices := addTestDevices(t, reg, Device{
+		Name:   "server",
+		MAC:    "AA:BB:CC:DD:EE:12",
+		Verify: &VerifyConfig{Method: verifyTCP, Host: "127.0.0.1", Port: ln.Addr().(*net.TCPAddr).Port},
+	})
+	broker := startTestBroker(t)
+	useTestMQTT(t, broker, func(c *Config) { c.MQTTStateInterval = Duration(20 * time.Millisecond) })
+
+	topic := "wol/" + devices["server"].ID + "/state"
+	broker.waitRetained(t, topic, mqttOnline)
+	ln.Close()
+	broker.waitRetained(t, topic, mqttOffline)
+}
+
+func TestMQTTStatusAndWill(t *testing.T) {
+	broker := startTestBroker(t)
+	cfg := config
+	cfg.MQTTBroker = broker.url()
+	b := newMQTTBridge(cfg)
+	broker.waitRetained(t, "wol/status", mqttOnline)
+
+	broker.mu.Lock()
+	will := broker.will
+	broker.mu.Unlock()
+	if will == nil || will.TopicName != "wol/status" || string(will.Payload) != mqttOffline || !will.Retain {
+		t.Fatalf("will = %+v, want retained offline on wol/status", will)
+	}
+
+	b.Close()
+	broker.waitRetained(t, "wol/status", mqttOffline)
+}
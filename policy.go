@@ -0,0 +1,75 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// errTargetNotAllowed 唤醒目标不符合配置的发送策略
+var errTargetNotAllowed = errors.New("目标不在允许范围内")
+
+// parseAllowedNetwork 解析允许列表中的一项，可以是CIDR（192.168.1.0/24）或单个地址（192.168.1.255）
+func parseAllowedNetwork(s string) (*net.IPNet, error) {
+	s = strings.TrimSpace(s)
+	if strings.Contains(s, "/") {
+		_, network, err := net.ParseCIDR(s)
+		return network, err
+	}
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return nil, fmt.Errorf("无效的地址: %s", s)
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		return &net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)}, nil
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}, nil
+}
+
+// checkDestination 检查数据包的目的地址是否在 target_allowlist 中，未配置时不限制
+func checkDestination(ip net.IP) error {
+	if len(config.TargetAllowlist) == 0 {
+		return nil
+	}
+	for _, s := range config.TargetAllowlist {
+		network, err := parseAllowedNetwork(s)
+		if err == nil && network.Contains(ip) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: 目的地址 %s 不在允许的网络中", errTargetNotAllowed, ip)
+}
+
+// checkInterface 检查以太网帧方式使用的接口：以太网帧不经过IP路由，配置了 target_allowlist 时
+// 接口至少要有一个子网的定向广播地址在列表中，否则改用以太网帧方式即可绕过允许列表
+func checkInterface(name string) error {
+	if len(config.TargetAllowlist) == 0 {
+		return nil
+	}
+	ifaces, _ := listInterfaces()
+	for _, iface := range ifaces {
+		if iface.Name != name {
+			continue
+		}
+		for _, addr := range iface.Addresses {
+			if checkDestination(net.ParseIP(addr.Broadcast)) == nil {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("%w: 接口 %s 的子网不在允许的网络中", errTargetNotAllowed, name)
+}
+
+// checkMAC 启用 target_registered_only 时，只允许唤醒已登记的设备
+func checkMAC(macAddr string) error {
+	if !config.TargetRegisteredOnly {
+		return nil
+	}
+	for _, d := range registry.List() {
+		if d.MAC == macAddr {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: MAC地址 %s 不是已登记的设备", errTargetNotAllowed, macAddr)
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// usePolicy 设置发送策略，测试结束后恢复
+func usePolicy(t *testing.T, allowlist []string, registeredOnly bool) {
+	t.Helper()
+
+	old := config
+	config.TargetAllowlist = allowlist
+	config.TargetRegisteredOnly = registeredOnly
+	t.Cleanup(func() { config = old })
+}
+
+func TestCheckDestination(t *testing.T) {
+	usePolicy(t, []string{"192.168.1.0/24", "10.0.0.255", "127.0.0.1"}, false)
+
+	tests := []struct {
+		ip      string
+		allowed bool
+	}{
+		{ip: "192.168.1.255", allowed: true},
+		{ip: "192.168.1.20", allowed: true},
+		{ip: "10.0.0.255", allowed: true},
+		{ip: "127.0.0.1", allowed: true},
+		{ip: "10.0.0.1", allowed: false},
+		{ip: "8.8.8.8", allowed: false},
+		{ip: "255.255.255.255", allowed: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ip, func(t *testing.T) {
+			err := checkDestination(net.ParseIP(tt.ip))
+			if (err == nil) != tt.allowed {
+				t.Errorf("checkDestination(%s) error = %v, want allowed %v", tt.ip, err, tt.allowed)
+			}
+			if err != nil && !errors.Is(err, errTargetNotAllowed) {
+				t.Errorf("error %v does not wrap errTargetNotAllowed", err)
+			}
+		})
+	}
+}
+
+func TestCheckDestinationUnrestricted(t *testing.T) {
+	usePolicy(t, nil, false)
+
+	if err := checkDestination(net.ParseIP("8.8.8.8")); err != nil {
+		t.Errorf("checkDestination() error = %v, want no restriction without allowlist", err)
+	}
+}
+
+func TestSendWakeOnLANPolicy(t *testing.T) {
+	reg := useTestRegistry(t)
+	if _, err := reg.Add(Device{Name: "NAS", MAC: "11:22:33:44:55:66"}); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	usePolicy(t, []string{"127.0.0.0/8"}, true)
+
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("ListenUDP() error = %v", err)
+	}
+	defer conn.Close()
+	port := conn.LocalAddr().(*net.UDPAddr).Port
+
+	tests := []struct {
+		name    string
+		target  WakeTarget
+		allowed bool
+	}{
+		{name: "Registered device in allowed network", target: WakeTarget{MAC: "11-22-33-44-55-66", Broadcast: "127.0.0.1", Port: port}, allowed: true},
+		{name: "Unregistered MAC", target: WakeTarget{MAC: "AA:BB:CC:DD:EE:FF", Broadcast: "127.0.0.1", Port: port}},
+		{name: "Public address", target: WakeTarget{MAC: "11:22:33:44:55:66", Broadcast: "8.8.8.8", Port: port}},
+		{name: "Limited broadcast outside allowlist", target: WakeTarget{MAC: "11:22:33:44:55:66", Broadcast: "255.255.255.255", Port: port}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := sendWakeOnLAN(tt.target)
+			if tt.allowed && err != nil {
+				t.Fatalf("sendWakeOnLAN() error = %v, want success", err)
+			}
+			if !tt.allowed && !errors.Is(err, errTargetNotAllowed) {
+				t.Fatalf("sendWakeOnLAN() error = %v, want errTargetNotAllowed", err)
+			}
+		})
+	}
+}
+
+func TestHandleAPIWakeForbidden(t *testing.T) {
+	useTestRegistry(t)
+	usePolicy(t, []string{"192.168.1.0/24"}, false)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/wake", strings.NewReader(`{"mac":"AA:BB:CC:DD:EE:FF","broadcast":"8.8.8.8"}`))
+	rec := httptest.NewRecorder()
+	handleAPIWake(rec, req)
+
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("status = %d, want 403 (body: %s)", rec.Code, rec.Body.String())
+	}
+	if !strings.Contains(rec.Body.String(), "8.8.8.8") {
+		t.Errorf("body = %s, want the rejected address in the error", rec.Body.String())
+	}
+}
+
+func TestCheckInterface(t *testing.T) {
+	ifaces, _ := listInterfaces()
+	if len(ifaces) == 0 {
+		t.Skip("没有可用的网络接口")
+	}
+	iface := ifaces[0]
+
+	usePolicy(t, nil, false)
+	if err := checkInterface("missing0"); err != nil {
+		t.Errorf("checkInterface() without allowlist error = %v", err)
+	}
+
+	usePolicy(t, []string{iface.Addresses[0].Network}, false)
+	if err := checkInterface(iface.Name); err != nil {
+		t.Errorf("checkInterface(%s) with its subnet allowed error = %v", iface.Name, err)
+	}
+	if err := checkInterface("missing0"); !errors.Is(err, errTargetNotAllowed) {
+		t.Errorf("checkInterface() unknown interface error = %v", err)
+	}
+
+	// 回环地址不属于任何列出的接口
+	usePolicy(t, []string{"127.0.0.1"}, false)
+	if err := checkInterface(iface.Name); !errors.Is(err, errTargetNotAllowed) {
+		t.Errorf("checkInterface(%s) outside the allowlist error = %v", iface.Name, err)
+	}
+}
+
+func TestHandleAPIWakeEthernetForbidden(t *testing.T) {
+	ifaces, _ := listInterfaces()
+	if len(ifaces) == 0 {
+		t.Skip("没有可用的网络接口")
+	}
+	useTestRegistry(t)
+	usePolicy(t, []string{"127.0.0.1"}, false)
+
+	// 改用以太网帧方式不能绕过允许列表
+	body := fmt.Sprintf(`{"mac":"AA:BB:CC:DD:EE:FF","transport":"ethernet","interface":%q}`, ifaces[0].Name)
+	rec := httptest.NewRecorder()
+	handleAPIWake(rec, httptest.NewRequest(http.MethodPost, "/api/v1/wake", strings.NewReader(body)))
+
+	if rec.Code != http.StatusForbidden || !strings.Contains(rec.Body.String(), ifaces[0].Name) {
+		t.Errorf("status = %d, want 403 naming the interface (body: %s)", rec.Code, rec.Body.String())
+	}
+}
+
+func TestHandleAPIWakeVerifyHostForbidden(t *testing.T) {
+	useTestRegistry(t)
+	usePolicy(t, []string{"127.0.0.1"}, false)
+	conn := listenTestUDP(t)
+
+	body := fmt.Sprintf(`{"mac":"AA:BB:CC:DD:EE:FF","broadcast":"127.0.0.1","port":%d,"verify":{"method":"tcp","host":"192.0.2.10","port":22}}`,
+		conn.LocalAddr().(*net.UDPAddr).Port)
+	rec := httptest.NewRecorder()
+	handleAPIWake(rec, httptest.NewRequest(http.MethodPost, "/api/v1/wake", strings.NewReader(body)))
+
+	if rec.Code != http.StatusForbidden || !strings.Contains(rec.Body.String(), "192.0.2.10") {
+		t.Errorf("status = %d, want 403 naming the verify host (body: %s)", rec.Code, rec.Body.String())
+	}
+	conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	if _, _, err := conn.ReadFromUDP(make([]byte, 1024)); err == nil {
+		t.Error("wake packet was sent although the verify host is not allowed")
+	}
+}
+
+func TestProbePolicy(t *testing.T) {
+	useFastVerify(t)
+	usePolicy(t, []string{"192.168.1.0/24"}, false)
+	ln := listenTestTCP(t)
+
+	for _, v := range []VerifyConfig{
+		{Method: verifyTCP, Host: "127.0.0.1", Port: ln.Addr().(*net.TCPAddr).Port},
+		{Method: verifyPing, Host: "127.0.0.1"},
+		{Method: verifyARP, Host: "127.0.0.1"},
+	} {
+		online, err := probe(context.Background(), v, "")
+		if online || !errors.Is(err, errTargetNotAllowed) {
+			t.Errorf("probe(%s) = %v, %v, want errTargetNotAllowed", v.Method, online, err)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// proxyRewakeInterval 等待后端上线期间重发唤醒包的间隔，防止第一个包丢失
+const proxyRewakeInterval = 15 * time.Second
+
+// deviceWaker 按需唤醒代理共用的唤醒逻辑：
+// 多个等待中的请求共享一次唤醒，每隔 proxyRewakeInterval 才会重发
+type deviceWaker struct {
+	device string // 设备ID、名称或MAC地址，每次唤醒时在设备列表中查找
+	send   func(context.Context, WakeTarget) error
+
+	mu       sync.Mutex
+	lastWake time.Time
+}
+
+func newDeviceWaker(device string) *deviceWaker {
+	return &deviceWaker{device: device, send: sendWake}
+}
+
+// wake 唤醒设备，ctx 中为触发唤醒的客户端，reason 用于日志，说明是什么请求触发了唤醒
+func (w *deviceWaker) wake(ctx context.Context, reason string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if time.Since(w.lastWake) < proxyRewakeInterval {
+		return nil
+	}
+
+	device, ok := registry.Find(w.device)
+	if !ok {
+		return fmt.Errorf("%w: %s", errDeviceNotFound, w.device)
+	}
+	log.Printf("%s，唤醒设备 %s", reason, device.Name)
+	if err := w.send(ctx, device.target().withDefaults()); err != nil {
+		return err
+	}
+	w.lastWake = time.Now()
+	return nil
+}
+
+// reset 清除唤醒记录，下一次请求会立即重新唤醒
+func (w *deviceWaker) reset() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.lastWake = time.Time{}
+}
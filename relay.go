@@ -0,0 +1,300 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/tdh62/wake_on_lan_proxy/wol"
+)
+
+// relayDedupWindow 同一MAC地址在该时间窗口内只转发一次，
+// 既避免重复转发发送端连发的多个包，也防止收到自己转发出去的广播形成环路
+const relayDedupWindow = 2 * time.Second
+
+// 中继面向广域网，来源地址可以伪造，统计和日志都要限制数量
+const (
+	maxRelaySources  = 1024             // 最多统计的来源地址数，超出时淘汰最久未出现的来源
+	relayLogInterval = 10 * time.Second // 无效和被拒绝的包在该间隔内最多记录一条日志
+)
+
+// RelayStats 中继按来源地址统计的计数
+type RelayStats struct {
+	Source     string    `json:"source"`
+	Received   uint64    `json:"received"`
+	Forwarded  uint64    `json:"forwarded"`
+	Invalid    uint64    `json:"invalid"`
+	Rejected   uint64    `json:"rejected"`
+	Suppressed uint64    `json:"suppressed"`
+	Failed     uint64    `json:"failed"`
+	LastSeen   time.Time `json:"last_seen"`
+}
+
+// Relay 中继监听器：接收来自广域网的魔术包，校验后在局域网重新广播
+type Relay struct {
+	conn           *net.UDPConn
+	interfaces     []string
+	port           int
+	allowlist      map[string]bool
+	registeredOnly bool
+	forward        func(context.Context, WakeTarget) error
+	invalidLog     logLimiter
+	rejectedLog    logLimiter
+	mu             sync.Mutex
+	stats          map[string]*RelayStats
+	lastForwarded  map[string]time.Time
+}
+
+// logLimiter 限制同类日志的频率，期间被抑制的条数在下一条日志中报告
+type logLimiter struct {
+	interval   time.Duration
+	mu         sync.Mutex
+	last       time.Time
+	suppressed int
+}
+
+func (l *logLimiter) Printf(format string, args ...interface{}) {
+	l.mu.Lock()
+	now := time.Now()
+	if !l.last.IsZero() && now.Sub(l.last) < l.interval {
+		l.suppressed++
+		l.mu.Unlock()
+		return
+	}
+	suppressed := l.suppressed
+	l.last, l.suppressed = now, 0
+	l.mu.Unlock()
+
+	if suppressed > 0 {
+		format += fmt.Sprintf("（此前 %s 内另有 %d 条同类日志未记录）", l.interval, suppressed)
+	}
+	log.Printf(format, args...)
+}
+
+// relay 当前运行的中继，未启用时为nil
+var relay *Relay
+
+// newRelay 按配置开始监听，调用 serve 处理收到的数据包
+func newRelay(cfg Config) (*Relay, error) {
+	addr, err := net.ResolveUDPAddr("udp", cfg.RelayListen)
+	if err != nil {
+		return nil, fmt.Errorf("无法解析中继监听地址: %v", err)
+	}
+	conn, err := net.ListenUDP("udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("无法启动中继监听: %v", err)
+	}
+
+	r := &Relay{
+		conn:           conn,
+		interfaces:     cfg.RelayInterfaces,
+		port:           cfg.RelayPort,
+		registeredOnly: cfg.RelayRegisteredOnly,
+		invalidLog:     logLimiter{interval: relayLogInterval},
+		rejectedLog:    logLimiter{interval: relayLogInterval},
+		forward:        sendWake,
+		stats:          make(map[string]*RelayStats),
+		lastForwarded:  make(map[string]time.Time),
+	}
+	if len(cfg.RelayAllowlist) > 0 {
+		r.allowlist = make(map[string]bool, len(cfg.RelayAllowlist))
+		for _, s := range cfg.RelayAllowlist {
+			mac, _ := wol.ParseMAC(s)
+			r.allowlist[wol.FormatMAC(mac)] = true
+		}
+	}
+
+	return r, nil
+}
+
+// Addr 返回中继实际监听的地址
+func (r *Relay) Addr() net.Addr {
+	return r.conn.LocalAddr()
+}
+
+// Close 停止中继监听
+func (r *Relay) Close() error {
+	return r.conn.Close()
+}
+
+// serve 循环处理收到的数据包，直到监听被关闭
+func (r *Relay) serve() {
+	buf := make([]byte, 1500)
+	for {
+		n, src, err := r.conn.ReadFromUDP(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			log.Printf("中继读取数据失败: %v", err)
+			continue
+		}
+		r.handlePacket(buf[:n], src)
+	}
+}
+
+// handlePacket 处理一个收到的数据包
+func (r *Relay) handlePacket(packet []byte, src *net.UDPAddr) {
+	source := src.IP.String()
+	stats := r.sourceStats(source)
+	relayPacketsReceived.Inc()
+
+	mac, password, err := wol.ParseMagicPacket(packet)
+	if err != nil {
+		r.count(func() { stats.Invalid++ })
+		relayPackets.WithLabelValues("invalid").Inc()
+		r.invalidLog.Printf("中继丢弃来自 %s 的无效数据包: %v", source, err)
+		return
+	}
+	macAddr := wol.FormatMAC(mac)
+
+	if !r.allowed(macAddr) {
+		r.count(func() { stats.Rejected++ })
+		relayPackets.WithLabelValues("rejected").Inc()
+		r.rejectedLog.Printf("中继拒绝来自 %s 的唤醒请求: MAC %s 不在允许列表中", source, macAddr)
+		return
+	}
+
+	if !r.claim(macAddr) {
+		r.count(func() { stats.Suppressed++ })
+		relayPackets.WithLabelValues("suppressed").Inc()
+		return
+	}
+
+	target := WakeTarget{
+		MAC:      macAddr,
+		Port:     r.port,
+		Password: wol.FormatMAC(password),
+		Repeat:   1, // 每次转发只发一个包，发送方在去重窗口内连发的包只转发第一个
+	}
+	// 审计日志记录发出魔术包的公网地址
+	ctx := withWakeOrigin(context.Background(), sourceRelay, "", source)
+	if err := r.rebroadcast(ctx, target); err != nil {
+		if errors.Is(err, errTargetNotAllowed) {
+			r.count(func() { stats.Rejected++ })
+			relayPackets.WithLabelValues("rejected").Inc()
+			return
+		}
+		r.count(func() { stats.Failed++ })
+		relayPackets.WithLabelValues("failed").Inc()
+		log.Printf("中继转发来自 %s 的唤醒包失败, MAC: %s: %v", source, macAddr, err)
+		return
+	}
+
+	r.count(func() { stats.Forwarded++ })
+	relayPackets.WithLabelValues("forwarded").Inc()
+	log.Printf("中继已转发来自 %s 的唤醒包, MAC: %s", source, macAddr)
+}
+
+// rebroadcast 在配置的每个接口上重新广播，未配置接口时使用默认广播地址
+func (r *Relay) rebroadcast(ctx context.Context, target WakeTarget) error {
+	if len(r.interfaces) == 0 {
+		return r.forward(ctx, target.withDefaults())
+	}
+
+	var lastErr error
+	forwarded := false
+	for _, iface := range r.interfaces {
+		t := target
+		if iface == "all" {
+			t.AllInterfaces = true
+		} else {
+			t.Interface = iface
+		}
+		if err := r.forward(ctx, t.withDefaults()); err != nil {
+			lastErr = err
+			continue
+		}
+		forwarded = true
+	}
+	if !forwarded {
+		return lastErr
+	}
+	return nil
+}
+
+// allowed 检查MAC地址是否在允许列表中，以及是否要求为已登记设备
+func (r *Relay) allowed(macAddr string) bool {
+	if r.allowlist != nil && !r.allowlist[macAddr] {
+		return false
+	}
+	if r.registeredOnly {
+		for _, d := range registry.List() {
+			if d.MAC == macAddr {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// claim 记录一次转发，若该MAC在去重窗口内已转发过则返回false
+func (r *Relay) claim(macAddr string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	if last, ok := r.lastForwarded[macAddr]; ok && now.Sub(last) < relayDedupWindow {
+		return false
+	}
+
+	// 清理过期记录，避免大量不同MAC地址的包使记录无限增长
+	if len(r.lastForwarded) >= 1024 {
+		for mac, last := range r.lastForwarded {
+			if now.Sub(last) >= relayDedupWindow {
+				delete(r.lastForwarded, mac)
+			}
+		}
+	}
+	r.lastForwarded[macAddr] = now
+	return true
+}
+
+// sourceStats 返回来源地址的统计并计入收到的包，来源数达到上限时淘汰最久未出现的来源
+func (r *Relay) sourceStats(source string) *RelayStats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stats, ok := r.stats[source]
+	if !ok {
+		if len(r.stats) >= maxRelaySources {
+			var oldest *RelayStats
+			for _, s := range r.stats {
+				if oldest == nil || s.LastSeen.Before(oldest.LastSeen) {
+					oldest = s
+				}
+			}
+			delete(r.stats, oldest.Source)
+		}
+		stats = &RelayStats{Source: source}
+		r.stats[source] = stats
+	}
+	stats.Received++
+	stats.LastSeen = time.Now()
+	return stats
+}
+
+func (r *Relay) count(update func()) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	update()
+}
+
+// Stats 返回按来源地址排序的统计快照
+func (r *Relay) Stats() []RelayStats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	result := make([]RelayStats, 0, len(r.stats))
+	for _, s := range r.stats {
+		result = append(result, *s)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Source < result[j].Source })
+	return result
+}
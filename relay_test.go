@@ -0,0 +1,199 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tdh62/wake_on_lan_proxy/wol"
+)
+
+// startTestRelay 启动一个监听回环地址的中继，转发的目标记录到返回的通道中
+func startTestRelay(t *testing.T, cfg Config) (*Relay, chan WakeTarget) {
+	t.Helper()
+
+	forwarded := make(chan WakeTarget, 10)
+	r := newTestRelay(t, cfg, func(_ context.Context, target WakeTarget) error {
+		forwarded <- target
+		return nil
+	})
+	return r, forwarded
+}
+
+func newTestRelay(t *testing.T, cfg Config, forward func(context.Context, WakeTarget) error) *Relay {
+	t.Helper()
+
+	cfg.RelayListen = "127.0.0.1:0"
+	r, err := newRelay(cfg)
+	if err != nil {
+		t.Fatalf("newRelay() error = %v", err)
+	}
+	t.Cleanup(func() { r.Close() })
+
+	r.forward = forward
+	go r.serve()
+	return r
+}
+
+func sendToRelay(t *testing.T, r *Relay, packet []byte) {
+	t.Helper()
+
+	conn, err := net.DialUDP("udp", nil, r.Addr().(*net.UDPAddr))
+	if err != nil {
+		t.Fatalf("DialUDP() error = %v", err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write(packet); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+}
+
+// waitForStats 等待中继处理完指定数量的数据包
+func waitForStats(t *testing.T, r *Relay, received uint64) RelayStats {
+	t.Helper()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if stats := r.Stats(); len(stats) == 1 {
+			s := stats[0]
+			if s.Received >= received && s.Forwarded+s.Invalid+s.Rejected+s.Suppressed+s.Failed >= received {
+				return s
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("relay did not process %d packets: %+v", received, r.Stats())
+	return RelayStats{}
+}
+
+func TestRelayForwardsValidPackets(t *testing.T) {
+	r, forwarded := startTestRelay(t, Config{RelayPort: 7, RelayInterfaces: []string{"eth1"}})
+
+	mac := []byte{0xAA, 0xBB, 0xCC, 0xDD, 0xEE, 0xFF}
+	sendToRelay(t, r, wol.MagicPacket(mac, []byte{1, 2, 3, 4}))
+
+	select {
+	case target := <-forwarded:
+		if target.MAC != "AA:BB:CC:DD:EE:FF" || target.Password != "01:02:03:04" {
+			t.Errorf("forwarded target = %+v", target)
+		}
+		if target.Port != 7 || target.Interface != "eth1" {
+			t.Errorf("forwarded to port %d interface %q, want 7 eth1", target.Port, target.Interface)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("packet was not forwarded")
+	}
+
+	// 去重窗口内的重复包不会再次转发
+	sendToRelay(t, r, wol.MagicPacket(mac, nil))
+	stats := waitForStats(t, r, 2)
+	if stats.Forwarded != 1 || stats.Suppressed != 1 {
+		t.Errorf("stats = %+v, want 1 forwarded and 1 suppressed", stats)
+	}
+}
+
+func TestRelayRejectsPackets(t *testing.T) {
+	r, forwarded := startTestRelay(t, Config{RelayAllowlist: []string{"11-22-33-44-55-66"}})
+
+	sendToRelay(t, r, []byte("not a magic packet"))
+	sendToRelay(t, r, wol.MagicPacket([]byte{0xAA, 0xBB, 0xCC, 0xDD, 0xEE, 0xFF}, nil))
+
+	stats := waitForStats(t, r, 2)
+	if stats.Invalid != 1 || stats.Rejected != 1 || stats.Forwarded != 0 {
+		t.Errorf("stats = %+v, want 1 invalid and 1 rejected", stats)
+	}
+	if len(forwarded) != 0 {
+		t.Errorf("rejected packets were forwarded")
+	}
+}
+
+func TestRelayRegisteredOnly(t *testing.T) {
+	reg := useTestRegistry(t)
+	if _, err := reg.Add(Device{Name: "NAS", MAC: "11:22:33:44:55:66"}); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+
+	var mu sync.Mutex
+	var macs []string
+	r := newTestRelay(t, Config{RelayRegisteredOnly: true}, func(_ context.Context, target WakeTarget) error {
+		mu.Lock()
+		defer mu.Unlock()
+		macs = append(macs, target.MAC)
+		return nil
+	})
+
+	sendToRelay(t, r, wol.MagicPacket([]byte{0x11, 0x22, 0x33, 0x44, 0x55, 0x66}, nil))
+	sendToRelay(t, r, wol.MagicPacket([]byte{0xAA, 0xBB, 0xCC, 0xDD, 0xEE, 0xFF}, nil))
+
+	stats := waitForStats(t, r, 2)
+	if stats.Forwarded != 1 || stats.Rejected != 1 {
+		t.Errorf("stats = %+v, want 1 forwarded and 1 rejected", stats)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(macs) != 1 || macs[0] != "11:22:33:44:55:66" {
+		t.Errorf("forwarded MACs = %v, want only the registered device", macs)
+	}
+}
+
+func TestRelaySourceStatsLimit(t *testing.T) {
+	r := newTestRelay(t, Config{}, func(context.Context, WakeTarget) error { return nil })
+
+	r.sourceStats("192.0.2.1")
+	for i := 0; i < maxRelaySources; i++ {
+		r.sourceStats(fmt.Sprintf("10.0.%d.%d", i/256, i%256))
+	}
+
+	stats := r.Stats()
+	if len(stats) != maxRelaySources {
+		t.Fatalf("len(Stats()) = %d, want %d", len(stats), maxRelaySources)
+	}
+	for _, s := range stats {
+		if s.Source == "192.0.2.1" {
+			t.Errorf("the least recently seen source was not evicted")
+		}
+	}
+}
+
+func TestLogLimiter(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	l := logLimiter{interval: 50 * time.Millisecond}
+	for i := 0; i < 3; i++ {
+		l.Printf("无效数据包 %d", i)
+	}
+	time.Sleep(60 * time.Millisecond)
+	l.Printf("无效数据包 %d", 3)
+
+	out := buf.String()
+	if strings.Count(out, "无效数据包") != 2 || !strings.Contains(out, "另有 2 条") {
+		t.Errorf("log output = %q, want the first and last lines with 2 suppressed", out)
+	}
+}
+
+func TestRelayRecordsClientIP(t *testing.T) {
+	origins := make(chan *wakeOrigin, 1)
+	r := newTestRelay(t, Config{}, func(ctx context.Context, _ WakeTarget) error {
+		origins <- originOf(ctx)
+		return nil
+	})
+
+	sendToRelay(t, r, wol.MagicPacket([]byte{0xAA, 0xBB, 0xCC, 0xDD, 0xEE, 0xFF}, nil))
+	select {
+	case origin := <-origins:
+		if origin == nil || origin.source != sourceRelay || origin.clientIP != "127.0.0.1" {
+			t.Errorf("origin = %+v, want relay from 127.0.0.1", origin)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("packet was not forwarded")
+	}
+}
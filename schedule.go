@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+var errInvalidSchedule = errors.New("无效的定时任务")
+
+// 跳过日期的格式
+const skipDateLayout = "2006-01-02"
+
+// Schedule 设备的一个定时唤醒任务
+type Schedule struct {
+	ID        string       `json:"id"`
+	Cron      string       `json:"cron"`                 // 标准5段cron表达式，如 "30 7 * * 1-5"
+	Timezone  string       `json:"timezone,omitempty"`   // IANA时区，如 Asia/Shanghai，为空时使用 TZ 环境变量
+	SkipDates []string     `json:"skip_dates,omitempty"` // 不执行的日期（节假日），格式 2006-01-02
+	LastRun   *ScheduleRun `json:"last_run,omitempty"`
+}
+
+// ScheduleRun 定时任务最近一次执行的结果
+type ScheduleRun struct {
+	Time    time.Time `json:"time"`
+	Success bool      `json:"success"`
+	Error   string    `json:"error,omitempty"`
+}
+
+// location 返回任务使用的时区
+func (s Schedule) location() (*time.Location, error) {
+	if s.Timezone == "" {
+		return time.Local, nil
+	}
+	loc, err := time.LoadLocation(s.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("%w: 未知的时区: %s", errInvalidSchedule, s.Timezone)
+	}
+	return loc, nil
+}
+
+// parse 解析cron表达式，计算时间时使用任务的时区
+func (s Schedule) parse() (cron.Schedule, *time.Location, error) {
+	loc, err := s.location()
+	if err != nil {
+		return nil, nil, err
+	}
+	sched, err := cron.ParseStandard(s.Cron)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", errInvalidSchedule, err)
+	}
+	if spec, ok := sched.(*cron.SpecSchedule); ok {
+		spec.Location = loc
+	}
+	return sched, loc, nil
+}
+
+// validate 检查cron表达式、时区和跳过日期
+func (s Schedule) validate() error {
+	if strings.HasPrefix(s.Cron, "CRON_TZ=") || strings.HasPrefix(s.Cron, "TZ=") {
+		return fmt.Errorf("%w: 请使用 timezone 字段设置时区", errInvalidSchedule)
+	}
+	if _, _, err := s.parse(); err != nil {
+		return err
+	}
+	for _, d := range s.SkipDates {
+		if _, err := time.Parse(skipDateLayout, d); err != nil {
+			return fmt.Errorf("%w: 无效的跳过日期: %s", errInvalidSchedule, d)
+		}
+	}
+	return nil
+}
+
+// upcoming 返回 after 之后的 n 次执行时间，跳过 SkipDates 中的日期
+func (s Schedule) upcoming(after time.Time, n int) []time.Time {
+	sched, loc, err := s.parse()
+	if err != nil {
+		return nil
+	}
+	skip := make(map[string]bool, len(s.SkipDates))
+	for _, d := range s.SkipDates {
+		skip[d] = true
+	}
+
+	var runs []time.Time
+	t := after
+	// 限制查找次数，避免所有执行时间都被跳过时死循环
+	for i := 0; i < 1000 && len(runs) < n; i++ {
+		t = sched.Next(t)
+		if t.IsZero() {
+			break
+		}
+		if !skip[t.In(loc).Format(skipDateLayout)] {
+			runs = append(runs, t.In(loc))
+		}
+	}
+	return runs
+}
+
+// normalizeSchedule 整理字段并为新任务分配ID
+func normalizeSchedule(s *Schedule) error {
+	s.Cron = strings.Join(strings.Fields(s.Cron), " ")
+	s.Timezone = strings.TrimSpace(s.Timezone)
+	var dates []string
+	for _, d := range s.SkipDates {
+		if d = strings.TrimSpace(d); d != "" {
+			dates = append(dates, d)
+		}
+	}
+	sort.Strings(dates)
+	s.SkipDates = dates
+
+	if err := s.validate(); err != nil {
+		return err
+	}
+	if s.ID == "" {
+		id, err := newDeviceID()
+		if err != nil {
+			return err
+		}
+		s.ID = id
+	}
+	return nil
+}
+
+// ScheduleView 用于页面和API展示的定时任务
+type ScheduleView struct {
+	DeviceID   string      `json:"device_id"`
+	DeviceName string      `json:"device_name"`
+	Schedule   Schedule    `json:"schedule"`
+	Timezone   string      `json:"timezone"` // 实际使用的时区
+	Upcoming   []time.Time `json:"upcoming"`
+}
+
+// scheduleViews 列出所有设备的定时任务，按下次执行时间排序
+func scheduleViews(devices []Device, now time.Time, n int) []ScheduleView {
+	var views []ScheduleView
+	for _, d := range devices {
+		for _, s := range d.Schedules {
+			v := ScheduleView{DeviceID: d.ID, DeviceName: d.Name, Schedule: s, Upcoming: s.upcoming(now, n)}
+			if loc, err := s.location(); err == nil {
+				v.Timezone = loc.String()
+			}
+			views = append(views, v)
+		}
+	}
+	sort.SliceStable(views, func(i, j int) bool {
+		a, b := views[i].Upcoming, views[j].Upcoming
+		if len(a) == 0 || len(b) == 0 {
+			return len(a) > len(b)
+		}
+		return a[0].Before(b[0])
+	})
+	return views
+}
+
+// scheduleCheckInterval 调度器检查到期任务的间隔，cron的最小粒度为分钟
+const scheduleCheckInterval = 30 * time.Second
+
+// runScheduler 定期检查所有设备的定时任务，执行到期的唤醒
+func runScheduler() {
+	wake := wakeWith(withWakeOrigin(context.Background(), sourceSchedule, "", ""))
+	last := time.Now()
+	for {
+		time.Sleep(scheduleCheckInterval)
+		now := time.Now()
+		runDueSchedules(last, now, wake)
+		last = now
+	}
+}
+
+// runDueSchedules 执行在 (from, to] 之间到期的任务，错过的多次执行只补一次
+func runDueSchedules(from, to time.Time, wake func(WakeTarget) error) {
+	for _, d := range registry.List() {
+		for _, s := range d.Schedules {
+			next := s.upcoming(from, 1)
+			if len(next) == 0 || next[0].After(to) {
+				continue
+			}
+
+			run := ScheduleRun{Time: time.Now(), Success: true}
+			if err := wake(d.target().withDefaults()); err != nil {
+				run.Success = false
+				run.Error = err.Error()
+				log.Printf("定时唤醒设备 %s 失败 (%s): %v", d.Name, s.Cron, err)
+			} else {
+				log.Printf("定时唤醒设备 %s (%s)", d.Name, s.Cron)
+			}
+			if err := registry.SetScheduleRun(d.ID, s.ID, run); err != nil {
+				log.Printf("无法保存定时任务结果: %v", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestScheduleUpcoming(t *testing.T) {
+	shanghai, err := time.LoadLocation("Asia/Shanghai")
+	if err != nil {
+		t.Skipf("time zone data not available: %v", err)
+	}
+
+	s := Schedule{Cron: "30 7 * * 1-5", Timezone: "Asia/Shanghai", SkipDates: []string{"2026-10-01"}}
+	// 2026-09-30 是星期三，10-01 被跳过，10-03/04 是周末
+	after := time.Date(2026, 9, 30, 8, 0, 0, 0, shanghai).In(time.UTC)
+
+	got := s.upcoming(after, 3)
+	want := []time.Time{
+		time.Date(2026, 10, 2, 7, 30, 0, 0, shanghai),
+		time.Date(2026, 10, 5, 7, 30, 0, 0, shanghai),
+		time.Date(2026, 10, 6, 7, 30, 0, 0, shanghai),
+	}
+	if len(got) != len(want) {
+		t.Fatalf("upcoming() = %v, want %v", got, want)
+	}
+	for i := range want {
+		if !got[i].Equal(want[i]) || got[i].Location().String() != "Asia/Shanghai" {
+			t.Errorf("upcoming()[%d] = %v, want %v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestScheduleValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		schedule Schedule
+		wantErr  bool
+	}{
+		{name: "Weekdays", schedule: Schedule{Cron: "30 7 * * 1-5"}},
+		{name: "With time zone and skip dates", schedule: Schedule{Cron: "0 8 * * *", Timezone: "Europe/Berlin", SkipDates: []string{"2026-12-25"}}},
+		{name: "Descriptor", schedule: Schedule{Cron: "@daily"}},
+		{name: "Invalid expression", schedule: Schedule{Cron: "every morning"}, wantErr: true},
+		{name: "Seconds field", schedule: Schedule{Cron: "0 30 7 * * 1-5"}, wantErr: true},
+		{name: "Unknown time zone", schedule: Schedule{Cron: "0 8 * * *", Timezone: "Mars/Olympus"}, wantErr: true},
+		{name: "Invalid skip date", schedule: Schedule{Cron: "0 8 * * *", SkipDates: []string{"25.12.2026"}}, wantErr: true},
+		{name: "Inline time zone", schedule: Schedule{Cron: "CRON_TZ=UTC 0 8 * * *"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.schedule.validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, errInvalidSchedule) {
+				t.Errorf("error %v does not wrap errInvalidSchedule", err)
+			}
+		})
+	}
+}
+
+func TestRegistrySchedules(t *testing.T) {
+	reg := useTestRegistry(t)
+	device, err := reg.Add(Device{Name: "NAS", MAC: "11:22:33:44:55:66"})
+	if err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+
+	s, err := reg.AddSchedule(device.ID, Schedule{Cron: " 0  8 * * * ", SkipDates: []string{" 2026-12-25", ""}})
+	if err != nil {
+		t.Fatalf("AddSchedule() error = %v", err)
+	}
+	if s.ID == "" || s.Cron != "0 8 * * *" || len(s.SkipDates) != 1 {
+		t.Errorf("AddSchedule() = %+v, want normalized schedule with ID", s)
+	}
+	if _, err := reg.AddSchedule(device.ID, Schedule{Cron: "nope"}); !errors.Is(err, errInvalidSchedule) {
+		t.Errorf("AddSchedule() invalid cron error = %v", err)
+	}
+	if _, err := reg.AddSchedule("missing", Schedule{Cron: "0 8 * * *"}); err != errDeviceNotFound {
+		t.Errorf("AddSchedule() unknown device error = %v", err)
+	}
+
+	// 任务随设备一起持久化
+	reopened, err := openDeviceRegistry(reg.path)
+	if err != nil {
+		t.Fatalf("openDeviceRegistry() error = %v", err)
+	}
+	if d, _ := reopened.Get(device.ID); len(d.Schedules) != 1 || d.Schedules[0].ID != s.ID {
+		t.Errorf("reopened schedules = %+v", d.Schedules)
+	}
+
+	if err := reg.RemoveSchedule(device.ID, s.ID); err != nil {
+		t.Fatalf("RemoveSchedule() error = %v", err)
+	}
+	if d, _ := reg.Get(device.ID); len(d.Schedules) != 0 {
+		t.Errorf("schedules after remove = %+v", d.Schedules)
+	}
+}
+
+func TestRunDueSchedules(t *testing.T) {
+	reg := useTestRegistry(t)
+	device, err := reg.Add(Device{
+		Name: "NAS",
+		MAC:  "11:22:33:44:55:66",
+		Schedules: []Schedule{
+			{Cron: "* * * * *"},
+			{Cron: "0 0 1 1 *"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+
+	var woken []string
+	now := time.Now()
+	// 错过的多次执行只补一次
+	runDueSchedules(now.Add(-3*time.Minute), now, func(target WakeTarget) error {
+		woken = append(woken, target.MAC)
+		return errors.New("network unreachable")
+	})
+
+	if len(woken) != 1 || woken[0] != "11:22:33:44:55:66" {
+		t.Fatalf("woken = %v, want one wake of the every-minute schedule", woken)
+	}
+	d, _ := reg.Get(device.ID)
+	run := d.Schedules[0].LastRun
+	if run == nil || run.Success || run.Error != "network unreachable" {
+		t.Errorf("LastRun = %+v, want the failure recorded", run)
+	}
+	if d.Schedules[1].LastRun != nil {
+		t.Errorf("schedule that was not due has LastRun = %+v", d.Schedules[1].LastRun)
+	}
+}
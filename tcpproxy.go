@@ -0,0 +1,223 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// TCPProxyConfig 一个按需唤醒的TCP代理：本地端口上的连接转发到设备上的服务
+type TCPProxyConfig struct {
+	Listen  string   `json:"listen" yaml:"listen" toml:"listen"`       // 本地监听地址，如 :2222
+	Device  string   `json:"device" yaml:"device" toml:"device"`       // 已登记设备的ID、名称或MAC地址
+	Backend string   `json:"backend" yaml:"backend" toml:"backend"`    // 后端服务地址，如 192.168.1.50:22
+	MaxWait Duration `json:"max_wait" yaml:"max_wait" toml:"max_wait"` // 等待后端上线的最长时间，为0时使用 proxy_max_wait
+}
+
+func (c TCPProxyConfig) validate() error {
+	if c.Listen == "" || c.Device == "" {
+		return fmt.Errorf("TCP代理需要指定监听地址和设备")
+	}
+	if _, _, err := net.SplitHostPort(c.Backend); err != nil {
+		return fmt.Errorf("TCP代理 %s 的后端地址无效: %v", c.Listen, err)
+	}
+	if c.MaxWait < 0 {
+		return fmt.Errorf("TCP代理 %s 的等待时间不能为负数", c.Listen)
+	}
+	return nil
+}
+
+// TCPProxy 按需唤醒的TCP代理
+//
+// 连接到达时若后端不可达，先唤醒设备，保持客户端连接并轮询后端，
+// 后端响应后再双向转发数据；超过最长等待时间则关闭客户端连接
+type TCPProxy struct {
+	listener net.Listener
+	device   string
+	backend  string
+	maxWait  time.Duration
+	waker    *deviceWaker
+	conns    sync.WaitGroup
+}
+
+// tcpProxies 当前运行的TCP代理
+var tcpProxies []*TCPProxy
+
+// newTCPProxy 按配置开始监听，调用 serve 处理连接
+func newTCPProxy(cfg TCPProxyConfig) (*TCPProxy, error) {
+	ln, err := net.Listen("tcp", cfg.Listen)
+	if err != nil {
+		return nil, fmt.Errorf("无法启动TCP代理监听: %v", err)
+	}
+
+	maxWait := time.Duration(cfg.MaxWait)
+	if maxWait == 0 {
+		maxWait = time.Duration(config.ProxyMaxWait)
+	}
+	return &TCPProxy{
+		listener: ln,
+		device:   cfg.Device,
+		backend:  cfg.Backend,
+		maxWait:  maxWait,
+		waker:    newDeviceWaker(cfg.Device),
+	}, nil
+}
+
+// Addr 返回代理实际监听的地址
+func (p *TCPProxy) Addr() net.Addr {
+	return p.listener.Addr()
+}
+
+// Close 停止代理监听，并等待已建立的连接结束
+func (p *TCPProxy) Close() error {
+	err := p.listener.Close()
+	p.conns.Wait()
+	return err
+}
+
+// serve 循环接受连接，直到监听被关闭
+func (p *TCPProxy) serve() {
+	for {
+		conn, err := p.listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			log.Printf("TCP代理 %s 接受连接失败: %v", p.Addr(), err)
+			time.Sleep(100 * time.Millisecond)
+			continue
+		}
+		p.conns.Add(1)
+		go func() {
+			defer p.conns.Done()
+			p.handleConn(conn)
+		}()
+	}
+}
+
+func (p *TCPProxy) handleConn(client net.Conn) {
+	defer client.Close()
+
+	backend, pending, err := p.connectBackend(client)
+	if err != nil {
+		log.Printf("TCP代理 %s 无法连接来自 %s 的请求: %v", p.Addr(), client.RemoteAddr(), err)
+		return
+	}
+	defer backend.Close()
+
+	// 等待期间客户端已经发送的数据
+	if len(pending) > 0 {
+		if _, err := backend.Write(pending); err != nil {
+			return
+		}
+	}
+	splice(client, backend)
+}
+
+// errClientClosed 等待后端上线期间客户端断开了连接
+var errClientClosed = errors.New("客户端在后端上线前断开了连接")
+
+// connectBackend 连接后端，不可达时唤醒设备并等待其上线；等待期间客户端发送的数据在 pending 中返回，
+// 客户端断开连接时停止等待和唤醒
+func (p *TCPProxy) connectBackend(client net.Conn) (conn net.Conn, pending []byte, err error) {
+	interval := time.Duration(config.VerifyInterval)
+	if conn, err := net.DialTimeout("tcp", p.backend, interval); err == nil {
+		return conn, nil, nil
+	}
+
+	source := client.RemoteAddr()
+	clientIP := source.String()
+	if addr, ok := source.(*net.TCPAddr); ok {
+		clientIP = addr.IP.String()
+	}
+	ctx, cancel := context.WithCancel(withWakeOrigin(context.Background(), sourceProxy, "", clientIP))
+	defer cancel()
+	stopWatching := watchClient(client, cancel)
+
+	conn, err = p.waitBackend(ctx, source, interval)
+	pending = stopWatching()
+	if err != nil {
+		return nil, nil, err
+	}
+	return conn, pending, nil
+}
+
+// waitBackend 唤醒设备并轮询后端，直到后端上线、超过最长等待时间或 ctx 被取消
+func (p *TCPProxy) waitBackend(ctx context.Context, source net.Addr, interval time.Duration) (net.Conn, error) {
+	dialer := net.Dialer{Timeout: interval}
+	start := time.Now()
+	deadline := start.Add(p.maxWait)
+	for {
+		if err := p.waker.wake(ctx, fmt.Sprintf("TCP代理 %s: 后端 %s 不可达，来自 %s 的连接", p.Addr(), p.backend, source)); err != nil {
+			return nil, err
+		}
+		if conn, err := dialer.DialContext(ctx, "tcp", p.backend); err == nil {
+			log.Printf("TCP代理 %s: 后端 %s 已在 %s 后上线", p.Addr(), p.backend, time.Since(start).Round(time.Second))
+			return conn, nil
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("后端 %s 在 %s 内没有上线", p.backend, p.maxWait)
+		}
+		select {
+		case <-ctx.Done():
+			return nil, errClientClosed
+		case <-time.After(interval):
+		}
+	}
+}
+
+// maxPendingBytes 等待后端上线期间最多缓存的客户端数据，超过后不再读取，也就无法发现客户端断开
+const maxPendingBytes = 64 << 10
+
+// watchClient 在等待后端期间读取客户端连接，客户端断开时调用 cancel；
+// 返回的 stop 停止读取并返回已读到的数据，之后连接可以照常使用
+func watchClient(client net.Conn, cancel context.CancelFunc) (stop func() []byte) {
+	var pending []byte
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		buf := make([]byte, 4096)
+		for len(pending) < maxPendingBytes {
+			n, err := client.Read(buf)
+			pending = append(pending, buf[:n]...)
+			if errors.Is(err, os.ErrDeadlineExceeded) {
+				return // stop 设置的读超时
+			}
+			if err != nil {
+				cancel()
+				return
+			}
+		}
+	}()
+
+	return func() []byte {
+		client.SetReadDeadline(time.Now())
+		<-done
+		client.SetReadDeadline(time.Time{})
+		return pending
+	}
+}
+
+// splice 在两个连接之间双向复制数据，一个方向结束时关闭对端的写入
+func splice(a, b net.Conn) {
+	done := make(chan struct{}, 2)
+	copyHalf := func(dst, src net.Conn) {
+		io.Copy(dst, src)
+		if cw, ok := dst.(interface{ CloseWrite() error }); ok {
+			cw.CloseWrite()
+		} else {
+			dst.Close()
+		}
+		done <- struct{}{}
+	}
+	go copyHalf(a, b)
+	go copyHalf(b, a)
+	<-done
+	<-done
+}
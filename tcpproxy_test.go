@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// startEchoServer 在指定地址启动一个按行回显的TCP服务
+func startEchoServer(t *testing.T, addr string) net.Listener {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+	return ln
+}
+
+// unusedAddr 返回一个当前没有监听的本地地址
+func unusedAddr(t *testing.T) string {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+	return addr
+}
+
+func newTestTCPProxy(t *testing.T, backend string, maxWait time.Duration, wake func(WakeTarget) error) *TCPProxy {
+	t.Helper()
+
+	reg := useTestRegistry(t)
+	if _, err := reg.Add(Device{Name: "build-box", MAC: "AA:BB:CC:DD:EE:FF"}); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	useFastVerify(t)
+
+	p, err := newTCPProxy(TCPProxyConfig{Listen: "127.0.0.1:0", Device: "build-box", Backend: backend, MaxWait: Duration(maxWait)})
+	if err != nil {
+		t.Fatalf("newTCPProxy() error = %v", err)
+	}
+	t.Cleanup(func() { p.Close() })
+
+	p.waker.send = func(_ context.Context, target WakeTarget) error { return wake(target) }
+	go p.serve()
+	return p
+}
+
+// roundTrip 通过代理发送一行数据并读取回显
+func roundTrip(t *testing.T, p *TCPProxy, line string) (string, error) {
+	t.Helper()
+
+	conn, err := net.Dial("tcp", p.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	if _, err := conn.Write([]byte(line + "\n")); err != nil {
+		return "", err
+	}
+	return bufio.NewReader(conn).ReadString('\n')
+}
+
+func TestTCPProxyBackendOnline(t *testing.T) {
+	backend := startEchoServer(t, "127.0.0.1:0")
+
+	var wakes atomic.Int32
+	p := newTestTCPProxy(t, backend.Addr().String(), time.Second, func(WakeTarget) error {
+		wakes.Add(1)
+		return nil
+	})
+
+	if got, err := roundTrip(t, p, "hello"); err != nil || got != "hello\n" {
+		t.Fatalf("roundTrip() = %q, %v", got, err)
+	}
+	if wakes.Load() != 0 {
+		t.Errorf("device was woken %d times, want 0 for an online backend", wakes.Load())
+	}
+}
+
+func TestTCPProxyWakesBackend(t *testing.T) {
+	addr := unusedAddr(t)
+
+	var wakes atomic.Int32
+	p := newTestTCPProxy(t, addr, 5*time.Second, func(target WakeTarget) error {
+		if target.MAC != "AA:BB:CC:DD:EE:FF" {
+			t.Errorf("woke MAC %s", target.MAC)
+		}
+		// 模拟设备在唤醒后一段时间才上线
+		if wakes.Add(1) == 1 {
+			time.AfterFunc(200*time.Millisecond, func() { startEchoServer(t, addr) })
+		}
+		return nil
+	})
+
+	if got, err := roundTrip(t, p, "wake up"); err != nil || got != "wake up\n" {
+		t.Fatalf("roundTrip() = %q, %v", got, err)
+	}
+	if wakes.Load() != 1 {
+		t.Errorf("device was woken %d times, want 1", wakes.Load())
+	}
+}
+
+func TestTCPProxyGivesUp(t *testing.T) {
+	p := newTestTCPProxy(t, unusedAddr(t), 200*time.Millisecond, func(WakeTarget) error { return nil })
+
+	start := time.Now()
+	if _, err := roundTrip(t, p, "anyone?"); err == nil {
+		t.Fatal("roundTrip() succeeded, want the connection closed after the max wait")
+	}
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond || elapsed > 3*time.Second {
+		t.Errorf("connection closed after %v, want about the max wait", elapsed)
+	}
+}
+
+func TestTCPProxyStopsWaitingWhenClientCloses(t *testing.T) {
+	woken := make(chan struct{}, 1)
+	p := newTestTCPProxy(t, unusedAddr(t), 30*time.Second, func(WakeTarget) error {
+		select {
+		case woken <- struct{}{}:
+		default:
+		}
+		return nil
+	})
+
+	conn, err := net.Dial("tcp", p.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	select {
+	case <-woken:
+	case <-time.After(5 * time.Second):
+		t.Fatal("device was not woken")
+	}
+	conn.Close()
+
+	// Close 会等待所有连接处理完毕，客户端断开后不应再等到最长等待时间
+	closed := make(chan struct{})
+	go func() {
+		p.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(3 * time.Second):
+		t.Fatal("proxy kept waiting for the backend after the client closed")
+	}
+}
@@ -0,0 +1,731 @@
+package main
+
+import "html/template"
+
+// indexTmpl 首页模板，唤醒结果及设备管理操作也使用同一页面展示
+var indexTmpl = template.Must(template.New("index").Parse(indexTemplate))
+
+// loginTmpl 启用认证后的登录页面
+var loginTmpl = template.Must(template.New("login").Parse(loginTemplate))
+
+// historyTmpl 唤醒历史页面
+var historyTmpl = template.Must(template.New("history").Parse(historyTemplate))
+
+// discoveryTmpl 设备发现页面
+var discoveryTmpl = template.Must(template.New("discovery").Parse(discoveryTemplate))
+
+// wakingTmpl HTTP代理在上游唤醒期间显示的等待页面
+var wakingTmpl = template.Must(template.New("waking").Parse(wakingTemplate))
+
+// pageStyle 各页面共用的样式
+const pageStyle = `    <style>
+        * {
+            margin: 0;
+            padding: 0;
+            box-sizing: border-box;
+        }
+        body {
+            font-family: 'Segoe UI', Tahoma, Geneva, Verdana, sans-serif;
+            background: linear-gradient(135deg, #667eea 0%, #764ba2 100%);
+            min-height: 100vh;
+            display: flex;
+            justify-content: center;
+            align-items: center;
+            padding: 20px;
+        }
+        .container {
+            background: white;
+            border-radius: 20px;
+            box-shadow: 0 20px 60px rgba(0, 0, 0, 0.3);
+            padding: 40px;
+            max-width: 600px;
+            width: 100%;
+        }
+        h1 {
+            color: #333;
+            text-align: center;
+            margin-bottom: 30px;
+            font-size: 28px;
+        }
+        h2 {
+            color: #555;
+            font-size: 18px;
+            margin-bottom: 15px;
+            margin-top: 30px;
+        }
+        .form-group {
+            margin-bottom: 20px;
+        }
+        label {
+            display: block;
+            color: #555;
+            font-weight: 600;
+            margin-bottom: 8px;
+            font-size: 14px;
+        }
+        input[type="text"],
+        input[type="password"],
+        select,
+        textarea {
+            width: 100%;
+            padding: 12px 15px;
+            border: 2px solid #e0e0e0;
+            border-radius: 8px;
+            font-size: 16px;
+            transition: border-color 0.3s;
+        }
+        input[type="text"]:focus,
+        input[type="password"]:focus,
+        select:focus,
+        textarea:focus {
+            outline: none;
+            border-color: #667eea;
+        }
+        .hint {
+            font-size: 12px;
+            color: #888;
+            margin-top: 5px;
+        }
+        button {
+            width: 100%;
+            padding: 14px;
+            background: linear-gradient(135deg, #667eea 0%, #764ba2 100%);
+            color: white;
+            border: none;
+            border-radius: 8px;
+            font-size: 16px;
+            font-weight: 600;
+            cursor: pointer;
+            transition: transform 0.2s, box-shadow 0.2s;
+        }
+        button:hover {
+            transform: translateY(-2px);
+            box-shadow: 0 10px 20px rgba(102, 126, 234, 0.4);
+        }
+        button:active {
+            transform: translateY(0);
+        }
+        .message {
+            padding: 15px;
+            border-radius: 8px;
+            margin-bottom: 20px;
+            font-size: 14px;
+        }
+        .success {
+            background-color: #d4edda;
+            color: #155724;
+            border: 1px solid #c3e6cb;
+        }
+        .error {
+            background-color: #f8d7da;
+            color: #721c24;
+            border: 1px solid #f5c6cb;
+        }
+        .device-section {
+            margin-top: 30px;
+            padding-top: 30px;
+            border-top: 2px solid #e0e0e0;
+        }
+        .device-list {
+            max-height: 400px;
+            overflow-y: auto;
+            margin-bottom: 20px;
+        }
+        .device-item {
+            background: #f8f9fa;
+            border: 1px solid #e0e0e0;
+            border-radius: 8px;
+            padding: 12px;
+            margin-bottom: 10px;
+            display: flex;
+            justify-content: space-between;
+            align-items: center;
+            transition: all 0.2s;
+        }
+        .device-item:hover {
+            background: #e9ecef;
+            border-color: #667eea;
+        }
+        .device-info {
+            flex: 1;
+        }
+        .device-name {
+            font-weight: 600;
+            color: #333;
+            margin-bottom: 4px;
+        }
+        .device-details {
+            font-size: 12px;
+            color: #666;
+        }
+        .device-actions {
+            display: flex;
+            gap: 8px;
+        }
+        .device-actions button {
+            padding: 6px 12px;
+            font-size: 12px;
+            width: auto;
+        }
+        .device-actions .delete-btn {
+            background: #dc3545;
+        }
+        .device-actions .delete-btn:hover {
+            background: #c82333;
+        }
+        .empty-devices {
+            text-align: center;
+            color: #999;
+            padding: 20px;
+            font-size: 14px;
+        }
+        .form-group select + input,
+        .form-group input + input {
+            margin-top: 8px;
+        }
+        .checkbox-label {
+            display: flex;
+            align-items: center;
+            gap: 8px;
+            font-weight: normal;
+        }
+        details summary {
+            cursor: pointer;
+            color: #667eea;
+            font-weight: 600;
+            margin-bottom: 15px;
+        }
+        textarea {
+            font-family: inherit;
+            resize: vertical;
+        }
+        .step-results {
+            margin-top: 8px;
+            padding-left: 20px;
+        }
+        .user-bar {
+            display: flex;
+            justify-content: flex-end;
+            align-items: center;
+            gap: 10px;
+            font-size: 13px;
+            color: #888;
+            margin-bottom: 10px;
+        }
+        .user-bar button {
+            width: auto;
+            padding: 4px 12px;
+            font-size: 13px;
+        }
+        .user-bar a, .pager a {
+            color: #667eea;
+            text-decoration: none;
+        }
+        .container.wide {
+            max-width: 1100px;
+        }
+        .history-table {
+            width: 100%;
+            border-collapse: collapse;
+            font-size: 13px;
+        }
+        .history-table th, .history-table td {
+            padding: 8px 6px;
+            border-bottom: 1px solid #eee;
+            text-align: left;
+            vertical-align: top;
+        }
+        .history-table th {
+            color: #555;
+            white-space: nowrap;
+        }
+        .history-table .ok {
+            color: #155724;
+        }
+        .history-table .failed {
+            color: #721c24;
+        }
+        .import-form {
+            display: flex;
+            gap: 6px;
+        }
+        .import-form input[type="text"] {
+            padding: 4px 8px;
+            font-size: 13px;
+        }
+        .import-form button {
+            width: auto;
+            padding: 4px 12px;
+            font-size: 13px;
+            white-space: nowrap;
+        }
+        .pager {
+            display: flex;
+            justify-content: space-between;
+            align-items: center;
+            margin-top: 15px;
+            font-size: 14px;
+            color: #888;
+        }
+    </style>
+`
+
+const indexTemplate = `<!DOCTYPE html>
+<html lang="zh-CN">
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <title>局域网唤醒服务</title>
+` + pageStyle + `</head>
+<body>
+    <div class="container">
+        <form action="/logout" method="POST" class="user-bar">
+            <a href="/discovery">🔍 发现设备</a>
+            <a href="/history">📜 唤醒历史</a>
+            {{if .User}}
+            <span>👤 {{.User}}</span>
+            <button type="submit">退出登录</button>
+            {{end}}
+        </form>
+        <h1>🌐 局域网唤醒服务</h1>
+        {{if .Message}}
+        <div class="message {{if .Success}}success{{else}}error{{end}}">
+            {{.Message}}
+        </div>
+        {{end}}
+        {{with .Result}}
+        <div class="message {{if .Success}}success{{else}}error{{end}}">
+            {{if .Error}}{{.Error}}{{end}}
+            <ol class="step-results">
+                {{range .Steps}}<li>{{.DeviceName}}: {{.Summary}}</li>{{end}}
+            </ol>
+        </div>
+        {{end}}
+        <form action="/wake" method="POST" id="wakeForm">
+            <div class="form-group">
+                <label for="mac">目标设备MAC地址</label>
+                <input type="text" id="mac" name="mac" placeholder="例如: AA:BB:CC:DD:EE:FF" required>
+                <div class="hint">支持格式: AA:BB:CC:DD:EE:FF 或 AA-BB-CC-DD-EE-FF</div>
+            </div>
+            <div class="form-group">
+                <label for="ip">广播地址（可选）</label>
+                <input type="text" id="ip" name="ip" placeholder="例如: 192.168.1.255" value="{{.DefaultBroadcast}}" list="broadcasts">
+                <div class="hint">默认使用广播地址 {{.DefaultBroadcast}}，可从下拉列表中选择本机各子网的定向广播地址；IPv6可填写 ff02::1%eth0 或单播地址</div>
+                <label class="checkbox-label"><input type="checkbox" name="all" value="1"> 在所有接口上发送（各子网的定向广播）</label>
+            </div>
+            <div class="form-group">
+                <label for="password">SecureOn密码（可选）</label>
+                <input type="password" id="password" name="password" placeholder="例如: 00:11:22:33:44:55" autocomplete="off">
+                <div class="hint">网卡设置了SecureOn密码时填写，支持4或6字节十六进制或 192.168.1.1 格式</div>
+            </div>
+            <div class="form-group">
+                <label for="transport">发送方式</label>
+                <select id="transport" name="transport">
+                    <option value="udp">UDP广播</option>
+                    <option value="ethernet">以太网帧 (EtherType 0x0842)</option>
+                </select>
+            </div>
+            <div class="form-group">
+                <label for="iface">网络接口（可选，以太网方式必填）</label>
+                <input type="text" id="iface" name="iface" placeholder="例如: eth0" list="ifaces">
+                <div class="hint">指定从哪个网卡发出；以太网方式需要root或CAP_NET_RAW权限</div>
+            </div>
+            <div class="form-group">
+                <label for="source">源地址（可选）</label>
+                <input type="text" id="source" name="source" placeholder="例如: 192.168.1.10">
+                <div class="hint">UDP方式绑定的本机地址，用于多网卡主机选择出口</div>
+            </div>
+            <div class="form-group">
+                <label for="repeat">发送次数（可选）</label>
+                <input type="number" id="repeat" name="repeat" min="1" max="20" placeholder="默认: {{.DefaultRepeat}}">
+                <div class="hint">网络丢包严重（如无线网桥）时可多次发送，每次间隔 {{.RepeatInterval}}</div>
+            </div>
+            <button type="submit">发送唤醒包</button>
+        </form>
+
+        <div class="device-section">
+            <h2>📋 设备列表</h2>
+            <div class="device-list">
+                {{range .Devices}}
+                <div class="device-item">
+                    <div class="device-info">
+                        <div class="device-name">{{.Name}}{{if .Password}} 🔒{{end}}</div>
+                        <div class="device-details">MAC: {{.MAC}} | {{if eq .Transport "ethernet"}}以太网接口: {{.Interface}}{{else}}{{if .AllInterfaces}}所有接口{{else}}广播: {{or .Broadcast $.DefaultBroadcast}}{{end}} | 端口: {{or .Port $.DefaultPort}}{{if .Interface}} | 接口: {{.Interface}}{{end}}{{end}}{{if .Repeat}} | 发送 {{.Repeat}} 次{{end}}</div>
+                        {{if .Verify}}<div class="device-details">上线验证: {{.Verify.Method}}{{if .Verify.Host}} {{.Verify.Host}}{{end}}{{if .Verify.Port}}:{{.Verify.Port}}{{end}}</div>{{end}}
+                        {{if .Notes}}<div class="device-details">{{.Notes}}</div>{{end}}
+                    </div>
+                    <div class="device-actions">
+                        <form action="/wake" method="POST">
+                            <input type="hidden" name="device" value="{{.ID}}">
+                            <button type="submit">唤醒</button>
+                        </form>
+                        <form action="/devices/delete" method="POST" onsubmit="return confirm('确定要删除这台设备吗？')">
+                            <input type="hidden" name="id" value="{{.ID}}">
+                            <button type="submit" class="delete-btn">删除</button>
+                        </form>
+                    </div>
+                </div>
+                {{else}}
+                <div class="empty-devices">暂无登记的设备</div>
+                {{end}}
+            </div>
+
+            <details>
+                <summary>➕ 添加设备</summary>
+                <form action="/devices/add" method="POST">
+                    <div class="form-group">
+                        <label for="deviceName">设备名称</label>
+                        <input type="text" id="deviceName" name="name" placeholder="例如: 我的电脑" required>
+                    </div>
+                    <div class="form-group">
+                        <label for="deviceMac">MAC地址</label>
+                        <input type="text" id="deviceMac" name="mac" placeholder="例如: AA:BB:CC:DD:EE:FF" required>
+                    </div>
+                    <div class="form-group">
+                        <label for="deviceIp">广播地址（可选）</label>
+                        <input type="text" id="deviceIp" name="ip" placeholder="例如: 192.168.1.255" list="broadcasts">
+                        <label class="checkbox-label"><input type="checkbox" name="all" value="1"> 在所有接口上发送</label>
+                    </div>
+                    <div class="form-group">
+                        <label for="devicePort">UDP端口（可选）</label>
+                        <input type="text" id="devicePort" name="port" placeholder="默认: {{.DefaultPort}}">
+                    </div>
+                    <div class="form-group">
+                        <label for="devicePassword">SecureOn密码（可选）</label>
+                        <input type="password" id="devicePassword" name="password" autocomplete="off">
+                    </div>
+                    <div class="form-group">
+                        <label for="deviceTransport">发送方式</label>
+                        <select id="deviceTransport" name="transport">
+                            <option value="udp">UDP广播</option>
+                            <option value="ethernet">以太网帧 (EtherType 0x0842)</option>
+                        </select>
+                    </div>
+                    <div class="form-group">
+                        <label for="deviceIface">网络接口（可选，以太网方式必填）</label>
+                        <input type="text" id="deviceIface" name="iface" placeholder="例如: eth0" list="ifaces">
+                    </div>
+                    <div class="form-group">
+                        <label for="deviceSource">源地址（可选）</label>
+                        <input type="text" id="deviceSource" name="source" placeholder="例如: 192.168.1.10">
+                    </div>
+                    <div class="form-group">
+                        <label for="deviceRepeat">发送次数（可选）</label>
+                        <input type="number" id="deviceRepeat" name="repeat" min="1" max="20" placeholder="默认: {{.DefaultRepeat}}">
+                        <input type="text" name="repeat_interval" placeholder="间隔，例如: 200ms（默认 {{.RepeatInterval}}）">
+                    </div>
+                    <div class="form-group">
+                        <label for="deviceVerify">上线验证（可选）</label>
+                        <select id="deviceVerify" name="verify_method">
+                            <option value="">不验证</option>
+                            <option value="ping">ICMP ping</option>
+                            <option value="tcp">TCP端口连接</option>
+                            <option value="arp">ARP邻居表</option>
+                        </select>
+                        <input type="text" name="verify_host" placeholder="主机，例如: 192.168.1.20（ARP方式可留空）">
+                        <input type="text" name="verify_port" placeholder="TCP端口，例如: 22">
+                        <input type="text" name="verify_timeout" placeholder="超时，例如: 2m（默认 {{.VerifyTimeout}}）">
+                        <div class="hint">唤醒后轮询直到设备响应或超时，页面会等待验证结果</div>
+                    </div>
+                    <div class="form-group">
+                        <label for="deviceNotes">备注（可选）</label>
+                        <input type="text" id="deviceNotes" name="notes">
+                    </div>
+                    <button type="submit">保存设备</button>
+                </form>
+            </details>
+        </div>
+
+        <div class="device-section">
+            <h2>🗂️ 设备分组</h2>
+            <div class="device-list">
+                {{range .Groups}}
+                <div class="device-item">
+                    <div class="device-info">
+                        <div class="device-name">{{.Name}}</div>
+                        <div class="device-details">{{if .Sequential}}按顺序: {{range $i, $n := .StepNames}}{{if $i}} → {{end}}{{$n}}{{end}}{{else}}同时唤醒: {{range $i, $n := .StepNames}}{{if $i}}, {{end}}{{$n}}{{end}}{{end}}</div>
+                    </div>
+                    <div class="device-actions">
+                        <form action="/groups/wake" method="POST">
+                            <input type="hidden" name="id" value="{{.ID}}">
+                            <button type="submit">唤醒</button>
+                        </form>
+                        <form action="/groups/delete" method="POST" onsubmit="return confirm('确定要删除这个分组吗？分组中的设备不会被删除')">
+                            <input type="hidden" name="id" value="{{.ID}}">
+                            <button type="submit" class="delete-btn">删除</button>
+                        </form>
+                    </div>
+                </div>
+                {{else}}
+                <div class="empty-devices">暂无设备分组</div>
+                {{end}}
+            </div>
+
+            {{if .Devices}}
+            <details>
+                <summary>➕ 添加分组</summary>
+                <form action="/groups/add" method="POST">
+                    <div class="form-group">
+                        <label for="groupName">分组名称</label>
+                        <input type="text" id="groupName" name="name" placeholder="例如: 实验室机柜" required>
+                    </div>
+                    <div class="form-group">
+                        <label for="groupSteps">设备（每行一台）</label>
+                        <textarea id="groupSteps" name="steps" rows="4" placeholder="storage 等待上线&#10;compute-1 30s&#10;compute-2" required></textarea>
+                        <div class="hint">设备名称后可加等待时间（如 30s）或"等待上线"（需要设备配置了上线验证），仅在按顺序唤醒时生效</div>
+                        <label class="checkbox-label"><input type="checkbox" name="sequential" value="1" checked> 按顺序唤醒</label>
+                    </div>
+                    <button type="submit">保存分组</button>
+                </form>
+            </details>
+            {{end}}
+        </div>
+
+        <div class="device-section">
+            <h2>⏰ 定时唤醒</h2>
+            <div class="device-list">
+                {{range .Schedules}}
+                <div class="device-item">
+                    <div class="device-info">
+                        <div class="device-name">{{.DeviceName}} <code>{{.Schedule.Cron}}</code></div>
+                        <div class="device-details">时区: {{.Timezone}}{{if .Schedule.SkipDates}} | 跳过: {{range $i, $d := .Schedule.SkipDates}}{{if $i}}, {{end}}{{$d}}{{end}}{{end}}</div>
+                        <div class="device-details">接下来: {{range $i, $t := .Upcoming}}{{if $i}}, {{end}}{{$t.Format "01-02 15:04"}}{{else}}无{{end}}</div>
+                        {{with .Schedule.LastRun}}<div class="device-details">上次执行: {{.Time.Format "2006-01-02 15:04:05"}} {{if .Success}}✅ 成功{{else}}❌ {{.Error}}{{end}}</div>{{end}}
+                    </div>
+                    <div class="device-actions">
+                        <form action="/schedules/delete" method="POST" onsubmit="return confirm('确定要删除这个定时任务吗？')">
+                            <input type="hidden" name="device" value="{{.DeviceID}}">
+                            <input type="hidden" name="id" value="{{.Schedule.ID}}">
+                            <button type="submit" class="delete-btn">删除</button>
+                        </form>
+                    </div>
+                </div>
+                {{else}}
+                <div class="empty-devices">暂无定时任务</div>
+                {{end}}
+            </div>
+
+            {{if .Devices}}
+            <details>
+                <summary>➕ 添加定时任务</summary>
+                <form action="/schedules/add" method="POST">
+                    <div class="form-group">
+                        <label for="scheduleDevice">设备</label>
+                        <select id="scheduleDevice" name="device">
+                            {{range .Devices}}<option value="{{.ID}}">{{.Name}}</option>{{end}}
+                        </select>
+                    </div>
+                    <div class="form-group">
+                        <label for="scheduleCron">cron表达式</label>
+                        <input type="text" id="scheduleCron" name="cron" placeholder="例如: 30 7 * * 1-5" required>
+                        <div class="hint">分 时 日 月 周，例如 "30 7 * * 1-5" 表示工作日7:30</div>
+                    </div>
+                    <div class="form-group">
+                        <label for="scheduleTimezone">时区（可选）</label>
+                        <input type="text" id="scheduleTimezone" name="timezone" placeholder="默认: {{.Timezone}}">
+                    </div>
+                    <div class="form-group">
+                        <label for="scheduleSkip">跳过日期（可选）</label>
+                        <input type="text" id="scheduleSkip" name="skip_dates" placeholder="例如: 2026-10-01, 2026-10-02">
+                        <div class="hint">逗号分隔，这些日期不执行（如节假日）</div>
+                    </div>
+                    <button type="submit">保存定时任务</button>
+                </form>
+            </details>
+            {{end}}
+        </div>
+    </div>
+
+    <datalist id="broadcasts">
+        {{range .Interfaces}}{{$name := .Name}}{{range .Addresses}}
+        <option value="{{.Broadcast}}">{{$name}} ({{.Network}})</option>
+        {{end}}{{end}}
+    </datalist>
+    <datalist id="ifaces">
+        {{range .Interfaces}}
+        <option value="{{.Name}}">{{.MAC}}</option>
+        {{end}}
+    </datalist>
+</body>
+</html>`
+
+const loginTemplate = `<!DOCTYPE html>
+<html lang="zh-CN">
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <title>登录 - 局域网唤醒服务</title>
+` + pageStyle + `</head>
+<body>
+    <div class="container">
+        <h1>🔐 登录</h1>
+        {{if .Message}}
+        <div class="message error">
+            {{.Message}}
+        </div>
+        {{end}}
+        <form action="/login" method="POST">
+            <input type="hidden" name="next" value="{{.Next}}">
+            <div class="form-group">
+                <label for="username">用户名</label>
+                <input type="text" id="username" name="username" autocomplete="username" required autofocus>
+            </div>
+            <div class="form-group">
+                <label for="password">密码</label>
+                <input type="password" id="password" name="password" autocomplete="current-password" required>
+            </div>
+            <button type="submit">登录</button>
+        </form>
+    </div>
+</body>
+</html>`
+
+const historyTemplate = `<!DOCTYPE html>
+<html lang="zh-CN">
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <title>唤醒历史 - 局域网唤醒服务</title>
+` + pageStyle + `</head>
+<body>
+    <div class="container wide">
+        <form action="/logout" method="POST" class="user-bar">
+            <a href="/">← 返回首页</a>
+            <a href="/api/v1/audit/export?format=csv">导出CSV</a>
+            <a href="/api/v1/audit/export?format=json">导出JSON</a>
+            {{if .User}}
+            <span>👤 {{.User}}</span>
+            <button type="submit">退出登录</button>
+            {{end}}
+        </form>
+        <h1>📜 唤醒历史</h1>
+        {{if .Entries}}
+        <table class="history-table">
+            <tr>
+                <th>时间</th>
+                <th>来源</th>
+                <th>设备</th>
+                <th>目标</th>
+                <th>结果</th>
+                <th>上线验证</th>
+            </tr>
+            {{range .Entries}}
+            <tr>
+                <td>{{.Time.Format "2006-01-02 15:04:05"}}</td>
+                <td>{{.Source}}{{if .User}}<br>{{.User}}{{end}}{{if .ClientIP}}<br>{{.ClientIP}}{{end}}</td>
+                <td>{{if .Device}}{{.Device}}<br>{{end}}{{.MAC}}</td>
+                <td>{{.Destination}}</td>
+                <td>{{if .Success}}<span class="ok">成功，{{.Packets}} 个包</span>{{else}}<span class="failed">{{.Error}}</span>{{end}}</td>
+                <td>{{with .Verify}}<span class="{{if .Online}}ok{{else}}failed{{end}}">{{.Summary}}</span>{{else}}-{{end}}</td>
+            </tr>
+            {{end}}
+        </table>
+        {{else}}
+        <div class="empty-devices">暂无唤醒记录</div>
+        {{end}}
+        <div class="pager">
+            <span>{{if .Prev}}<a href="/history?page={{.Prev}}">← 较新</a>{{end}}</span>
+            <span>第 {{.Page}} / {{.Pages}} 页，共 {{.Total}} 条</span>
+            <span>{{if .Next}}<a href="/history?page={{.Next}}">较旧 →</a>{{end}}</span>
+        </div>
+    </div>
+</body>
+</html>`
+
+const discoveryTemplate = `<!DOCTYPE html>
+<html lang="zh-CN">
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <title>发现设备 - 局域网唤醒服务</title>
+` + pageStyle + `</head>
+<body>
+    <div class="container wide">
+        <form action="/logout" method="POST" class="user-bar">
+            <a href="/">← 返回首页</a>
+            {{if .User}}
+            <span>👤 {{.User}}</span>
+            <button type="submit">退出登录</button>
+            {{end}}
+        </form>
+        <h1>🔍 发现设备</h1>
+        {{if .Message}}
+        <div class="message {{if .Success}}success{{else}}error{{end}}">
+            {{.Message}}
+        </div>
+        {{end}}
+        <form action="/discovery" method="GET">
+            <div class="form-group">
+                <label for="sweep">扫描网段（可选）</label>
+                <input type="text" id="sweep" name="sweep" placeholder="例如: 192.168.1.0/24" value="{{.Sweep}}" list="networks">
+                <datalist id="networks">
+                    {{range .Networks}}<option value="{{.}}">{{end}}
+                </datalist>
+                <div class="hint">留空时只列出邻居表中已有的主机；填写时先向网段内每个地址发送探测包，最多 1024 个地址，需要几秒钟</div>
+                <label class="checkbox-label"><input type="checkbox" name="resolve" value="1"{{if .Resolve}} checked{{end}}> 反向解析主机名</label>
+            </div>
+            <button type="submit">刷新</button>
+        </form>
+        <h2>邻居表中的主机</h2>
+        {{if .Hosts}}
+        <table class="history-table">
+            <tr>
+                <th>IP地址</th>
+                <th>MAC地址</th>
+                <th>接口</th>
+                <th>主机名</th>
+                <th>登记</th>
+            </tr>
+            {{range .Hosts}}
+            <tr>
+                <td>{{.IP}}</td>
+                <td>{{.MAC}}</td>
+                <td>{{.Interface}}</td>
+                <td>{{.Hostname}}</td>
+                <td>
+                    {{if .DeviceID}}<span class="ok">已登记为 {{.Device}}</span>{{else}}
+                    <form action="/discovery/import" method="POST" class="import-form">
+                        <input type="hidden" name="mac" value="{{.MAC}}">
+                        <input type="hidden" name="ip" value="{{.IP}}">
+                        <input type="hidden" name="hostname" value="{{.Hostname}}">
+                        <input type="text" name="name" placeholder="设备名称" value="{{if .Hostname}}{{.Hostname}}{{else}}{{.IP}}{{end}}">
+                        <button type="submit">导入</button>
+                    </form>
+                    {{end}}
+                </td>
+            </tr>
+            {{end}}
+        </table>
+        {{else}}
+        <div class="empty-devices">邻居表中没有主机</div>
+        {{end}}
+    </div>
+</body>
+</html>`
+
+const wakingTemplate = `<!DOCTYPE html>
+<html lang="zh-CN">
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    {{if not .Failed}}<meta http-equiv="refresh" content="3">{{end}}
+    <title>正在唤醒 - {{.Host}}</title>
+` + pageStyle + `</head>
+<body>
+    <div class="container">
+        {{if .Failed}}
+        <h1>😴 {{.Host}}</h1>
+        <div class="message error">
+            {{.Error}}
+        </div>
+        <button type="button" onclick="location.reload()">重试</button>
+        {{else}}
+        <h1>⏰ 正在唤醒 {{.Host}}</h1>
+        <div class="message success">
+            设备正在启动，已等待 {{.Elapsed}}（最长 {{.MaxWait}}），上线后页面会自动打开。
+        </div>
+        <p class="hint">本页面每3秒自动刷新一次。</p>
+        {{end}}
+    </div>
+</body>
+</html>`
@@ -0,0 +1,377 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+
+	"github.com/tdh62/wake_on_lan_proxy/wol"
+)
+
+// 唤醒后的上线验证方式
+const (
+	verifyPing = "ping" // ICMP ping
+	verifyTCP  = "tcp"  // TCP连接指定端口
+	verifyARP  = "arp"  // 邻居表中出现该设备
+)
+
+var errInvalidVerify = errors.New("无效的验证配置")
+
+// VerifyConfig 唤醒后确认设备上线的方式
+type VerifyConfig struct {
+	Method  string   `json:"method"`
+	Host    string   `json:"host,omitempty"`    // ping/tcp必填，arp可选（为空时按MAC地址查找）
+	Port    int      `json:"port,omitempty"`    // tcp方式的端口
+	Timeout Duration `json:"timeout,omitempty"` // 为0时使用默认验证超时
+}
+
+// VerifyResult 上线验证的结果
+type VerifyResult struct {
+	Method         string        `json:"method"`
+	Online         bool          `json:"online"`
+	Elapsed        time.Duration `json:"-"`
+	ElapsedSeconds float64       `json:"elapsed_seconds"`
+	Error          string        `json:"error,omitempty"`
+}
+
+// Summary 返回用于页面提示的结果描述
+func (r VerifyResult) Summary() string {
+	switch {
+	case r.Error != "":
+		return fmt.Sprintf("验证失败: %s", r.Error)
+	case r.Online:
+		return fmt.Sprintf("设备已在 %s 后上线", r.Elapsed.Round(time.Second))
+	default:
+		return fmt.Sprintf("设备在 %s 内没有响应", r.Elapsed.Round(time.Second))
+	}
+}
+
+// validate 检查验证配置是否完整
+func (v VerifyConfig) validate() error {
+	switch v.Method {
+	case verifyPing:
+		if v.Host == "" {
+			return fmt.Errorf("%w: ping方式需要指定主机", errInvalidVerify)
+		}
+	case verifyTCP:
+		if v.Host == "" {
+			return fmt.Errorf("%w: tcp方式需要指定主机", errInvalidVerify)
+		}
+		if v.Port < 1 || v.Port > 65535 {
+			return fmt.Errorf("%w: tcp方式需要有效的端口", errInvalidVerify)
+		}
+	case verifyARP:
+	default:
+		return fmt.Errorf("%w: 不支持的验证方式: %s", errInvalidVerify, v.Method)
+	}
+	if v.Timeout < 0 {
+		return fmt.Errorf("%w: 超时不能为负数", errInvalidVerify)
+	}
+	return nil
+}
+
+// timeout 返回本次验证的总超时
+func (v VerifyConfig) timeout() time.Duration {
+	if v.Timeout > 0 {
+		return time.Duration(v.Timeout)
+	}
+	return time.Duration(config.VerifyTimeout)
+}
+
+// verifyWake 按验证配置轮询，直到设备响应或超时
+func verifyWake(ctx context.Context, v VerifyConfig, macAddr string) VerifyResult {
+	result := VerifyResult{Method: v.Method}
+	defer func() { recordVerification(ctx, macAddr, result) }()
+	if err := v.validate(); err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, v.timeout())
+	defer cancel()
+
+	start := time.Now()
+	finish := func() VerifyResult {
+		result.Elapsed = time.Since(start)
+		result.ElapsedSeconds = result.Elapsed.Round(100 * time.Millisecond).Seconds()
+		return result
+	}
+
+	interval := time.Duration(config.VerifyInterval)
+	for {
+		online, err := probe(ctx, v, macAddr)
+		if err != nil {
+			result.Error = err.Error()
+			return finish()
+		}
+		if online {
+			result.Online = true
+			return finish()
+		}
+
+		select {
+		case <-ctx.Done():
+			return finish()
+		case <-time.After(interval):
+		}
+	}
+}
+
+// recordVerification 将验证结果写入审计日志和指标，并发布到MQTT和webhook
+func recordVerification(ctx context.Context, macAddr string, result VerifyResult) {
+	observeVerify(result)
+	auditVerification(ctx, macAddr, &result)
+	mqttBridge.publishVerification(macAddr, result)
+	webhooks.fireVerification(ctx, macAddr, result)
+}
+
+// extendWriteDeadline 为需要等待上线验证的请求延长响应写入超时
+func extendWriteDeadline(w http.ResponseWriter, timeout time.Duration) {
+	http.NewResponseController(w).SetWriteDeadline(time.Now().Add(timeout + 10*time.Second))
+}
+
+// probe 进行一次探测，返回的错误表示无法进行探测（如权限不足），而不是设备未上线
+func probe(ctx context.Context, v VerifyConfig, macAddr string) (bool, error) {
+	// 单次探测不超过轮询间隔，避免一次探测占用全部超时；ARP需要等待内核确认过期的邻居条目
+	timeout := time.Duration(config.VerifyInterval)
+	if v.Method == verifyARP {
+		timeout = max(timeout, arpConfirmTimeout)
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	switch v.Method {
+	case verifyTCP:
+		ip, err := resolveVerifyHost(ctx, "ip", v.Host)
+		if ip == nil {
+			return false, err
+		}
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, "tcp", net.JoinHostPort(ip.String(), strconv.Itoa(v.Port)))
+		if err != nil {
+			return false, nil
+		}
+		conn.Close()
+		return true, nil
+	case verifyPing:
+		ip, err := resolveVerifyHost(ctx, "ip4", v.Host)
+		if ip == nil {
+			return false, err
+		}
+		return pingOnce(ctx, ip)
+	case verifyARP:
+		var ip net.IP
+		if v.Host != "" {
+			var err error
+			if ip, err = resolveVerifyHost(ctx, "ip4", v.Host); ip == nil {
+				return false, err
+			}
+		}
+		return arpPresent(ctx, ip, macAddr)
+	}
+	return false, fmt.Errorf("%w: 不支持的验证方式: %s", errInvalidVerify, v.Method)
+}
+
+// resolveVerifyHost 解析验证主机，探测包同样要符合 target_allowlist；
+// 暂时无法解析时返回nil和nil，视为设备未上线
+func resolveVerifyHost(ctx context.Context, network, host string) (net.IP, error) {
+	ips, err := net.DefaultResolver.LookupIP(ctx, network, host)
+	if err != nil || len(ips) == 0 {
+		return nil, nil
+	}
+	if err := checkDestination(ips[0]); err != nil {
+		return nil, fmt.Errorf("验证主机 %s: %w", host, err)
+	}
+	return ips[0], nil
+}
+
+// pingOnce 发送一个ICMP回显请求并等待回复
+//
+// 优先使用无需特权的ICMP数据报套接字（需要 net.ipv4.ping_group_range 允许），
+// 失败时退回到需要CAP_NET_RAW的原始套接字
+func pingOnce(ctx context.Context, ip net.IP) (bool, error) {
+	var dst net.Addr = &net.UDPAddr{IP: ip}
+	conn, err := icmp.ListenPacket("udp4", "0.0.0.0")
+	if err != nil {
+		dst = &net.IPAddr{IP: ip}
+		conn, err = icmp.ListenPacket("ip4:icmp", "0.0.0.0")
+	}
+	if err != nil {
+		return false, fmt.Errorf("无法创建ICMP套接字，需要CAP_NET_RAW或设置 net.ipv4.ping_group_range: %v", err)
+	}
+	defer conn.Close()
+
+	payload := []byte("wol-service")
+	msg := icmp.Message{
+		Type: ipv4.ICMPTypeEcho,
+		Body: &icmp.Echo{ID: os.Getpid() & 0xffff, Seq: 1, Data: payload},
+	}
+	b, err := msg.Marshal(nil)
+	if err != nil {
+		return false, err
+	}
+	if _, err := conn.WriteTo(b, dst); err != nil {
+		return false, nil
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetReadDeadline(deadline)
+	}
+	buf := make([]byte, 1500)
+	for {
+		n, peer, err := conn.ReadFrom(buf)
+		if err != nil {
+			return false, nil
+		}
+		reply, err := icmp.ParseMessage(1, buf[:n])
+		if err != nil || reply.Type != ipv4.ICMPTypeEchoReply {
+			continue
+		}
+		echo, ok := reply.Body.(*icmp.Echo)
+		if !ok || string(echo.Data) != string(payload) {
+			continue
+		}
+		if peerIP(peer).Equal(ip) {
+			return true, nil
+		}
+	}
+}
+
+func peerIP(addr net.Addr) net.IP {
+	switch a := addr.(type) {
+	case *net.UDPAddr:
+		return a.IP
+	case *net.IPAddr:
+		return a.IP
+	}
+	return nil
+}
+
+// ARP验证的等待时间
+const (
+	// arpConfirmTimeout 等待邻居条目变为 REACHABLE 的最长时间：内核在过期（STALE）的条目上收到
+	// 发出的数据包后，要等 delay_first_probe_time（默认5秒）才发出单播ARP请求
+	arpConfirmTimeout = 8 * time.Second
+	arpPollInterval   = 100 * time.Millisecond
+)
+
+// neighborTable 读取带状态的邻居表，测试时可以替换
+var neighborTable = netlinkNeighbors
+
+// arpPresent 向设备发送一个UDP包，使内核发出ARP请求（条目已过期时为单播确认），
+// 再等待邻居条目变为 REACHABLE。STALE、DELAY、PROBE 等状态只说明设备之前出现过，不视为在线。
+//
+// 指定了IP时按IP查找；否则探测邻居表中该MAC地址的所有IPv4地址，邻居表中没有该设备时视为未上线
+func arpPresent(ctx context.Context, ip net.IP, macAddr string) (bool, error) {
+	// 邻居表中的MAC地址为 AA:BB:CC:DD:EE:FF 格式，先统一 aa-bb-cc-dd-ee-ff 等写法
+	if mac, err := wol.ParseMAC(macAddr); err == nil {
+		macAddr = wol.FormatMAC(mac)
+	}
+
+	neighbors, err := neighborTable()
+	if err != nil {
+		return false, err
+	}
+
+	targets := []net.IP{ip}
+	if ip == nil {
+		targets = nil
+		for _, n := range neighbors {
+			if n.IP.To4() != nil && strings.EqualFold(n.MAC, macAddr) && checkDestination(n.IP) == nil {
+				targets = append(targets, n.IP)
+			}
+		}
+	}
+	if len(targets) == 0 {
+		return false, nil
+	}
+	if conn, err := net.ListenUDP("udp4", nil); err == nil {
+		for _, t := range targets {
+			conn.WriteToUDP([]byte{0}, &net.UDPAddr{IP: t, Port: defaultWakePort})
+		}
+		conn.Close()
+	}
+
+	for {
+		for _, n := range neighbors {
+			if !n.Reachable || (ip != nil && !n.IP.Equal(ip)) || (macAddr != "" && !strings.EqualFold(n.MAC, macAddr)) {
+				continue
+			}
+			if ip != nil || n.IP.To4() != nil {
+				return true, nil
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return false, nil
+		case <-time.After(arpPollInterval):
+		}
+		if neighbors, err = neighborTable(); err != nil {
+			return false, err
+		}
+	}
+}
+
+// Linux的ARP表位置
+const arpTablePath = "/proc/net/arp"
+
+// ARPEntry ARP表中的一条记录
+type ARPEntry struct {
+	IP        net.IP
+	MAC       string
+	Interface string
+	Complete  bool
+}
+
+// readARPTable 读取 /proc/net/arp 格式的ARP表
+func readARPTable(path string) ([]ARPEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("无法读取ARP表: %v", err)
+	}
+	defer f.Close()
+	return parseARPTable(f)
+}
+
+// parseARPTable 解析ARP表，格式为:
+//
+//	IP address       HW type     Flags       HW address            Mask     Device
+//	192.168.1.1      0x1         0x2         aa:bb:cc:dd:ee:ff     *        eth0
+func parseARPTable(r io.Reader) ([]ARPEntry, error) {
+	var entries []ARPEntry
+	scanner := bufio.NewScanner(r)
+	scanner.Scan() // 跳过表头
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 6 {
+			continue
+		}
+		ip := net.ParseIP(fields[0])
+		if ip == nil {
+			continue
+		}
+		flags, err := strconv.ParseUint(strings.TrimPrefix(fields[2], "0x"), 16, 32)
+		if err != nil {
+			continue
+		}
+		entries = append(entries, ARPEntry{
+			IP:        ip,
+			MAC:       strings.ToUpper(fields[3]),
+			Interface: fields[5],
+			Complete:  flags&0x2 != 0, // ATF_COM
+		})
+	}
+	return entries, scanner.Err()
+}
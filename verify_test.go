@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// useFastVerify 缩短探测间隔，加快测试
+func useFastVerify(t *testing.T) {
+	t.Helper()
+
+	old := config
+	config.VerifyInterval = Duration(50 * time.Millisecond)
+	t.Cleanup(func() { config = old })
+}
+
+func TestVerifyWakeTCP(t *testing.T) {
+	useFastVerify(t)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	port := ln.Addr().(*net.TCPAddr).Port
+
+	online := verifyWake(context.Background(), VerifyConfig{Method: verifyTCP, Host: "127.0.0.1", Port: port, Timeout: Duration(time.Second)}, "")
+	if !online.Online || online.Error != "" {
+		t.Errorf("verifyWake() = %+v, want online", online)
+	}
+
+	// 关闭监听后端口不再响应，应在超时后报告未上线
+	ln.Close()
+	offline := verifyWake(context.Background(), VerifyConfig{Method: verifyTCP, Host: "127.0.0.1", Port: port, Timeout: Duration(200 * time.Millisecond)}, "")
+	if offline.Online || offline.Error != "" {
+		t.Errorf("verifyWake() = %+v, want offline", offline)
+	}
+	if offline.Elapsed < 200*time.Millisecond {
+		t.Errorf("verifyWake() returned after %v, want to wait for the timeout", offline.Elapsed)
+	}
+	if !strings.Contains(offline.Summary(), "没有响应") {
+		t.Errorf("Summary() = %q", offline.Summary())
+	}
+}
+
+func TestVerifyConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		verify  VerifyConfig
+		wantErr bool
+	}{
+		{name: "Ping", verify: VerifyConfig{Method: verifyPing, Host: "192.168.1.20"}},
+		{name: "TCP", verify: VerifyConfig{Method: verifyTCP, Host: "nas.lan", Port: 22}},
+		{name: "ARP without host", verify: VerifyConfig{Method: verifyARP}},
+		{name: "Ping without host", verify: VerifyConfig{Method: verifyPing}, wantErr: true},
+		{name: "TCP without port", verify: VerifyConfig{Method: verifyTCP, Host: "nas.lan"}, wantErr: true},
+		{name: "Unknown method", verify: VerifyConfig{Method: "smoke-signal"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.verify.validate(); (err != nil) != tt.wantErr {
+				t.Errorf("validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseARPTable(t *testing.T) {
+	table := `IP address       HW type     Flags       HW address            Mask     Device
+192.168.1.1      0x1         0x2         aa:bb:cc:dd:ee:ff     *        eth0
+192.168.1.20     0x1         0x0         00:00:00:00:00:00     *        eth0
+garbage
+`
+	entries, err := parseARPTable(strings.NewReader(table))
+	if err != nil {
+		t.Fatalf("parseARPTable() error = %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("parseARPTable() returned %d entries, want 2", len(entries))
+	}
+	if !entries[0].Complete || entries[0].MAC != "AA:BB:CC:DD:EE:FF" || entries[0].Interface != "eth0" {
+		t.Errorf("entries[0] = %+v", entries[0])
+	}
+	if entries[1].Complete {
+		t.Errorf("entries[1] should be incomplete: %+v", entries[1])
+	}
+}
+
+// useNeighborTable 用 tables 依次替换每次读取的邻居表，读完后一直返回最后一张
+func useNeighborTable(t *testing.T, tables ...[]neighbor) {
+	t.Helper()
+
+	var mu sync.Mutex
+	old := neighborTable
+	neighborTable = func() ([]neighbor, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		table := tables[0]
+		if len(tables) > 1 {
+			tables = tables[1:]
+		}
+		return table, nil
+	}
+	t.Cleanup(func() { neighborTable = old })
+}
+
+func TestARPPresent(t *testing.T) {
+	ip := net.IPv4(127, 0, 0, 2)
+	stale := []neighbor{{IP: ip, MAC: "AA:BB:CC:DD:EE:FF", Interface: "lo"}}
+	reachable := []neighbor{{IP: ip, MAC: "AA:BB:CC:DD:EE:FF", Interface: "lo", Reachable: true}}
+
+	tests := []struct {
+		name   string
+		ip     net.IP
+		tables [][]neighbor
+		want   bool
+	}{
+		// 设备已关机但条目尚未过期，不能视为在线
+		{name: "Stale entry by IP", ip: ip, tables: [][]neighbor{stale}},
+		{name: "Stale entry by MAC", tables: [][]neighbor{stale}},
+		{name: "Confirmed after probe by IP", ip: ip, tables: [][]neighbor{stale, stale, reachable}, want: true},
+		{name: "Confirmed after probe by MAC", tables: [][]neighbor{stale, reachable}, want: true},
+		{name: "Other MAC", ip: ip, tables: [][]neighbor{{{IP: ip, MAC: "11:22:33:44:55:66", Reachable: true}}}},
+		{name: "Not in table", tables: [][]neighbor{nil}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useNeighborTable(t, tt.tables...)
+			ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+			defer cancel()
+
+			online, err := arpPresent(ctx, tt.ip, "aa:bb:cc:dd:ee:ff")
+			if err != nil || online != tt.want {
+				t.Errorf("arpPresent() = %v, %v, want %v", online, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyWakeARPStale(t *testing.T) {
+	useFastVerify(t)
+	useNeighborTable(t, []neighbor{{IP: net.IPv4(127, 0, 0, 2), MAC: "AA:BB:CC:DD:EE:FF", Interface: "lo"}})
+
+	result := verifyWake(context.Background(), VerifyConfig{Method: verifyARP, Timeout: Duration(300 * time.Millisecond)}, "AA:BB:CC:DD:EE:FF")
+	if result.Online || result.Error != "" {
+		t.Errorf("verifyWake() = %+v, want offline for a STALE entry", result)
+	}
+}
@@ -0,0 +1,393 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/tdh62/wake_on_lan_proxy/wol"
+)
+
+// webhook事件
+const (
+	webhookEventWake   = "wake"   // 每次唤醒尝试之后
+	webhookEventVerify = "verify" // 上线验证完成之后
+)
+
+// webhook的默认设置
+const (
+	defaultWebhookTimeout = 10 * time.Second
+	defaultWebhookRetries = 3
+	defaultWebhookBackoff = time.Second
+)
+
+// maxWebhookDeliveries 投递记录最多保留的条数
+const maxWebhookDeliveries = 500
+
+// WebhookConfig 一个接收唤醒事件的webhook
+type WebhookConfig struct {
+	Name        string            `json:"name" yaml:"name" toml:"name"`
+	URL         string            `json:"url" yaml:"url" toml:"url"`
+	Events      []string          `json:"events" yaml:"events" toml:"events"`                   // wake、verify，为空时接收全部事件
+	Body        string            `json:"body" yaml:"body" toml:"body"`                         // 请求体的Go模板，为空时发送JSON格式的事件
+	ContentType string            `json:"content_type" yaml:"content_type" toml:"content_type"` // 为空时使用 application/json
+	Headers     map[string]string `json:"headers" yaml:"headers" toml:"headers"`
+	Secret      string            `json:"secret" yaml:"secret" toml:"secret"`    // 设置后用HMAC-SHA256签名时间戳和请求体
+	Timeout     Duration          `json:"timeout" yaml:"timeout" toml:"timeout"` // 单次请求超时，为0时使用默认值
+	Retries     *int              `json:"retries" yaml:"retries" toml:"retries"` // 失败后的重试次数，未设置时使用默认值
+	Backoff     Duration          `json:"backoff" yaml:"backoff" toml:"backoff"` // 第一次重试前的等待时间，之后每次加倍
+}
+
+func (c WebhookConfig) validate() error {
+	if c.Name == "" {
+		return fmt.Errorf("webhook需要指定名称")
+	}
+	u, err := url.Parse(c.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("webhook %s 的地址无效: %s", c.Name, c.URL)
+	}
+	for _, e := range c.Events {
+		if e != webhookEventWake && e != webhookEventVerify {
+			return fmt.Errorf("webhook %s 的事件无效: %s", c.Name, e)
+		}
+	}
+	if _, err := c.template(); err != nil {
+		return fmt.Errorf("webhook %s 的请求体模板无效: %v", c.Name, err)
+	}
+	if c.Timeout < 0 || c.Backoff < 0 || (c.Retries != nil && *c.Retries < 0) {
+		return fmt.Errorf("webhook %s 的超时、重试次数和重试间隔不能为负数", c.Name)
+	}
+	return nil
+}
+
+// template 解析请求体模板，未设置模板时返回nil
+func (c WebhookConfig) template() (*template.Template, error) {
+	if c.Body == "" {
+		return nil, nil
+	}
+	return template.New(c.Name).Funcs(template.FuncMap{
+		"json": func(v any) (string, error) {
+			b, err := json.Marshal(v)
+			return string(b), err
+		},
+	}).Parse(c.Body)
+}
+
+// WebhookEvent 发送给webhook的事件，也是请求体模板的数据
+type WebhookEvent struct {
+	Event       string        `json:"event"`
+	Time        time.Time     `json:"time"`
+	Source      string        `json:"source,omitempty"`
+	User        string        `json:"user,omitempty"`
+	ClientIP    string        `json:"client_ip,omitempty"`
+	DeviceID    string        `json:"device_id,omitempty"`
+	Device      string        `json:"device,omitempty"`
+	MAC         string        `json:"mac"`
+	Destination string        `json:"destination,omitempty"`
+	Success     bool          `json:"success"` // 唤醒事件为发送成功，验证事件为设备已上线
+	Packets     int           `json:"packets,omitempty"`
+	Error       string        `json:"error,omitempty"`
+	Verify      *VerifyResult `json:"verify,omitempty"`
+}
+
+// WebhookDelivery 一次事件投递的记录
+type WebhookDelivery struct {
+	ID         int64     `json:"id"`
+	Webhook    string    `json:"webhook"`
+	Event      string    `json:"event"`
+	MAC        string    `json:"mac"`
+	Time       time.Time `json:"time"`
+	Attempts   int       `json:"attempts"`
+	StatusCode int       `json:"status_code,omitempty"`
+	Success    bool      `json:"success"`
+	Pending    bool      `json:"pending,omitempty"` // 仍在等待重试
+	Error      string    `json:"error,omitempty"`
+}
+
+type webhook struct {
+	cfg     WebhookConfig
+	body    *template.Template
+	events  map[string]bool
+	timeout time.Duration
+	retries int
+	backoff time.Duration
+}
+
+// WebhookDispatcher 异步投递唤醒事件，失败时按指数退避重试
+type WebhookDispatcher struct {
+	hooks  []*webhook
+	client *http.Client
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu         sync.Mutex
+	nextID     int64
+	deliveries []WebhookDelivery // 按投递顺序，只保留最近的 maxWebhookDeliveries 条
+}
+
+// webhooks 当前配置的webhook，未配置时为nil
+var webhooks *WebhookDispatcher
+
+// newWebhookDispatcher 按配置创建webhook，配置应已通过校验
+func newWebhookDispatcher(configs []WebhookConfig) *WebhookDispatcher {
+	ctx, cancel := context.WithCancel(context.Background())
+	d := &WebhookDispatcher{client: &http.Client{}, ctx: ctx, cancel: cancel}
+	for _, cfg := range configs {
+		body, _ := cfg.template()
+		h := &webhook{
+			cfg:     cfg,
+			body:    body,
+			timeout: defaultWebhookTimeout,
+			retries: defaultWebhookRetries,
+			backoff: defaultWebhookBackoff,
+		}
+		if len(cfg.Events) > 0 {
+			h.events = make(map[string]bool, len(cfg.Events))
+			for _, e := range cfg.Events {
+				h.events[e] = true
+			}
+		}
+		if cfg.Timeout > 0 {
+			h.timeout = time.Duration(cfg.Timeout)
+		}
+		if cfg.Retries != nil {
+			h.retries = *cfg.Retries
+		}
+		if cfg.Backoff > 0 {
+			h.backoff = time.Duration(cfg.Backoff)
+		}
+		d.hooks = append(d.hooks, h)
+	}
+	return d
+}
+
+// Close 取消等待中的重试，并等待进行中的投递结束
+func (d *WebhookDispatcher) Close() {
+	d.cancel()
+	d.wg.Wait()
+}
+
+// fireWake 发送唤醒事件，mac 为解析后的MAC地址，无效时为空
+func (d *WebhookDispatcher) fireWake(ctx context.Context, target WakeTarget, mac string, packets int, err error) {
+	if d == nil {
+		return
+	}
+
+	e := d.newEvent(ctx, webhookEventWake, target.MAC, mac)
+	e.Destination = target.destination()
+	e.Success = err == nil
+	e.Packets = packets
+	if err != nil {
+		e.Error = err.Error()
+	}
+	d.dispatch(e)
+}
+
+// fireVerification 发送上线验证完成的事件
+func (d *WebhookDispatcher) fireVerification(ctx context.Context, macAddr string, result VerifyResult) {
+	if d == nil {
+		return
+	}
+
+	mac := ""
+	if b, err := wol.ParseMAC(macAddr); err == nil {
+		mac = wol.FormatMAC(b)
+	}
+	e := d.newEvent(ctx, webhookEventVerify, macAddr, mac)
+	e.Success = result.Online && result.Error == ""
+	e.Error = result.Error
+	e.Verify = &result
+	d.dispatch(e)
+}
+
+// newEvent 创建事件，填入来源和登记的设备，raw 为请求中的MAC地址，mac 为解析后的MAC地址
+func (d *WebhookDispatcher) newEvent(ctx context.Context, event, raw, mac string) WebhookEvent {
+	e := WebhookEvent{Event: event, Time: time.Now(), MAC: raw}
+	if mac != "" {
+		e.MAC = mac
+		if device, ok := registry.Find(mac); ok {
+			e.DeviceID, e.Device = device.ID, device.Name
+		}
+	}
+	if origin := originOf(ctx); origin != nil {
+		e.Source, e.User, e.ClientIP = origin.source, origin.user, origin.clientIP
+	}
+	return e
+}
+
+// dispatch 在后台向订阅了该事件的每个webhook投递
+func (d *WebhookDispatcher) dispatch(e WebhookEvent) {
+	for _, h := range d.hooks {
+		if h.events != nil && !h.events[e.Event] {
+			continue
+		}
+		id := d.record(WebhookDelivery{Webhook: h.cfg.Name, Event: e.Event, MAC: e.MAC, Time: e.Time, Pending: true})
+		d.wg.Add(1)
+		go func(h *webhook) {
+			defer d.wg.Done()
+			d.deliver(h, id, e)
+		}(h)
+	}
+}
+
+// deliver 投递一个事件，网络错误、5xx和429响应按指数退避重试
+func (d *WebhookDispatcher) deliver(h *webhook, id int64, e WebhookEvent) {
+	body, err := h.render(e)
+	if err != nil {
+		d.finish(h, id, 0, fmt.Errorf("无法生成请求体: %v", err))
+		return
+	}
+
+	backoff := h.backoff
+	for attempt := 1; ; attempt++ {
+		status, err := d.send(h, id, e.Event, body)
+		d.update(id, func(dl *WebhookDelivery) {
+			dl.Attempts, dl.StatusCode = attempt, status
+		})
+		if err == nil || !retryable(status) || attempt > h.retries {
+			d.finish(h, id, status, err)
+			return
+		}
+
+		log.Printf("webhook %s 投递失败，%s 后重试: %v", h.cfg.Name, backoff, err)
+		select {
+		case <-d.ctx.Done():
+			d.finish(h, id, status, err)
+			return
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// retryable 判断失败的请求是否值得重试，status 为0表示没有收到响应
+func retryable(status int) bool {
+	return status == 0 || status == http.StatusTooManyRequests || status >= 500
+}
+
+// render 生成请求体，未设置模板时为JSON格式的事件
+func (h *webhook) render(e WebhookEvent) ([]byte, error) {
+	if h.body == nil {
+		return json.Marshal(e)
+	}
+	var buf bytes.Buffer
+	if err := h.body.Execute(&buf, e); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// send 发送一次请求，非2xx响应作为错误返回
+func (d *WebhookDispatcher) send(h *webhook, id int64, event string, body []byte) (int, error) {
+	ctx, cancel := context.WithTimeout(d.ctx, h.timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	contentType := h.cfg.ContentType
+	if contentType == "" {
+		contentType = "application/json"
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("User-Agent", "wol-service")
+	req.Header.Set("X-WOL-Event", event)
+	req.Header.Set("X-WOL-Delivery", fmt.Sprint(id))
+	for k, v := range h.cfg.Headers {
+		req.Header.Set(k, v)
+	}
+	// 每次尝试使用新的时间戳，接收方据此拒绝重放的旧请求
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("X-WOL-Timestamp", timestamp)
+	if h.cfg.Secret != "" {
+		req.Header.Set("X-WOL-Signature-256", "sha256="+signWebhook(h.cfg.Secret, timestamp, body))
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("响应状态码 %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// signWebhook 返回"时间戳.请求体"的HMAC-SHA256签名（十六进制）
+func signWebhook(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// record 添加一条投递记录，返回其ID
+func (d *WebhookDispatcher) record(dl WebhookDelivery) int64 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.nextID++
+	dl.ID = d.nextID
+	d.deliveries = append(d.deliveries, dl)
+	if len(d.deliveries) > maxWebhookDeliveries {
+		d.deliveries = append(d.deliveries[:0:0], d.deliveries[len(d.deliveries)-maxWebhookDeliveries:]...)
+	}
+	return dl.ID
+}
+
+// update 修改一条投递记录，记录已被淘汰时不做任何事
+func (d *WebhookDispatcher) update(id int64, f func(dl *WebhookDelivery)) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for i := len(d.deliveries) - 1; i >= 0; i-- {
+		if d.deliveries[i].ID == id {
+			f(&d.deliveries[i])
+			return
+		}
+	}
+}
+
+// finish 记录投递的最终结果
+func (d *WebhookDispatcher) finish(h *webhook, id int64, status int, err error) {
+	d.update(id, func(dl *WebhookDelivery) {
+		dl.Pending = false
+		dl.StatusCode = status
+		dl.Success = err == nil
+		if err != nil {
+			dl.Error = err.Error()
+		}
+	})
+	if err != nil {
+		log.Printf("webhook %s 投递失败: %v", h.cfg.Name, err)
+	}
+}
+
+// Deliveries 返回投递记录，最新的在前
+func (d *WebhookDispatcher) Deliveries() []WebhookDelivery {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	result := make([]WebhookDelivery, len(d.deliveries))
+	for i, dl := range d.deliveries {
+		result[len(d.deliveries)-1-i] = dl
+	}
+	return result
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// webhookRequest 测试服务器收到的一个请求
+type webhookRequest struct {
+	header http.Header
+	body   string
+}
+
+// startWebhookServer 启动记录请求的测试服务器，status 返回每个请求的响应状态码
+func startWebhookServer(t *testing.T, status func(n int) int) (*httptest.Server, chan webhookRequest) {
+	t.Helper()
+
+	requests := make(chan webhookRequest, 10)
+	n := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		n++
+		w.WriteHeader(status(n))
+		requests <- webhookRequest{header: r.Header, body: string(body)}
+	}))
+	t.Cleanup(srv.Close)
+	return srv, requests
+}
+
+func useTestWebhooks(t *testing.T, configs ...WebhookConfig) *WebhookDispatcher {
+	t.Helper()
+
+	d := newWebhookDispatcher(configs)
+	old := webhooks
+	webhooks = d
+	t.Cleanup(func() {
+		d.Close()
+		webhooks = old
+	})
+	return d
+}
+
+func receiveWebhook(t *testing.T, requests chan webhookRequest) webhookRequest {
+	t.Helper()
+
+	select {
+	case req := <-requests:
+		return req
+	case <-time.After(2 * time.Second):
+		t.Fatal("webhook was not called")
+		return webhookRequest{}
+	}
+}
+
+// waitDelivered 等待所有投递完成
+func waitDelivered(t *testing.T, d *WebhookDispatcher, n int) []WebhookDelivery {
+	t.Helper()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		deliveries := d.Deliveries()
+		done := len(deliveries) == n
+		for _, dl := range deliveries {
+			done = done && !dl.Pending
+		}
+		if done {
+			return deliveries
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("deliveries = %+v, want %d finished", d.Deliveries(), n)
+	return nil
+}
+
+func TestWebhookWakeAndVerify(t *testing.T) {
+	reg := useTestRegistry(t)
+	useFastVerify(t)
+	conn := listenTestUDP(t)
+	addTestDevices(t, reg, Device{Name: "书房NAS", MAC: "AA:BB:CC:DD:EE:30"})
+	ok := func(int) int { return http.StatusOK }
+	jsonSrv, jsonRequests := startWebhookServer(t, ok)
+	chatSrv, chatRequests := startWebhookServer(t, ok)
+	useTestWebhooks(t,
+		WebhookConfig{Name: "tickets", URL: jsonSrv.URL, Secret: "s3cret", Events: []string{webhookEventWake}},
+		WebhookConfig{Name: "chat", URL: chatSrv.URL, Events: []string{webhookEventVerify}, Body: `{"text": {{json (printf "%s 已上线: %v" .Device .Success)}}}`},
+	)
+
+	ctx := withWakeOrigin(context.Background(), sourceWeb, "admin", "192.0.2.1")
+	sendWakeOnLANWith(ctx, nil, WakeTarget{MAC: "aa-bb-cc-dd-ee-30", Broadcast: "127.0.0.1", Port: conn.LocalAddr().(*net.UDPAddr).Port}.withDefaults())
+
+	req := receiveWebhook(t, jsonRequests)
+	var e WebhookEvent
+	if err := json.Unmarshal([]byte(req.body), &e); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	if e.Event != webhookEventWake || e.Device != "书房NAS" || e.MAC != "AA:BB:CC:DD:EE:30" || e.User != "admin" || !e.Success || e.Packets != 1 {
+		t.Errorf("event = %+v, want a successful wake of 书房NAS by admin", e)
+	}
+	timestamp, err := strconv.ParseInt(req.header.Get("X-WOL-Timestamp"), 10, 64)
+	if err != nil || time.Since(time.Unix(timestamp, 0)).Abs() > time.Minute {
+		t.Errorf("X-WOL-Timestamp = %q, want the current Unix time", req.header.Get("X-WOL-Timestamp"))
+	}
+	if got, want := req.header.Get("X-WOL-Signature-256"), "sha256="+signWebhook("s3cret", req.header.Get("X-WOL-Timestamp"), []byte(req.body)); got != want {
+		t.Errorf("signature = %s, want %s", got, want)
+	}
+	if req.header.Get("X-WOL-Event") != webhookEventWake {
+		t.Errorf("X-WOL-Event = %s", req.header.Get("X-WOL-Event"))
+	}
+
+	ln := listenTestTCP(t)
+	verifyWake(ctx, VerifyConfig{Method: verifyTCP, Host: "127.0.0.1", Port: ln.Addr().(*net.TCPAddr).Port}, "AA:BB:CC:DD:EE:30")
+	if req := receiveWebhook(t, chatRequests); req.body != `{"text": "书房NAS 已上线: true"}` {
+		t.Errorf("templated body = %s", req.body)
+	}
+
+	select {
+	case req := <-chatRequests:
+		t.Errorf("chat webhook received an unsubscribed event: %s", req.body)
+	case req := <-jsonRequests:
+		t.Errorf("tickets webhook received an unsubscribed event: %s", req.body)
+	default:
+	}
+}
+
+func TestSignWebhook(t *testing.T) {
+	body := []byte(`{"event":"wake"}`)
+	// 与 printf '%s' '1700000000.{"event":"wake"}' | openssl dgst -sha256 -hmac s3cret 的结果一致
+	if got, want := signWebhook("s3cret", "1700000000", body), "2184406b2e51e08037a6fec4f1a5a2c20bc04fb8d4210db39ad771522495120d"; got != want {
+		t.Errorf("signWebhook() = %s, want %s", got, want)
+	}
+	if signWebhook("s3cret", "1700000001", body) == signWebhook("s3cret", "1700000000", body) {
+		t.Error("signature does not depend on the timestamp")
+	}
+}
+
+func TestWebhookRetries(t *testing.T) {
+	useTestRegistry(t)
+	flaky, _ := startWebhookServer(t, func(n int) int {
+		if n < 3 {
+			return http.StatusServiceUnavailable
+		}
+		return http.StatusNoContent
+	})
+	rejecting, _ := startWebhookServer(t, func(int) int { return http.StatusBadRequest })
+	retries := 1
+	d := useTestWebhooks(t,
+		WebhookConfig{Name: "flaky", URL: flaky.URL, Backoff: Duration(10 * time.Millisecond)},
+		WebhookConfig{Name: "rejecting", URL: rejecting.URL, Backoff: Duration(10 * time.Millisecond), Retries: &retries},
+	)
+
+	d.fireWake(context.Background(), WakeTarget{MAC: "AA:BB:CC:DD:EE:31"}.withDefaults(), "AA:BB:CC:DD:EE:31", 1, nil)
+
+	got := map[string]WebhookDelivery{}
+	for _, dl := range waitDelivered(t, d, 2) {
+		got[dl.Webhook] = dl
+	}
+	if dl := got["flaky"]; !dl.Success || dl.Attempts != 3 || dl.StatusCode != http.StatusNoContent {
+		t.Errorf("flaky delivery = %+v, want success after 3 attempts", dl)
+	}
+	if dl := got["rejecting"]; dl.Success || dl.Attempts != 1 || !strings.Contains(dl.Error, "400") {
+		t.Errorf("rejecting delivery = %+v, want a single failed attempt", dl)
+	}
+
+	rec := httptest.NewRecorder()
+	handleAPIWebhookDeliveries(rec, httptest.NewRequest(http.MethodGet, "/api/v1/webhooks/deliveries", nil))
+	if !strings.Contains(rec.Body.String(), `"webhook":"flaky"`) {
+		t.Errorf("deliveries API = %s", rec.Body.String())
+	}
+}
+
+func TestWebhookConfigValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  WebhookConfig
+	}{
+		{name: "Missing name", cfg: WebhookConfig{URL: "https://example.com/hook"}},
+		{name: "Invalid URL", cfg: WebhookConfig{Name: "a", URL: "ftp://example.com"}},
+		{name: "Unknown event", cfg: WebhookConfig{Name: "a", URL: "https://example.com/hook", Events: []string{"sleep"}}},
+		{name: "Invalid template", cfg: WebhookConfig{Name: "a", URL: "https://example.com/hook", Body: "{{.Device"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.cfg.validate(); err == nil {
+				t.Error("validate() expected error")
+			}
+		})
+	}
+}
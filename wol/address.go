@@ -0,0 +1,70 @@
+package wol
+
+import (
+	"net"
+	"strconv"
+	"strings"
+)
+
+// SplitHostZone 去掉地址两侧的方括号并拆分出IPv6区域（接口名），
+// 如 "[ff02::1%eth0]" 返回 "ff02::1" 和 "eth0"
+func SplitHostZone(host string) (addr, zone string) {
+	host = strings.TrimSpace(host)
+	if strings.HasPrefix(host, "[") && strings.HasSuffix(host, "]") {
+		host = host[1 : len(host)-1]
+	}
+	addr, zone, _ = strings.Cut(host, "%")
+	return addr, zone
+}
+
+// needsZone 判断IPv6地址是否只在单条链路上有效，发送时必须指定接口，
+// 如链路本地单播 fe80::/10 和链路本地组播 ff02::1
+func needsZone(ip net.IP) bool {
+	if ip == nil || ip.To4() != nil {
+		return false
+	}
+	return ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast()
+}
+
+// CheckAddress 检查目的地址中的IPv6区域，以及链路本地地址是否指定了接口
+//
+// 区域可以写在地址中（ff02::1%eth0），也可以通过 iface 指定，两者同时存在时必须一致
+func CheckAddress(host, iface string) error {
+	addr, zone := SplitHostZone(host)
+	ip := net.ParseIP(addr)
+	if zone != "" {
+		if ip == nil || ip.To4() != nil {
+			return newError("check address", host, ErrInvalidAddress, "only IPv6 addresses can have a zone")
+		}
+		if iface != "" && zone != iface {
+			return newError("check address", host, ErrInvalidAddress, "zone does not match interface "+iface)
+		}
+	}
+	if needsZone(ip) && zone == "" && iface == "" {
+		return newError("check address", host, ErrInvalidAddress, "link-local IPv6 address requires an interface, e.g. "+addr+"%eth0")
+	}
+	return nil
+}
+
+// ResolveAddr 解析唤醒包的目的地址，支持IPv4、IPv6和主机名
+//
+// 链路本地IPv6地址没有写区域时使用 iface 作为区域
+func ResolveAddr(host string, port int, iface string) (*net.UDPAddr, error) {
+	if err := CheckAddress(host, iface); err != nil {
+		return nil, err
+	}
+
+	addr, zone := SplitHostZone(host)
+	if zone == "" && needsZone(net.ParseIP(addr)) {
+		zone = iface
+	}
+	if zone != "" {
+		addr += "%" + zone
+	}
+
+	udpAddr, err := net.ResolveUDPAddr("udp", net.JoinHostPort(addr, strconv.Itoa(port)))
+	if err != nil {
+		return nil, &Error{Op: "resolve address", Input: host, Kind: ErrInvalidAddress, Err: err}
+	}
+	return udpAddr, nil
+}
@@ -0,0 +1,47 @@
+package wol
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestResolveAddr(t *testing.T) {
+	tests := []struct {
+		name    string
+		host    string
+		iface   string
+		want    string
+		wantErr bool
+	}{
+		{name: "IPv4 broadcast", host: "192.168.1.255", want: "192.168.1.255:9"},
+		{name: "Multicast with zone", host: "ff02::1%eth0", want: "[ff02::1%eth0]:9"},
+		{name: "Multicast zone from interface", host: "ff02::1", iface: "eth1", want: "[ff02::1%eth1]:9"},
+		{name: "Bracketed multicast", host: "[ff02::1%eth0]", iface: "eth0", want: "[ff02::1%eth0]:9"},
+		{name: "Link-local unicast", host: "fe80::1c2:3ff:fe04:506", iface: "eth0", want: "[fe80::1c2:3ff:fe04:506%eth0]:9"},
+		{name: "Global unicast", host: "2001:db8::10", want: "[2001:db8::10]:9"},
+		{name: "Bracketed unicast", host: "[2001:db8::10]", want: "[2001:db8::10]:9"},
+		{name: "Global unicast ignores interface as zone", host: "2001:db8::10", iface: "eth0", want: "[2001:db8::10]:9"},
+		{name: "Multicast without interface", host: "ff02::1", wantErr: true},
+		{name: "Link-local without interface", host: "fe80::1", wantErr: true},
+		{name: "Zone differs from interface", host: "ff02::1%eth0", iface: "eth1", wantErr: true},
+		{name: "Zone on IPv4", host: "192.168.1.255%eth0", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr, err := ResolveAddr(tt.host, 9, tt.iface)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidAddress) {
+					t.Errorf("ResolveAddr() error = %v, want ErrInvalidAddress", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ResolveAddr() error = %v", err)
+			}
+			if addr.String() != tt.want {
+				t.Errorf("ResolveAddr() = %s, want %s", addr, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,31 @@
+//go:build linux
+
+package wol
+
+import (
+	"errors"
+	"syscall"
+)
+
+// bindToDevice 返回将套接字绑定到指定接口的控制函数 (SO_BINDTODEVICE)，
+// 使目标为 255.255.255.255 的受限广播也从该接口发出
+//
+// 权限不足时（旧内核需要CAP_NET_RAW）退回到仅绑定源地址
+func bindToDevice(iface string) func(network, address string, c syscall.RawConn) error {
+	if iface == "" {
+		return nil
+	}
+	return func(network, address string, c syscall.RawConn) error {
+		var bindErr error
+		err := c.Control(func(fd uintptr) {
+			bindErr = syscall.BindToDevice(int(fd), iface)
+		})
+		if err != nil {
+			return err
+		}
+		if errors.Is(bindErr, syscall.EPERM) {
+			return nil
+		}
+		return bindErr
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package wol
+
+import "syscall"
+
+// bindToDevice 非Linux平台不支持 SO_BINDTODEVICE，仅通过绑定源地址选择接口
+func bindToDevice(iface string) func(network, address string, c syscall.RawConn) error {
+	return nil
+}
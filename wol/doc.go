@@ -0,0 +1,12 @@
+// Package wol 构造和发送 Wake-on-LAN 魔术包
+//
+// Sender 按配置的目的地址、端口、网络接口和重复次数发送唤醒包，发送方式由 Transport 决定：
+// UDPTransport 发送UDP广播、组播或单播，EthernetTransport 在Linux上发送EtherType 0x0842的
+// 原始以太网帧，FakeTransport 只记录数据包，用于单元测试。
+//
+//	s := wol.Sender{Broadcast: "192.168.1.255", Repeat: 3, Interval: 100 * time.Millisecond}
+//	result, err := s.Wake(ctx, "AA:BB:CC:DD:EE:FF", "")
+//
+// 除 ctx 的错误和 UDPTransport.Allow 返回的错误外，本包的错误都是 *Error，可以用 errors.Is
+// 判断错误类别，如 errors.Is(err, wol.ErrInvalidMAC)。
+package wol
@@ -0,0 +1,55 @@
+package wol
+
+import (
+	"errors"
+	"strconv"
+)
+
+// 错误类别，通过 errors.Is 判断
+var (
+	ErrInvalidMAC       = errors.New("invalid MAC address")
+	ErrInvalidPassword  = errors.New("invalid SecureOn password")
+	ErrInvalidPacket    = errors.New("invalid magic packet")
+	ErrInvalidAddress   = errors.New("invalid destination address")
+	ErrInvalidInterface = errors.New("invalid network interface")
+	ErrPermission       = errors.New("permission denied, raw sockets require root or CAP_NET_RAW")
+	ErrUnsupported      = errors.New("not supported on this platform")
+	ErrSend             = errors.New("send failed")
+)
+
+// Error 本包返回的错误，记录失败的操作、相关的输入和错误类别
+type Error struct {
+	Op    string // 失败的操作，如 "parse MAC"、"send"
+	Input string // 导致失败的输入，可以为空
+	Kind  error  // 错误类别，为上面的 Err* 之一
+	Err   error  // 底层错误，可以为空
+}
+
+func (e *Error) Error() string {
+	s := "wol: " + e.Op
+	if e.Input != "" {
+		s += " " + strconv.Quote(e.Input)
+	}
+	s += ": " + e.Kind.Error()
+	if e.Err != nil {
+		s += ": " + e.Err.Error()
+	}
+	return s
+}
+
+// Unwrap 同时返回错误类别和底层错误，使 errors.Is 对两者都成立
+func (e *Error) Unwrap() []error {
+	if e.Err == nil {
+		return []error{e.Kind}
+	}
+	return []error{e.Kind, e.Err}
+}
+
+// newError 创建 *Error，reason 不为空时作为底层错误
+func newError(op, input string, kind error, reason string) *Error {
+	e := &Error{Op: op, Input: input, Kind: kind}
+	if reason != "" {
+		e.Err = errors.New(reason)
+	}
+	return e
+}
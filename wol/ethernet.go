@@ -0,0 +1,42 @@
+package wol
+
+import (
+	"context"
+	"time"
+)
+
+// Wake-on-LAN 以太网帧的 EtherType
+const etherTypeWakeOnLAN = 0x0842
+
+// ethernetBroadcast 以太网广播地址 ff:ff:ff:ff:ff:ff
+var ethernetBroadcast = []byte{0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF}
+
+// buildEthernetFrame 构造以太网帧: 目的MAC(6) + 源MAC(6) + EtherType(2) + 载荷
+func buildEthernetFrame(dst, src []byte, etherType uint16, payload []byte) []byte {
+	frame := make([]byte, 14+len(payload))
+	copy(frame[0:6], dst)
+	copy(frame[6:12], src)
+	frame[12] = byte(etherType >> 8)
+	frame[13] = byte(etherType)
+	copy(frame[14:], payload)
+	return frame
+}
+
+// EthernetTransport 在 Destination.Interface 指定的接口上广播EtherType为0x0842的原始以太网帧，
+// 忽略目的地址和端口
+//
+// 需要root或CAP_NET_RAW权限，目前只支持Linux
+type EthernetTransport struct {
+	Timeout time.Duration // 单次发送的超时，为0时不限制
+}
+
+// Send 实现 Transport，返回发送的以太网帧字节数
+func (t *EthernetTransport) Send(ctx context.Context, dst Destination, packet []byte) (int, error) {
+	if dst.Interface == "" {
+		return 0, newError("send", "", ErrInvalidInterface, "ethernet transport requires an interface")
+	}
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	return sendEthernetFrame(dst.Interface, packet, t.Timeout)
+}
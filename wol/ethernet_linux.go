@@ -0,0 +1,54 @@
+//go:build linux
+
+package wol
+
+import (
+	"errors"
+	"net"
+	"syscall"
+	"time"
+)
+
+// htons 将16位整数转换为网络字节序
+func htons(v uint16) uint16 {
+	return v<<8 | v>>8
+}
+
+// sendEthernetFrame 通过AF_PACKET原始套接字在指定接口上广播EtherType为0x0842的魔术包
+func sendEthernetFrame(ifaceName string, magicPacket []byte, timeout time.Duration) (int, error) {
+	iface, err := net.InterfaceByName(ifaceName)
+	if err != nil {
+		return 0, &Error{Op: "send", Input: ifaceName, Kind: ErrInvalidInterface, Err: err}
+	}
+	if len(iface.HardwareAddr) != 6 {
+		return 0, newError("send", ifaceName, ErrInvalidInterface, "not an ethernet interface")
+	}
+
+	proto := htons(etherTypeWakeOnLAN)
+	fd, err := syscall.Socket(syscall.AF_PACKET, syscall.SOCK_RAW, int(proto))
+	if err != nil {
+		if errors.Is(err, syscall.EPERM) || errors.Is(err, syscall.EACCES) {
+			return 0, &Error{Op: "open raw socket", Input: ifaceName, Kind: ErrPermission, Err: err}
+		}
+		return 0, &Error{Op: "open raw socket", Input: ifaceName, Kind: ErrSend, Err: err}
+	}
+	defer syscall.Close(fd)
+
+	if timeout > 0 {
+		tv := syscall.NsecToTimeval(int64(timeout))
+		syscall.SetsockoptTimeval(fd, syscall.SOL_SOCKET, syscall.SO_SNDTIMEO, &tv)
+	}
+
+	addr := &syscall.SockaddrLinklayer{
+		Protocol: proto,
+		Ifindex:  iface.Index,
+		Halen:    6,
+	}
+	copy(addr.Addr[:], ethernetBroadcast)
+
+	frame := buildEthernetFrame(ethernetBroadcast, iface.HardwareAddr, etherTypeWakeOnLAN, magicPacket)
+	if err := syscall.Sendto(fd, frame, 0, addr); err != nil {
+		return 0, &Error{Op: "send", Input: ifaceName, Kind: ErrSend, Err: err}
+	}
+	return len(frame), nil
+}
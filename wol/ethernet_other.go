@@ -0,0 +1,13 @@
+//go:build !linux
+
+package wol
+
+import (
+	"runtime"
+	"time"
+)
+
+// sendEthernetFrame 原始以太网帧目前只在Linux上通过AF_PACKET实现
+func sendEthernetFrame(ifaceName string, magicPacket []byte, timeout time.Duration) (int, error) {
+	return 0, newError("send", ifaceName, ErrUnsupported, "ethernet transport is not available on "+runtime.GOOS)
+}
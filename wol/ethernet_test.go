@@ -0,0 +1,29 @@
+package wol
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestBuildEthernetFrame(t *testing.T) {
+	src := []byte{0x02, 0x00, 0x00, 0x00, 0x00, 0x01}
+	payload := MagicPacket([]byte{0xAA, 0xBB, 0xCC, 0xDD, 0xEE, 0xFF}, nil)
+
+	frame := buildEthernetFrame(ethernetBroadcast, src, etherTypeWakeOnLAN, payload)
+
+	if len(frame) != 14+102 {
+		t.Fatalf("frame length = %d, want 116", len(frame))
+	}
+	if !bytes.Equal(frame[0:6], ethernetBroadcast) {
+		t.Errorf("destination = %x, want ffffffffffff", frame[0:6])
+	}
+	if !bytes.Equal(frame[6:12], src) {
+		t.Errorf("source = %x, want %x", frame[6:12], src)
+	}
+	if frame[12] != 0x08 || frame[13] != 0x42 {
+		t.Errorf("EtherType = %02x%02x, want 0842", frame[12], frame[13])
+	}
+	if !bytes.Equal(frame[14:], payload) {
+		t.Errorf("payload mismatch")
+	}
+}
@@ -0,0 +1,108 @@
+package wol
+
+import (
+	"bytes"
+	"encoding/hex"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	macPattern      = regexp.MustCompile("^[0-9A-Fa-f]{12}$")
+	passwordPattern = regexp.MustCompile("^([0-9A-Fa-f]{8}|[0-9A-Fa-f]{12})$")
+)
+
+// stripSeparators 移除MAC地址和密码中常见的分隔符
+func stripSeparators(s string) string {
+	return strings.NewReplacer(":", "", "-", "", " ", "").Replace(s)
+}
+
+// ParseMAC 解析MAC地址，支持冒号、连字符、空格分隔或不分隔的12位十六进制格式
+func ParseMAC(s string) (net.HardwareAddr, error) {
+	hexMAC := stripSeparators(s)
+	if !macPattern.MatchString(hexMAC) {
+		return nil, newError("parse MAC", s, ErrInvalidMAC, "want 12 hexadecimal digits")
+	}
+	mac, _ := hex.DecodeString(hexMAC)
+	return mac, nil
+}
+
+// FormatMAC 将MAC地址格式化为大写冒号分隔形式
+func FormatMAC(mac []byte) string {
+	return strings.ToUpper(net.HardwareAddr(mac).String())
+}
+
+// ParsePassword 解析SecureOn密码，支持4或6字节的十六进制格式
+// (如 AA:BB:CC:DD:EE:FF) 以及点分IPv4格式 (如 192.168.1.1)，空字符串表示不使用密码
+func ParsePassword(s string) ([]byte, error) {
+	password := strings.TrimSpace(s)
+	if password == "" {
+		return nil, nil
+	}
+
+	// 点分IPv4格式，固定为4字节
+	if strings.Contains(password, ".") {
+		ip := net.ParseIP(password).To4()
+		if ip == nil {
+			return nil, newError("parse password", s, ErrInvalidPassword, "want dotted form a.b.c.d")
+		}
+		return []byte(ip), nil
+	}
+
+	password = stripSeparators(password)
+	if !passwordPattern.MatchString(password) {
+		return nil, newError("parse password", s, ErrInvalidPassword, "want 8 or 12 hexadecimal digits")
+	}
+	return hex.DecodeString(password)
+}
+
+// MagicPacket 构造魔术包: 6个0xFF字节 + 16次重复的MAC地址 + 可选的4或6字节SecureOn密码
+func MagicPacket(mac []byte, password []byte) []byte {
+	packet := make([]byte, 102+len(password))
+
+	// 前6个字节为0xFF
+	for i := 0; i < 6; i++ {
+		packet[i] = 0xFF
+	}
+
+	// 后面重复16次MAC地址
+	for i := 0; i < 16; i++ {
+		copy(packet[6+i*6:], mac)
+	}
+
+	// 末尾附加SecureOn密码
+	copy(packet[102:], password)
+
+	return packet
+}
+
+// ParseMagicPacket 按 MagicPacket 的格式校验魔术包，返回其中的MAC地址和SecureOn密码
+func ParseMagicPacket(packet []byte) (mac []byte, password []byte, err error) {
+	switch len(packet) {
+	case 102, 106, 108:
+	default:
+		return nil, nil, newError("parse packet", "", ErrInvalidPacket, "unexpected length "+strconv.Itoa(len(packet)))
+	}
+
+	// 前6个字节必须为0xFF
+	for i := 0; i < 6; i++ {
+		if packet[i] != 0xFF {
+			return nil, nil, newError("parse packet", "", ErrInvalidPacket, "bad synchronization stream")
+		}
+	}
+
+	// 后面必须是16次相同的MAC地址
+	mac = packet[6:12]
+	for i := 1; i < 16; i++ {
+		if !bytes.Equal(packet[6+i*6:12+i*6], mac) {
+			return nil, nil, newError("parse packet", "", ErrInvalidPacket, "MAC address repetitions differ")
+		}
+	}
+
+	if len(packet) > 102 {
+		password = packet[102:]
+	}
+	return mac, password, nil
+}
@@ -0,0 +1,263 @@
+package wol
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"testing"
+)
+
+func TestParseMAC(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:    "Valid MAC with colons",
+			input:   "AA:BB:CC:DD:EE:FF",
+			want:    "aabbccddeeff",
+			wantErr: false,
+		},
+		{
+			name:    "Valid MAC with hyphens",
+			input:   "AA-BB-CC-DD-EE-FF",
+			want:    "aabbccddeeff",
+			wantErr: false,
+		},
+		{
+			name:    "Valid MAC without separators",
+			input:   "AABBCCDDEEFF",
+			want:    "aabbccddeeff",
+			wantErr: false,
+		},
+		{
+			name:    "Valid MAC lowercase",
+			input:   "aa:bb:cc:dd:ee:ff",
+			want:    "aabbccddeeff",
+			wantErr: false,
+		},
+		{
+			name:    "Valid MAC with spaces",
+			input:   "AA BB CC DD EE FF",
+			want:    "aabbccddeeff",
+			wantErr: false,
+		},
+		{
+			name:    "Invalid MAC - too short",
+			input:   "AA:BB:CC:DD:EE",
+			want:    "",
+			wantErr: true,
+		},
+		{
+			name:    "Invalid MAC - too long",
+			input:   "AA:BB:CC:DD:EE:FF:00",
+			want:    "",
+			wantErr: true,
+		},
+		{
+			name:    "Invalid MAC - invalid characters",
+			input:   "GG:HH:II:JJ:KK:LL",
+			want:    "",
+			wantErr: true,
+		},
+		{
+			name:    "Empty MAC",
+			input:   "",
+			want:    "",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseMAC(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseMAC() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err != nil && !errors.Is(err, ErrInvalidMAC) {
+				t.Errorf("ParseMAC() error = %v, want ErrInvalidMAC", err)
+			}
+			if !tt.wantErr {
+				gotHex := hex.EncodeToString(got)
+				if gotHex != tt.want {
+					t.Errorf("ParseMAC() = %v, want %v", gotHex, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestMagicPacket(t *testing.T) {
+	tests := []struct {
+		name string
+		mac  []byte
+	}{
+		{
+			name: "Standard MAC address",
+			mac:  []byte{0xAA, 0xBB, 0xCC, 0xDD, 0xEE, 0xFF},
+		},
+		{
+			name: "All zeros MAC",
+			mac:  []byte{0x00, 0x00, 0x00, 0x00, 0x00, 0x00},
+		},
+		{
+			name: "All ones MAC",
+			mac:  []byte{0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			packet := MagicPacket(tt.mac, nil)
+
+			// 检查包长度
+			if len(packet) != 102 {
+				t.Errorf("Magic packet length = %d, want 102", len(packet))
+			}
+
+			// 检查前6个字节是否都是0xFF
+			for i := 0; i < 6; i++ {
+				if packet[i] != 0xFF {
+					t.Errorf("Byte %d = 0x%02X, want 0xFF", i, packet[i])
+				}
+			}
+
+			// 检查后面是否重复了16次MAC地址
+			for i := 0; i < 16; i++ {
+				offset := 6 + i*6
+				macSlice := packet[offset : offset+6]
+				if !bytes.Equal(macSlice, tt.mac) {
+					t.Errorf("MAC repetition %d = %v, want %v", i, macSlice, tt.mac)
+				}
+			}
+		})
+	}
+}
+
+func TestMagicPacketStructure(t *testing.T) {
+	mac := []byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06}
+	packet := MagicPacket(mac, nil)
+
+	// 验证魔术包的完整结构
+	expected := make([]byte, 102)
+
+	// 前6个字节为0xFF
+	for i := 0; i < 6; i++ {
+		expected[i] = 0xFF
+	}
+
+	// 后面重复16次MAC地址
+	for i := 0; i < 16; i++ {
+		copy(expected[6+i*6:], mac)
+	}
+
+	if !bytes.Equal(packet, expected) {
+		t.Errorf("Magic packet structure mismatch")
+		t.Logf("Got:      %x", packet)
+		t.Logf("Expected: %x", expected)
+	}
+
+	// 附加SecureOn密码后，密码紧跟在16次MAC地址之后
+	for _, password := range [][]byte{
+		{0xC0, 0xA8, 0x01, 0x01},
+		{0x00, 0x11, 0x22, 0x33, 0x44, 0x55},
+	} {
+		packet := MagicPacket(mac, password)
+		want := append(append([]byte{}, expected...), password...)
+		if !bytes.Equal(packet, want) {
+			t.Errorf("Magic packet with %d-byte password mismatch", len(password))
+			t.Logf("Got:      %x", packet)
+			t.Logf("Expected: %x", want)
+		}
+	}
+}
+
+func TestParseMagicPacket(t *testing.T) {
+	mac := []byte{0xAA, 0xBB, 0xCC, 0xDD, 0xEE, 0xFF}
+	password := []byte{0x01, 0x02, 0x03, 0x04}
+
+	// MagicPacket 生成的包应能被完整解析
+	for _, pw := range [][]byte{nil, password} {
+		gotMAC, gotPassword, err := ParseMagicPacket(MagicPacket(mac, pw))
+		if err != nil {
+			t.Fatalf("ParseMagicPacket() error = %v", err)
+		}
+		if !bytes.Equal(gotMAC, mac) || !bytes.Equal(gotPassword, pw) {
+			t.Errorf("ParseMagicPacket() = %x, %x, want %x, %x", gotMAC, gotPassword, mac, pw)
+		}
+	}
+
+	badSync := MagicPacket(mac, nil)
+	badSync[3] = 0x00
+	badRepeat := MagicPacket(mac, nil)
+	badRepeat[50] ^= 0xFF
+
+	tests := []struct {
+		name   string
+		packet []byte
+	}{
+		{name: "Too short", packet: MagicPacket(mac, nil)[:100]},
+		{name: "Odd password length", packet: append(MagicPacket(mac, nil), 0x01, 0x02)},
+		{name: "Bad sync stream", packet: badSync},
+		{name: "Inconsistent MAC repetition", packet: badRepeat},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := ParseMagicPacket(tt.packet); !errors.Is(err, ErrInvalidPacket) {
+				t.Errorf("ParseMagicPacket() error = %v, want ErrInvalidPacket", err)
+			}
+		})
+	}
+}
+
+func TestParsePassword(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{name: "Empty password", input: "", want: ""},
+		{name: "6-byte hex with colons", input: "00:11:22:33:44:55", want: "001122334455"},
+		{name: "6-byte hex with hyphens", input: "00-11-22-AA-BB-CC", want: "001122aabbcc"},
+		{name: "4-byte hex", input: "DEADBEEF", want: "deadbeef"},
+		{name: "Dotted IPv4", input: "192.168.1.1", want: "c0a80101"},
+		{name: "Invalid length", input: "00:11:22:33:44", wantErr: true},
+		{name: "Invalid characters", input: "ZZ:11:22:33", wantErr: true},
+		{name: "Invalid dotted", input: "192.168.1", wantErr: true},
+		{name: "IPv6 is not accepted", input: "::1.2.3.4", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParsePassword(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParsePassword() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err != nil && !errors.Is(err, ErrInvalidPassword) {
+				t.Errorf("ParsePassword() error = %v, want ErrInvalidPassword", err)
+			}
+			if !tt.wantErr && hex.EncodeToString(got) != tt.want {
+				t.Errorf("ParsePassword() = %x, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func BenchmarkParseMAC(b *testing.B) {
+	macAddr := "AA:BB:CC:DD:EE:FF"
+	for i := 0; i < b.N; i++ {
+		ParseMAC(macAddr)
+	}
+}
+
+func BenchmarkMagicPacket(b *testing.B) {
+	mac := []byte{0xAA, 0xBB, 0xCC, 0xDD, 0xEE, 0xFF}
+	for i := 0; i < b.N; i++ {
+		MagicPacket(mac, nil)
+	}
+}
@@ -0,0 +1,97 @@
+package wol
+
+import (
+	"context"
+	"time"
+)
+
+// 未设置时使用的默认目的地址和端口
+const (
+	DefaultBroadcast = "255.255.255.255"
+	DefaultPort      = 9
+)
+
+// Sender 按配置的目标发送唤醒包，零值通过UDP发送到 255.255.255.255:9
+type Sender struct {
+	Transport Transport // 发送方式，为空时每次唤醒使用一个临时的 UDPTransport
+
+	Broadcast string // 目的地址，为空时使用 DefaultBroadcast
+	Port      int    // 目的端口，为0时使用 DefaultPort
+	Interface string // 发送使用的网络接口，可选
+	SourceIP  string // 绑定的源地址，可选
+
+	Repeat   int           // 发送的唤醒包个数，小于1时发送一个
+	Interval time.Duration // 重复发送的间隔
+}
+
+// Result 一次唤醒的发送结果
+type Result struct {
+	Packets int // 成功发送的唤醒包个数
+	Bytes   int // 发送的总字节数
+
+	// Err 发出部分唤醒包后遇到的错误（包括 ctx 被取消），全部发送成功时为空
+	Err error
+}
+
+// Wake 解析MAC地址和SecureOn密码（可为空）并发送唤醒包
+func (s *Sender) Wake(ctx context.Context, mac string, password string) (Result, error) {
+	hw, err := ParseMAC(mac)
+	if err != nil {
+		return Result{}, err
+	}
+	pw, err := ParsePassword(password)
+	if err != nil {
+		return Result{}, err
+	}
+	return s.Send(ctx, MagicPacket(hw, pw))
+}
+
+// Send 按 Repeat 重复发送魔术包，每次间隔 Interval
+//
+// 只要发出了一个包即视为成功，之后的失败记录在 Result.Err 中；一个包都没有发出时返回错误。
+// ctx 被取消时停止剩余的发送
+func (s *Sender) Send(ctx context.Context, packet []byte) (Result, error) {
+	transport := s.Transport
+	if transport == nil {
+		udp := &UDPTransport{}
+		defer udp.Close()
+		transport = udp
+	}
+
+	dst := Destination{Host: s.Broadcast, Port: s.Port, Interface: s.Interface, SourceIP: s.SourceIP}
+	if dst.Host == "" {
+		dst.Host = DefaultBroadcast
+	}
+	if dst.Port == 0 {
+		dst.Port = DefaultPort
+	}
+
+	var result Result
+	var err error
+	for i := 0; i < max(s.Repeat, 1); i++ {
+		if i > 0 && s.Interval > 0 {
+			timer := time.NewTimer(s.Interval)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+			case <-timer.C:
+			}
+		}
+		if err = ctx.Err(); err != nil {
+			break
+		}
+
+		var n int
+		n, err = transport.Send(ctx, dst, packet)
+		if err != nil {
+			break
+		}
+		result.Packets++
+		result.Bytes += n
+	}
+	if result.Packets == 0 {
+		return result, err
+	}
+	result.Err = err
+	return result, nil
+}
@@ -0,0 +1,149 @@
+package wol
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestSenderWake(t *testing.T) {
+	fake := &FakeTransport{}
+	s := Sender{Transport: fake, Interface: "eth0", Repeat: 3}
+
+	result, err := s.Wake(context.Background(), "aa-bb-cc-dd-ee-ff", "DEADBEEF")
+	if err != nil {
+		t.Fatalf("Wake() error = %v", err)
+	}
+	if result.Packets != 3 || result.Bytes != 3*106 || result.Err != nil {
+		t.Errorf("Wake() = %+v, want 3 packets of 106 bytes", result)
+	}
+
+	want := Destination{Host: DefaultBroadcast, Port: DefaultPort, Interface: "eth0"}
+	packet := MagicPacket([]byte{0xAA, 0xBB, 0xCC, 0xDD, 0xEE, 0xFF}, []byte{0xDE, 0xAD, 0xBE, 0xEF})
+	sent := fake.Sent()
+	if len(sent) != 3 {
+		t.Fatalf("sent %d packets, want 3", len(sent))
+	}
+	for _, got := range sent {
+		if got.Destination != want {
+			t.Errorf("destination = %+v, want %+v", got.Destination, want)
+		}
+		if !bytes.Equal(got.Packet, packet) {
+			t.Errorf("packet = %x, want %x", got.Packet, packet)
+		}
+	}
+}
+
+func TestSenderWakeInvalidInput(t *testing.T) {
+	fake := &FakeTransport{}
+	s := Sender{Transport: fake}
+
+	tests := []struct {
+		name     string
+		mac      string
+		password string
+		want     error
+	}{
+		{name: "Invalid MAC", mac: "AA:BB:CC", want: ErrInvalidMAC},
+		{name: "Invalid password", mac: "AA:BB:CC:DD:EE:FF", password: "123", want: ErrInvalidPassword},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := s.Wake(context.Background(), tt.mac, tt.password)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("Wake() error = %v, want %v", err, tt.want)
+			}
+			var wolErr *Error
+			if !errors.As(err, &wolErr) || wolErr.Input != tt.mac && wolErr.Input != tt.password {
+				t.Errorf("Wake() error = %#v, want *Error with the offending input", err)
+			}
+		})
+	}
+	if n := len(fake.Sent()); n != 0 {
+		t.Errorf("sent %d packets for invalid input, want 0", n)
+	}
+}
+
+func TestSenderPartialFailure(t *testing.T) {
+	errDown := &Error{Op: "send", Kind: ErrSend, Err: errors.New("network is down")}
+
+	tests := []struct {
+		name        string
+		failAfter   int
+		wantPackets int
+		wantErr     bool
+	}{
+		{name: "First packet fails", failAfter: 0, wantErr: true},
+		{name: "Later packet fails", failAfter: 2, wantPackets: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &FakeTransport{Fail: func(dst Destination, n int) error {
+				if n >= tt.failAfter {
+					return errDown
+				}
+				return nil
+			}}
+			s := Sender{Transport: fake, Repeat: 5}
+
+			result, err := s.Wake(context.Background(), "AA:BB:CC:DD:EE:FF", "")
+			if tt.wantErr {
+				if !errors.Is(err, ErrSend) {
+					t.Errorf("Wake() error = %v, want ErrSend", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Wake() error = %v", err)
+			}
+			if result.Packets != tt.wantPackets || !errors.Is(result.Err, ErrSend) {
+				t.Errorf("Wake() = %+v, want %d packets and the send error", result, tt.wantPackets)
+			}
+		})
+	}
+}
+
+func TestSenderCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	fake := &FakeTransport{Fail: func(dst Destination, n int) error {
+		cancel()
+		return nil
+	}}
+	s := Sender{Transport: fake, Repeat: 5, Interval: time.Hour}
+
+	result, err := s.Wake(ctx, "AA:BB:CC:DD:EE:FF", "")
+	if err != nil {
+		t.Fatalf("Wake() error = %v", err)
+	}
+	if result.Packets != 1 || !errors.Is(result.Err, context.Canceled) {
+		t.Errorf("Wake() = %+v, want 1 packet and context.Canceled", result)
+	}
+
+	if _, err := s.Wake(ctx, "AA:BB:CC:DD:EE:FF", ""); !errors.Is(err, context.Canceled) {
+		t.Errorf("Wake() with canceled context error = %v, want context.Canceled", err)
+	}
+}
+
+func TestSenderUDP(t *testing.T) {
+	conn := listenTestUDP(t)
+	s := Sender{Broadcast: "127.0.0.1", Port: conn.LocalAddr().(*net.UDPAddr).Port}
+
+	if _, err := s.Wake(context.Background(), "AA:BB:CC:DD:EE:FF", ""); err != nil {
+		t.Fatalf("Wake() error = %v", err)
+	}
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	buf := make([]byte, 1024)
+	n, _, err := conn.ReadFromUDP(buf)
+	if err != nil {
+		t.Fatalf("ReadFromUDP() error = %v", err)
+	}
+	if mac, _, err := ParseMagicPacket(buf[:n]); err != nil || FormatMAC(mac) != "AA:BB:CC:DD:EE:FF" {
+		t.Errorf("received MAC %x, err %v, want AA:BB:CC:DD:EE:FF", mac, err)
+	}
+}
@@ -0,0 +1,60 @@
+package wol
+
+import (
+	"context"
+	"sync"
+)
+
+// Destination 一个唤醒包的发送目标
+type Destination struct {
+	Host      string // 目的地址，IPv4/IPv6广播、组播、单播地址或主机名
+	Port      int
+	Interface string // 发送使用的网络接口，可选
+	SourceIP  string // 绑定的源地址，可选
+}
+
+// Transport 发送魔术包的方式
+type Transport interface {
+	// Send 将 packet 发送到 dst，返回发送的字节数
+	Send(ctx context.Context, dst Destination, packet []byte) (int, error)
+}
+
+// FakeTransport 只记录发送的数据包而不真正发送，用于单元测试，可以并发使用
+type FakeTransport struct {
+	// Fail 不为空时在每次发送前调用，返回错误时本次发送失败，n 为此前成功发送的次数
+	Fail func(dst Destination, n int) error
+
+	mu   sync.Mutex
+	sent []FakeSend
+}
+
+// FakeSend FakeTransport 记录的一次发送
+type FakeSend struct {
+	Destination
+	Packet []byte
+}
+
+// Send 实现 Transport
+func (f *FakeTransport) Send(ctx context.Context, dst Destination, packet []byte) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.Fail != nil {
+		if err := f.Fail(dst, len(f.sent)); err != nil {
+			return 0, err
+		}
+	}
+	f.sent = append(f.sent, FakeSend{Destination: dst, Packet: append([]byte(nil), packet...)})
+	return len(packet), nil
+}
+
+// Sent 返回已记录的所有发送
+func (f *FakeTransport) Sent() []FakeSend {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]FakeSend(nil), f.sent...)
+}
@@ -0,0 +1,150 @@
+package wol
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+)
+
+// UDPTransport 通过UDP发送魔术包，支持IPv4广播、IPv6组播和单播
+//
+// 套接字按地址族、网络接口和源地址缓存，同一出口的多次发送共用一个套接字，
+// 使用完毕后需要调用 Close。零值可以直接使用
+type UDPTransport struct {
+	// Allow 不为空时在发送前检查解析后的目的地址，返回的错误原样返回且不发送
+	Allow func(ip net.IP) error
+	// Timeout 单次发送的超时，为0时不限制；ctx 的截止时间更早时以 ctx 为准
+	Timeout time.Duration
+
+	mu    sync.Mutex
+	conns map[string]*net.UDPConn
+}
+
+// Send 实现 Transport
+//
+// 指定了网络接口或源地址时，套接字绑定到该接口/地址，避免多网卡主机从错误的网卡发出
+func (t *UDPTransport) Send(ctx context.Context, dst Destination, packet []byte) (int, error) {
+	addr, err := ResolveAddr(dst.Host, dst.Port, dst.Interface)
+	if err != nil {
+		return 0, err
+	}
+	if t.Allow != nil {
+		if err := t.Allow(addr.IP); err != nil {
+			return 0, err
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	// 套接字的地址族与目的地址一致
+	network := "udp4"
+	if addr.IP.To4() == nil {
+		network = "udp6"
+	}
+	conn, err := t.socket(network, dst.Interface, dst.SourceIP)
+	if err != nil {
+		return 0, err
+	}
+
+	var deadline time.Time
+	if t.Timeout > 0 {
+		deadline = time.Now().Add(t.Timeout)
+	}
+	if d, ok := ctx.Deadline(); ok && (deadline.IsZero() || d.Before(deadline)) {
+		deadline = d
+	}
+	conn.SetWriteDeadline(deadline)
+
+	n, err := conn.WriteToUDP(packet, addr)
+	if err != nil {
+		return 0, &Error{Op: "send", Input: addr.String(), Kind: ErrSend, Err: err}
+	}
+	return n, nil
+}
+
+// socket 返回该地址族（udp4 或 udp6）下绑定到该接口和源地址的套接字，不存在时创建
+func (t *UDPTransport) socket(network, iface, sourceIP string) (*net.UDPConn, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	key := network + "|" + iface + "|" + sourceIP
+	if conn, ok := t.conns[key]; ok {
+		return conn, nil
+	}
+	conn, err := openUDPSocket(network, iface, sourceIP)
+	if err != nil {
+		return nil, err
+	}
+	if t.conns == nil {
+		t.conns = make(map[string]*net.UDPConn)
+	}
+	t.conns[key] = conn
+	return conn, nil
+}
+
+// Close 关闭所有缓存的套接字，之后仍可以继续发送
+func (t *UDPTransport) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for key, conn := range t.conns {
+		conn.Close()
+		delete(t.conns, key)
+	}
+	return nil
+}
+
+// openUDPSocket 创建用于发送唤醒包的UDP套接字，绑定到指定的接口或源地址
+//
+// network 为 udp4 或 udp6。IPv6套接字指定接口时不绑定源地址，由内核根据目的地址的区域
+// 和 SO_BINDTODEVICE 选择出口
+func openUDPSocket(network string, iface string, sourceIP string) (*net.UDPConn, error) {
+	// 确定本地绑定地址，未指定时监听所有接口
+	localIP := net.ParseIP(sourceIP)
+	if sourceIP != "" && localIP == nil {
+		return nil, newError("open socket", sourceIP, ErrInvalidAddress, "invalid source address")
+	}
+	if localIP != nil && (localIP.To4() == nil) != (network == "udp6") {
+		return nil, newError("open socket", sourceIP, ErrInvalidAddress, "source and destination address families differ")
+	}
+	if iface != "" && localIP == nil && network == "udp4" {
+		var err error
+		localIP, err = interfaceIPv4(iface)
+		if err != nil {
+			return nil, err
+		}
+	}
+	localAddr := &net.UDPAddr{IP: localIP}
+	if needsZone(localIP) {
+		// 链路本地源地址需要指定接口才能绑定
+		localAddr.Zone = iface
+	}
+
+	lc := net.ListenConfig{Control: bindToDevice(iface)}
+	pc, err := lc.ListenPacket(context.Background(), network, localAddr.String())
+	if err != nil {
+		return nil, &Error{Op: "open socket", Input: localAddr.String(), Kind: ErrSend, Err: err}
+	}
+	return pc.(*net.UDPConn), nil
+}
+
+// interfaceIPv4 返回接口上的第一个IPv4地址，用于绑定发送套接字
+func interfaceIPv4(name string) (net.IP, error) {
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		return nil, &Error{Op: "open socket", Input: name, Kind: ErrInvalidInterface, Err: err}
+	}
+
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return nil, &Error{Op: "open socket", Input: name, Kind: ErrInvalidInterface, Err: err}
+	}
+	for _, addr := range addrs {
+		if ipnet, ok := addr.(*net.IPNet); ok && ipnet.IP.To4() != nil {
+			return ipnet.IP.To4(), nil
+		}
+	}
+	return nil, newError("open socket", name, ErrInvalidInterface, "interface has no IPv4 address")
+}
@@ -0,0 +1,73 @@
+package wol
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+// listenTestUDP 在本地回环地址上接收唤醒包
+func listenTestUDP(t *testing.T) *net.UDPConn {
+	t.Helper()
+
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("ListenUDP() error = %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func TestUDPTransportReuse(t *testing.T) {
+	conn := listenTestUDP(t)
+	dst := Destination{Host: "127.0.0.1", Port: conn.LocalAddr().(*net.UDPAddr).Port}
+
+	var udp UDPTransport
+	defer udp.Close()
+	pkt := MagicPacket([]byte{0x11, 0x22, 0x33, 0x44, 0x55, 0x66}, nil)
+	for i := 0; i < 3; i++ {
+		if _, err := udp.Send(context.Background(), dst, pkt); err != nil {
+			t.Fatalf("Send() error = %v", err)
+		}
+	}
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	buf := make([]byte, 1024)
+	var ports []int
+	for len(ports) < 3 {
+		_, addr, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			t.Fatalf("received %d packets, want 3: %v", len(ports), err)
+		}
+		ports = append(ports, addr.Port)
+	}
+	for _, port := range ports[1:] {
+		if port != ports[0] {
+			t.Errorf("packets sent from ports %d and %d, want a single reused socket", ports[0], port)
+		}
+	}
+	if len(udp.conns) != 1 {
+		t.Errorf("cached sockets = %d, want 1", len(udp.conns))
+	}
+}
+
+func TestUDPTransportAllow(t *testing.T) {
+	errDenied := errors.New("denied")
+	udp := UDPTransport{Allow: func(ip net.IP) error {
+		if ip.IsLoopback() {
+			return errDenied
+		}
+		return nil
+	}}
+	defer udp.Close()
+
+	_, err := udp.Send(context.Background(), Destination{Host: "127.0.0.1", Port: 9}, MagicPacket(make([]byte, 6), nil))
+	if !errors.Is(err, errDenied) {
+		t.Errorf("Send() error = %v, want the Allow error", err)
+	}
+	if len(udp.conns) != 0 {
+		t.Errorf("cached sockets = %d, want none for a rejected destination", len(udp.conns))
+	}
+}